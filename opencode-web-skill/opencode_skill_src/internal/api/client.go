@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"opencode_skill/internal/config"
 	"opencode_skill/internal/types"
+	"strconv"
 	"time"
 )
 
@@ -43,6 +45,88 @@ func (c *Client) CreateSession(title string) (string, error) {
 	return sessionResp.ID, nil
 }
 
+// GetSession returns the session with its directory and revert point.
+func (c *Client) GetSession(sessionID string) (*SessionResponse, error) {
+	u := fmt.Sprintf("%s/session/%s", c.BaseURL, sessionID)
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var session SessionResponse
+	if err := json.Unmarshal(resp, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session response: %v", err)
+	}
+	return &session, nil
+}
+
+// ListSessions returns the sessions of the project OpenCode resolves the
+// client's working directory to.
+func (c *Client) ListSessions() ([]SessionResponse, error) {
+	u := fmt.Sprintf("%s/session", c.BaseURL)
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []SessionResponse
+	if err := json.Unmarshal(resp, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to parse sessions response: %v", err)
+	}
+	return sessions, nil
+}
+
+// ForkSession copies a session into a new one and returns its ID. With a
+// messageID, the copy holds only the messages before that message.
+func (c *Client) ForkSession(sessionID, messageID string) (string, error) {
+	u := fmt.Sprintf("%s/session/%s/fork", c.BaseURL, sessionID)
+	payload := map[string]string{}
+	if messageID != "" {
+		payload["messageID"] = messageID
+	}
+
+	bodyBytes, err := c.doRequest("POST", u, payload)
+	if err != nil {
+		return "", err
+	}
+
+	var sessionResp SessionResponse
+	if err := json.Unmarshal(bodyBytes, &sessionResp); err != nil {
+		return "", err
+	}
+	return sessionResp.ID, nil
+}
+
+// RevertSession undoes messageID (or only partID within it) and everything
+// after it, including file changes, and returns the updated session.
+func (c *Client) RevertSession(sessionID, messageID, partID string) (*SessionResponse, error) {
+	u := fmt.Sprintf("%s/session/%s/revert", c.BaseURL, sessionID)
+	payload := map[string]string{"messageID": messageID}
+	if partID != "" {
+		payload["partID"] = partID
+	}
+	return c.sessionRequest(u, payload)
+}
+
+// UnrevertSession restores everything undone by RevertSession.
+func (c *Client) UnrevertSession(sessionID string) (*SessionResponse, error) {
+	u := fmt.Sprintf("%s/session/%s/unrevert", c.BaseURL, sessionID)
+	return c.sessionRequest(u, map[string]string{})
+}
+
+func (c *Client) sessionRequest(u string, payload interface{}) (*SessionResponse, error) {
+	bodyBytes, err := c.doRequest("POST", u, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var session SessionResponse
+	if err := json.Unmarshal(bodyBytes, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session response: %v", err)
+	}
+	return &session, nil
+}
+
 func (c *Client) doRequest(method, url string, payload interface{}) ([]byte, error) {
 	var bodyReader io.Reader
 	if payload != nil {
@@ -76,7 +160,9 @@ func (c *Client) doRequest(method, url string, payload interface{}) ([]byte, err
 	return io.ReadAll(resp.Body)
 }
 
-func (c *Client) postAndParse(u string, payload interface{}) (interface{}, error) {
+// postMessage posts to an endpoint that replies with an assistant message.
+// An empty reply yields a nil response.
+func (c *Client) postMessage(u string, payload interface{}) (*AssistantResponse, error) {
 	body, err := c.doRequest("POST", u, payload)
 	if err != nil {
 		return nil, err
@@ -86,21 +172,213 @@ func (c *Client) postAndParse(u string, payload interface{}) (interface{}, error
 		return nil, nil
 	}
 
-	var result interface{}
+	var result AssistantResponse
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, err
 	}
-	return result, nil
+	return &result, nil
+}
+
+// PromptAsync queues a prompt and returns as soon as OpenCode accepts it.
+// The session reports busy while it works and session.idle when done.
+func (c *Client) PromptAsync(sessionID string, req types.PromptRequest) error {
+	u := fmt.Sprintf("%s/session/%s/prompt_async", c.BaseURL, sessionID)
+	_, err := c.doRequest("POST", u, req)
+	return err
+}
+
+// GetSessionDiff returns the files changed in the session, or only those
+// changed by the turn of the given user message.
+func (c *Client) GetSessionDiff(sessionID, messageID string) ([]FileDiff, error) {
+	u := fmt.Sprintf("%s/session/%s/diff", c.BaseURL, sessionID)
+	if messageID != "" {
+		u += "?messageID=" + url.QueryEscape(messageID)
+	}
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []FileDiff
+	if err := json.Unmarshal(resp, &diffs); err != nil {
+		return nil, fmt.Errorf("failed to parse diff response: %v", err)
+	}
+	return diffs, nil
 }
 
-func (c *Client) SendPrompt(sessionID string, req types.PromptRequest) (interface{}, error) {
+// GetMessages returns the session's messages, oldest first. A positive limit
+// returns only the latest ones.
+func (c *Client) GetMessages(sessionID string, limit int) ([]MessageWithParts, error) {
 	u := fmt.Sprintf("%s/session/%s/message", c.BaseURL, sessionID)
-	return c.postAndParse(u, req)
+	if limit > 0 {
+		u += "?limit=" + strconv.Itoa(limit)
+	}
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []MessageWithParts
+	if err := json.Unmarshal(resp, &messages); err != nil {
+		return nil, fmt.Errorf("failed to parse messages response: %v", err)
+	}
+	return messages, nil
+}
+
+// GetMessage returns one message of the session with its parts.
+func (c *Client) GetMessage(sessionID, messageID string) (*MessageWithParts, error) {
+	u := fmt.Sprintf("%s/session/%s/message/%s", c.BaseURL, sessionID, url.PathEscape(messageID))
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var message MessageWithParts
+	if err := json.Unmarshal(resp, &message); err != nil {
+		return nil, fmt.Errorf("failed to parse message response: %v", err)
+	}
+	return &message, nil
+}
+
+// LastAssistantMessage returns the session's latest assistant reply, or nil
+// if it has none among its last few messages.
+func (c *Client) LastAssistantMessage(sessionID string) (*AssistantResponse, error) {
+	messages, err := c.GetMessages(sessionID, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		if a := messages[i].Info.Assistant; a != nil {
+			return &AssistantResponse{Info: *a, Parts: messages[i].Parts}, nil
+		}
+	}
+	return nil, nil
 }
 
-func (c *Client) SendCommand(sessionID string, req types.CommandRequest) (interface{}, error) {
+// GetSessionStatus returns the status of every session OpenCode is working
+// on, keyed by session ID. Idle sessions may be missing.
+func (c *Client) GetSessionStatus() (map[string]SessionStatus, error) {
+	u := fmt.Sprintf("%s/session/status", c.BaseURL)
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]SessionStatus)
+	if err := json.Unmarshal(resp, &statuses); err != nil {
+		return nil, fmt.Errorf("failed to parse session status response: %v", err)
+	}
+	return statuses, nil
+}
+
+func (c *Client) SendCommand(sessionID string, req types.CommandRequest) (*AssistantResponse, error) {
 	u := fmt.Sprintf("%s/session/%s/command", c.BaseURL, sessionID)
-	return c.postAndParse(u, req)
+	return c.postMessage(u, req)
+}
+
+// RunShell runs a shell command in the session and returns the assistant
+// message that records it, with the command's output as a bash tool part.
+func (c *Client) RunShell(sessionID string, req types.ShellRequest) (*AssistantResponse, error) {
+	u := fmt.Sprintf("%s/session/%s/shell", c.BaseURL, sessionID)
+	body, err := c.doRequest("POST", u, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The reply is the bare message info; the output is in its parts
+	var info struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil || info.ID == "" {
+		return c.LastAssistantMessage(sessionID)
+	}
+	message, err := c.GetMessage(sessionID, info.ID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Info.Assistant == nil {
+		return nil, fmt.Errorf("message %s is not an assistant message", info.ID)
+	}
+	return &AssistantResponse{Info: *message.Info.Assistant, Parts: message.Parts}, nil
+}
+
+// SummarizeSession compacts the session: the model summarizes the
+// conversation so far, and later turns start from the summary. It returns
+// once the summary is written.
+func (c *Client) SummarizeSession(sessionID string, model types.ModelDetails, auto bool) error {
+	u := fmt.Sprintf("%s/session/%s/summarize", c.BaseURL, sessionID)
+	payload := map[string]interface{}{
+		"providerID": model.ProviderID,
+		"modelID":    model.ModelID,
+		"auto":       auto,
+	}
+	_, err := c.doRequest("POST", u, payload)
+	return err
+}
+
+// ListAgents returns the agents configured for the client's project.
+func (c *Client) ListAgents() ([]Agent, error) {
+	u := fmt.Sprintf("%s/agent", c.BaseURL)
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var agents []Agent
+	if err := json.Unmarshal(resp, &agents); err != nil {
+		return nil, fmt.Errorf("failed to parse agent response: %v", err)
+	}
+	return agents, nil
+}
+
+// GetProviders returns the configured providers and their models.
+func (c *Client) GetProviders() ([]Provider, error) {
+	u := fmt.Sprintf("%s/config/providers", c.BaseURL)
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Providers []Provider `json:"providers"`
+	}
+	if err := json.Unmarshal(resp, &body); err != nil {
+		return nil, fmt.Errorf("failed to parse providers response: %v", err)
+	}
+	return body.Providers, nil
+}
+
+// ContextLimit returns the context window of a model, in tokens.
+func (c *Client) ContextLimit(model types.ModelDetails) (int, error) {
+	providers, err := c.GetProviders()
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range providers {
+		if p.ID != model.ProviderID {
+			continue
+		}
+		if m, ok := p.Models[model.ModelID]; ok && m.Limit.Context > 0 {
+			return m.Limit.Context, nil
+		}
+	}
+	return 0, fmt.Errorf("no context limit known for %s/%s", model.ProviderID, model.ModelID)
+}
+
+// GetTodos returns the session's todo list.
+func (c *Client) GetTodos(sessionID string) ([]Todo, error) {
+	u := fmt.Sprintf("%s/session/%s/todo", c.BaseURL, sessionID)
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var todos []Todo
+	if err := json.Unmarshal(resp, &todos); err != nil {
+		return nil, fmt.Errorf("failed to parse todo response: %v", err)
+	}
+	return todos, nil
 }
 
 func (c *Client) GetQuestions() ([]Question, error) {
@@ -134,6 +412,46 @@ func (c *Client) AnswerQuestion(req types.AnswerRequest) error {
 	return err
 }
 
+// RejectQuestion dismisses a pending question request without answering it.
+func (c *Client) RejectQuestion(requestID string) error {
+	u := fmt.Sprintf("%s/question/%s/reject", c.BaseURL, requestID)
+	_, err := c.doRequest("POST", u, map[string]interface{}{})
+	return err
+}
+
+func (c *Client) GetPermissions() ([]PermissionRequest, error) {
+	u := fmt.Sprintf("%s/permission", c.BaseURL)
+	resp, err := c.doRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var permissions []PermissionRequest
+	if err := json.Unmarshal(resp, &permissions); err != nil {
+		return nil, fmt.Errorf("failed to parse permissions response: %v", err)
+	}
+	return permissions, nil
+}
+
+// ReplyPermission answers a permission request with "once", "always" or
+// "reject". The message is passed to the agent along with a rejection.
+func (c *Client) ReplyPermission(requestID, reply, message string) error {
+	u := fmt.Sprintf("%s/permission/%s/reply", c.BaseURL, requestID)
+	payload := map[string]interface{}{"reply": reply}
+	if message != "" {
+		payload["message"] = message
+	}
+	_, err := c.doRequest("POST", u, payload)
+	return err
+}
+
+// DeleteSession deletes the session and its messages from OpenCode.
+func (c *Client) DeleteSession(sessionID string) error {
+	u := fmt.Sprintf("%s/session/%s", c.BaseURL, sessionID)
+	_, err := c.doRequest("DELETE", u, nil)
+	return err
+}
+
 func (c *Client) AbortSession(sessionID string) error {
 	u := fmt.Sprintf("%s/session/%s/abort", c.BaseURL, sessionID)
 	_, err := c.doRequest("POST", u, map[string]interface{}{})
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"opencode_skill/internal/config"
+)
+
+// Event is a single OpenCode bus event, e.g. question.asked or session.idle.
+type Event struct {
+	Type       string          `json:"type"`
+	Properties json.RawMessage `json:"properties"`
+}
+
+// GlobalEvent is an Event as delivered by GET /global/event, tagged with the
+// directory of the instance that emitted it.
+type GlobalEvent struct {
+	Directory string `json:"directory"`
+	Payload   Event  `json:"payload"`
+}
+
+// SessionID returns the ID of the session the event belongs to, or "" for
+// events that are not tied to a session.
+func (e Event) SessionID() string {
+	var props struct {
+		SessionID string `json:"sessionID"`
+		Part      struct {
+			SessionID string `json:"sessionID"`
+		} `json:"part"`
+		Info struct {
+			ID        string `json:"id"`
+			SessionID string `json:"sessionID"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(e.Properties, &props); err != nil {
+		return ""
+	}
+
+	switch {
+	case props.SessionID != "":
+		return props.SessionID
+	case props.Part.SessionID != "":
+		return props.Part.SessionID
+	case props.Info.SessionID != "":
+		return props.Info.SessionID
+	case strings.HasPrefix(e.Type, "session."):
+		// session.created/updated/deleted carry the Session itself as info
+		return props.Info.ID
+	}
+	return ""
+}
+
+// QuestionReply holds the properties of question.replied and
+// question.rejected events.
+type QuestionReply struct {
+	SessionID string `json:"sessionID"`
+	RequestID string `json:"requestID"`
+}
+
+// PermissionReplied holds the properties of permission.replied.
+type PermissionReplied struct {
+	SessionID string `json:"sessionID"`
+	RequestID string `json:"requestID"`
+	Reply     string `json:"reply"`
+}
+
+// PartUpdated holds the properties of message.part.updated. Delta is the text
+// appended to a text or reasoning part since the previous update, if any.
+type PartUpdated struct {
+	Part  Part
+	Delta string
+}
+
+func (p *PartUpdated) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Part  json.RawMessage `json:"part"`
+		Delta string          `json:"delta"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	p.Part = lenientPart(raw.Part)
+	p.Delta = raw.Delta
+	return nil
+}
+
+// TodoUpdated holds the properties of todo.updated: the session's full todo
+// list.
+type TodoUpdated struct {
+	SessionID string `json:"sessionID"`
+	Todos     []Todo `json:"todos"`
+}
+
+// SessionUpdated holds the properties of session.updated.
+type SessionUpdated struct {
+	Info SessionResponse `json:"info"`
+}
+
+// SessionStatusChanged holds the properties of session.status.
+type SessionStatusChanged struct {
+	SessionID string        `json:"sessionID"`
+	Status    SessionStatus `json:"status"`
+}
+
+// EventStream consumes OpenCode's global Server-Sent Events stream and
+// reconnects with backoff whenever it drops.
+type EventStream struct {
+	BaseURL string
+
+	// OnEvent is called for every event, in order, from the stream goroutine.
+	OnEvent func(Event)
+	// OnConnect is called each time the stream (re)connects, before any of
+	// its events. Events may have been missed while disconnected, so this is
+	// where state should be resynced.
+	OnConnect func()
+	// OnDisconnect is called each time an established connection drops.
+	// Until OnConnect fires again no events arrive, so state has to be
+	// polled instead.
+	OnDisconnect func()
+
+	httpClient *http.Client
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func NewEventStream() *EventStream {
+	return &EventStream{
+		BaseURL: config.OpenCodeURL,
+		// No timeout: the response body stays open for the stream's lifetime
+		httpClient: &http.Client{},
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+	}
+}
+
+// Run consumes the stream until stop is closed.
+func (s *EventStream) Run(stop <-chan struct{}) {
+	backoff := s.minBackoff
+	for {
+		connected, err := s.consume(stop)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if connected {
+			backoff = s.minBackoff
+			if s.OnDisconnect != nil {
+				s.OnDisconnect()
+			}
+		}
+		log.Printf("Event stream disconnected: %v. Reconnecting in %v", err, backoff)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// consume reads one connection's worth of events. It reports whether the
+// connection was established at all.
+func (s *EventStream) consume(stop <-chan struct{}) (bool, error) {
+	req, err := http.NewRequest("GET", s.BaseURL+"/global/event", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("User-Agent", "opencode-wrapper-go/1.0")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return false, fmt.Errorf("API Error %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	// Unblock the read below when asked to stop
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			resp.Body.Close()
+		case <-done:
+		}
+	}()
+
+	if s.OnConnect != nil {
+		s.OnConnect()
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return true, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			// A blank line terminates the event
+			if data.Len() > 0 {
+				s.dispatch(data.String())
+				data.Reset()
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// Comments (":...") and other fields (event:, id:, retry:) are unused
+	}
+}
+
+func (s *EventStream) dispatch(data string) {
+	var ev GlobalEvent
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		log.Printf("Failed to parse event: %v", err)
+		return
+	}
+	if ev.Payload.Type == "" || s.OnEvent == nil {
+		return
+	}
+	s.OnEvent(ev.Payload)
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvent_SessionID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name:  "question.asked",
+			event: Event{Type: "question.asked", Properties: []byte(`{"id":"que_1","sessionID":"ses_1","questions":[]}`)},
+			want:  "ses_1",
+		},
+		{
+			name:  "message.part.updated",
+			event: Event{Type: "message.part.updated", Properties: []byte(`{"part":{"id":"prt_1","sessionID":"ses_2","messageID":"msg_1"}}`)},
+			want:  "ses_2",
+		},
+		{
+			name:  "message.updated",
+			event: Event{Type: "message.updated", Properties: []byte(`{"info":{"id":"msg_1","sessionID":"ses_3"}}`)},
+			want:  "ses_3",
+		},
+		{
+			name:  "session.updated",
+			event: Event{Type: "session.updated", Properties: []byte(`{"info":{"id":"ses_4","title":"t"}}`)},
+			want:  "ses_4",
+		},
+		{
+			name:  "server.connected",
+			event: Event{Type: "server.connected", Properties: []byte(`{}`)},
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.event.SessionID(); got != tt.want {
+				t.Errorf("SessionID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventStream_DispatchAndReconnect(t *testing.T) {
+	t.Parallel()
+
+	var connections int
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/global/event" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprintf(w, "data: {\"directory\":\"/work\",\"payload\":{\"type\":\"question.asked\",\"properties\":{\"id\":\"que_%d\",\"sessionID\":\"ses_1\",\"questions\":[]}}}\n\n", n)
+		// Returning closes the stream, forcing a reconnect
+	}))
+	defer ts.Close()
+
+	events := make(chan Event, 10)
+	var connects, disconnects int
+	stream := NewEventStream()
+	stream.BaseURL = ts.URL
+	stream.minBackoff = time.Millisecond
+	stream.OnConnect = func() {
+		mu.Lock()
+		connects++
+		mu.Unlock()
+	}
+	stream.OnDisconnect = func() {
+		mu.Lock()
+		disconnects++
+		mu.Unlock()
+	}
+	stream.OnEvent = func(ev Event) { events <- ev }
+
+	stop := make(chan struct{})
+	go stream.Run(stop)
+	defer close(stop)
+
+	for i := 1; i <= 2; i++ {
+		select {
+		case ev := <-events:
+			if ev.Type != "question.asked" || ev.SessionID() != "ses_1" {
+				t.Errorf("Unexpected event %d: %+v", i, ev)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for event %d", i)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if connects < 2 {
+		t.Errorf("Expected OnConnect on every reconnect, got %d calls", connects)
+	}
+	if disconnects < 1 {
+		t.Errorf("Expected OnDisconnect when the stream dropped, got %d calls", disconnects)
+	}
+}
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Message Types - OpenCode's message and part model (see swagger.json)
+
+type ModelRef struct {
+	ProviderID string `json:"providerID"`
+	ModelID    string `json:"modelID"`
+}
+
+type MessageTime struct {
+	Created   int64 `json:"created"`
+	Completed int64 `json:"completed,omitempty"`
+}
+
+type Tokens struct {
+	Input     int `json:"input"`
+	Output    int `json:"output"`
+	Reasoning int `json:"reasoning"`
+	Cache     struct {
+		Read  int `json:"read"`
+		Write int `json:"write"`
+	} `json:"cache"`
+}
+
+type FileDiff struct {
+	File      string `json:"file"`
+	Before    string `json:"before,omitempty"`
+	After     string `json:"after,omitempty"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Status    string `json:"status,omitempty"`
+}
+
+// MessageError is one of ProviderAuthError, UnknownError,
+// MessageOutputLengthError, MessageAbortedError or APIError, told apart by
+// Name.
+type MessageError struct {
+	Name string `json:"name"`
+	Data struct {
+		Message      string `json:"message,omitempty"`
+		ProviderID   string `json:"providerID,omitempty"`
+		StatusCode   int    `json:"statusCode,omitempty"`
+		IsRetryable  bool   `json:"isRetryable,omitempty"`
+		ResponseBody string `json:"responseBody,omitempty"`
+	} `json:"data"`
+}
+
+func (e *MessageError) Error() string {
+	if e.Data.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Data.Message
+}
+
+type UserMessage struct {
+	ID        string      `json:"id"`
+	SessionID string      `json:"sessionID"`
+	Role      string      `json:"role"`
+	Time      MessageTime `json:"time"`
+	Agent     string      `json:"agent"`
+	Model     ModelRef    `json:"model"`
+	System    string      `json:"system,omitempty"`
+	Summary   *struct {
+		Title string     `json:"title,omitempty"`
+		Body  string     `json:"body,omitempty"`
+		Diffs []FileDiff `json:"diffs"`
+	} `json:"summary,omitempty"`
+}
+
+type AssistantMessage struct {
+	ID         string        `json:"id"`
+	SessionID  string        `json:"sessionID"`
+	Role       string        `json:"role"`
+	Time       MessageTime   `json:"time"`
+	Error      *MessageError `json:"error,omitempty"`
+	ParentID   string        `json:"parentID"`
+	ModelID    string        `json:"modelID"`
+	ProviderID string        `json:"providerID"`
+	Mode       string        `json:"mode"`
+	Agent      string        `json:"agent"`
+	Path       struct {
+		Cwd  string `json:"cwd"`
+		Root string `json:"root"`
+	} `json:"path"`
+	Summary bool    `json:"summary,omitempty"`
+	Cost    float64 `json:"cost"`
+	Tokens  Tokens  `json:"tokens"`
+	Finish  string  `json:"finish,omitempty"`
+}
+
+// Message is either a user or an assistant message; exactly one field is set.
+type Message struct {
+	User      *UserMessage
+	Assistant *AssistantMessage
+}
+
+func (m Message) Role() string {
+	if m.Assistant != nil {
+		return "assistant"
+	}
+	return "user"
+}
+
+func (m Message) ID() string {
+	if m.Assistant != nil {
+		return m.Assistant.ID
+	}
+	if m.User != nil {
+		return m.User.ID
+	}
+	return ""
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	if m.Assistant != nil {
+		return json.Marshal(m.Assistant)
+	}
+	return json.Marshal(m.User)
+}
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var head struct {
+		Role string `json:"role"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	*m = Message{}
+	if head.Role == "assistant" {
+		m.Assistant = &AssistantMessage{}
+		return json.Unmarshal(data, m.Assistant)
+	}
+	m.User = &UserMessage{}
+	return json.Unmarshal(data, m.User)
+}
+
+// AssistantResponse is what POST /session/{id}/message, /command and /shell
+// return: the assistant message and its parts.
+type AssistantResponse struct {
+	Info  AssistantMessage `json:"info"`
+	Parts Parts            `json:"parts"`
+}
+
+// Text returns the assistant's final text, skipping synthetic parts.
+func (r *AssistantResponse) Text() string {
+	return r.Parts.Text()
+}
+
+// MessageWithParts is an entry of GET /session/{id}/message.
+type MessageWithParts struct {
+	Info  Message `json:"info"`
+	Parts Parts   `json:"parts"`
+}
+
+// Part is one element of a message: text, a tool call, a patch, a step
+// boundary and so on. The concrete type is one of the *Part types below.
+type Part interface {
+	PartType() string
+}
+
+// PartBase holds the fields common to every part.
+type PartBase struct {
+	ID        string `json:"id"`
+	SessionID string `json:"sessionID"`
+	MessageID string `json:"messageID"`
+	Type      string `json:"type"`
+}
+
+func (p PartBase) PartType() string { return p.Type }
+
+type PartTime struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end,omitempty"`
+}
+
+type TextPart struct {
+	PartBase
+	Text      string    `json:"text"`
+	Synthetic bool      `json:"synthetic,omitempty"`
+	Ignored   bool      `json:"ignored,omitempty"`
+	Time      *PartTime `json:"time,omitempty"`
+}
+
+type ReasoningPart struct {
+	PartBase
+	Text string    `json:"text"`
+	Time *PartTime `json:"time,omitempty"`
+}
+
+type FilePart struct {
+	PartBase
+	Mime     string `json:"mime"`
+	Filename string `json:"filename,omitempty"`
+	URL      string `json:"url"`
+}
+
+const (
+	ToolStatusPending   = "pending"
+	ToolStatusRunning   = "running"
+	ToolStatusCompleted = "completed"
+	ToolStatusError     = "error"
+)
+
+// ToolState is one of ToolStatePending, ToolStateRunning, ToolStateCompleted
+// or ToolStateError, told apart by Status. Fields that do not apply to the
+// status are empty.
+type ToolState struct {
+	Status   string                 `json:"status"`
+	Input    map[string]interface{} `json:"input,omitempty"`
+	Raw      string                 `json:"raw,omitempty"`
+	Title    string                 `json:"title,omitempty"`
+	Output   string                 `json:"output,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Time     *PartTime              `json:"time,omitempty"`
+}
+
+type ToolPart struct {
+	PartBase
+	CallID string    `json:"callID"`
+	Tool   string    `json:"tool"`
+	State  ToolState `json:"state"`
+}
+
+type StepStartPart struct {
+	PartBase
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
+type StepFinishPart struct {
+	PartBase
+	Reason   string  `json:"reason"`
+	Snapshot string  `json:"snapshot,omitempty"`
+	Cost     float64 `json:"cost"`
+	Tokens   Tokens  `json:"tokens"`
+}
+
+type SnapshotPart struct {
+	PartBase
+	Snapshot string `json:"snapshot"`
+}
+
+type PatchPart struct {
+	PartBase
+	Hash  string   `json:"hash"`
+	Files []string `json:"files"`
+}
+
+type AgentPart struct {
+	PartBase
+	Name string `json:"name"`
+}
+
+type SubtaskPart struct {
+	PartBase
+	Prompt      string    `json:"prompt"`
+	Description string    `json:"description"`
+	Agent       string    `json:"agent"`
+	Model       *ModelRef `json:"model,omitempty"`
+	Command     string    `json:"command,omitempty"`
+}
+
+type RetryPart struct {
+	PartBase
+	Attempt int           `json:"attempt"`
+	Error   *MessageError `json:"error,omitempty"`
+}
+
+type CompactionPart struct {
+	PartBase
+	Auto bool `json:"auto"`
+}
+
+// UnknownPart keeps a part of a type this client does not model yet, or one
+// that failed to decode, so it survives a round trip unchanged.
+type UnknownPart struct {
+	PartBase
+	Raw json.RawMessage `json:"-"`
+}
+
+func (p *UnknownPart) MarshalJSON() ([]byte, error) {
+	return p.Raw, nil
+}
+
+// UnmarshalPart decodes a part into its concrete type based on its "type".
+func UnmarshalPart(data []byte) (Part, error) {
+	var base PartBase
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+
+	var part Part
+	switch base.Type {
+	case "text":
+		part = &TextPart{}
+	case "reasoning":
+		part = &ReasoningPart{}
+	case "file":
+		part = &FilePart{}
+	case "tool":
+		part = &ToolPart{}
+	case "step-start":
+		part = &StepStartPart{}
+	case "step-finish":
+		part = &StepFinishPart{}
+	case "snapshot":
+		part = &SnapshotPart{}
+	case "patch":
+		part = &PatchPart{}
+	case "agent":
+		part = &AgentPart{}
+	case "subtask":
+		part = &SubtaskPart{}
+	case "retry":
+		part = &RetryPart{}
+	case "compaction":
+		part = &CompactionPart{}
+	default:
+		return &UnknownPart{PartBase: base, Raw: append(json.RawMessage(nil), data...)}, nil
+	}
+
+	if err := json.Unmarshal(data, part); err != nil {
+		return nil, fmt.Errorf("invalid %s part: %v", base.Type, err)
+	}
+	return part, nil
+}
+
+// lenientPart decodes a part like UnmarshalPart, but keeps one that fails to
+// decode as an UnknownPart rather than failing the message it belongs to.
+func lenientPart(data []byte) Part {
+	part, err := UnmarshalPart(data)
+	if err == nil {
+		return part
+	}
+	log.Printf("Keeping undecodable part as is: %v", err)
+	var base PartBase
+	json.Unmarshal(data, &base)
+	return &UnknownPart{PartBase: base, Raw: append(json.RawMessage(nil), data...)}
+}
+
+// Parts is a list of message parts that decodes each element into its
+// concrete type.
+type Parts []Part
+
+func (p *Parts) UnmarshalJSON(data []byte) error {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return err
+	}
+
+	parts := make(Parts, 0, len(raws))
+	for _, raw := range raws {
+		parts = append(parts, lenientPart(raw))
+	}
+	*p = parts
+	return nil
+}
+
+// Text joins the non-synthetic text parts.
+func (p Parts) Text() string {
+	var texts []string
+	for _, part := range p {
+		if t, ok := part.(*TextPart); ok && !t.Synthetic && !t.Ignored && t.Text != "" {
+			texts = append(texts, t.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// Tools returns the tool call parts in order.
+func (p Parts) Tools() []*ToolPart {
+	var tools []*ToolPart
+	for _, part := range p {
+		if t, ok := part.(*ToolPart); ok {
+			tools = append(tools, t)
+		}
+	}
+	return tools
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const assistantResponseJSON = `{
+	"info": {
+		"id": "msg_2", "sessionID": "ses_1", "role": "assistant", "parentID": "msg_1",
+		"modelID": "glm-5", "providerID": "zai-coding-plan", "mode": "build", "agent": "sisyphus",
+		"time": {"created": 1700000000000, "completed": 1700000005000},
+		"path": {"cwd": "/work", "root": "/work"},
+		"cost": 0.01,
+		"tokens": {"input": 100, "output": 20, "reasoning": 0, "cache": {"read": 5, "write": 0}},
+		"finish": "stop"
+	},
+	"parts": [
+		{"id": "prt_1", "sessionID": "ses_1", "messageID": "msg_2", "type": "step-start"},
+		{"id": "prt_2", "sessionID": "ses_1", "messageID": "msg_2", "type": "reasoning", "text": "thinking"},
+		{"id": "prt_3", "sessionID": "ses_1", "messageID": "msg_2", "type": "tool", "callID": "call_1", "tool": "bash",
+			"state": {"status": "completed", "input": {"command": "go test ./..."}, "output": "ok", "title": "go test", "metadata": {}, "time": {"start": 1, "end": 2}}},
+		{"id": "prt_4", "sessionID": "ses_1", "messageID": "msg_2", "type": "tool", "callID": "call_2", "tool": "edit",
+			"state": {"status": "error", "input": {}, "error": "file not found", "time": {"start": 3, "end": 4}}},
+		{"id": "prt_5", "sessionID": "ses_1", "messageID": "msg_2", "type": "patch", "hash": "abc", "files": ["main.go"]},
+		{"id": "prt_6", "sessionID": "ses_1", "messageID": "msg_2", "type": "text", "text": "context", "synthetic": true},
+		{"id": "prt_7", "sessionID": "ses_1", "messageID": "msg_2", "type": "text", "text": "All tests pass."},
+		{"id": "prt_8", "sessionID": "ses_1", "messageID": "msg_2", "type": "hologram", "beam": 3},
+		{"id": "prt_9", "sessionID": "ses_1", "messageID": "msg_2", "type": "step-finish", "reason": "stop", "cost": 0.01,
+			"tokens": {"input": 100, "output": 20, "reasoning": 0, "cache": {"read": 5, "write": 0}}}
+	]
+}`
+
+func TestAssistantResponse_Decode(t *testing.T) {
+	t.Parallel()
+
+	var resp AssistantResponse
+	if err := json.Unmarshal([]byte(assistantResponseJSON), &resp); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if resp.Info.ID != "msg_2" || resp.Info.Tokens.Cache.Read != 5 || resp.Info.Finish != "stop" {
+		t.Errorf("unexpected info: %+v", resp.Info)
+	}
+	if len(resp.Parts) != 9 {
+		t.Fatalf("expected 9 parts, got %d", len(resp.Parts))
+	}
+
+	wantTypes := []string{"step-start", "reasoning", "tool", "tool", "patch", "text", "text", "hologram", "step-finish"}
+	for i, want := range wantTypes {
+		if got := resp.Parts[i].PartType(); got != want {
+			t.Errorf("part %d: type = %q, want %q", i, got, want)
+		}
+	}
+
+	if _, ok := resp.Parts[4].(*PatchPart); !ok {
+		t.Errorf("part 4: expected *PatchPart, got %T", resp.Parts[4])
+	}
+	if _, ok := resp.Parts[7].(*UnknownPart); !ok {
+		t.Errorf("part 7: expected *UnknownPart, got %T", resp.Parts[7])
+	}
+
+	if got := resp.Text(); got != "All tests pass." {
+		t.Errorf("Text() = %q, want %q", got, "All tests pass.")
+	}
+
+	tools := resp.Parts.Tools()
+	if len(tools) != 2 {
+		t.Fatalf("Tools() returned %d parts, want 2", len(tools))
+	}
+	if tools[0].State.Status != ToolStatusCompleted || tools[0].State.Output != "ok" || tools[0].State.Input["command"] != "go test ./..." {
+		t.Errorf("unexpected completed tool state: %+v", tools[0].State)
+	}
+	if tools[1].State.Status != ToolStatusError || tools[1].State.Error != "file not found" {
+		t.Errorf("unexpected error tool state: %+v", tools[1].State)
+	}
+}
+
+func TestAssistantResponse_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	var first AssistantResponse
+	if err := json.Unmarshal([]byte(assistantResponseJSON), &first); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(&first)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var second AssistantResponse
+	if err := json.Unmarshal(data, &second); err != nil {
+		t.Fatalf("Unmarshal() of marshalled response error = %v", err)
+	}
+	if len(second.Parts) != len(first.Parts) {
+		t.Fatalf("part count changed: %d -> %d", len(first.Parts), len(second.Parts))
+	}
+	unknown, ok := second.Parts[7].(*UnknownPart)
+	if !ok {
+		t.Fatalf("part 7: expected *UnknownPart, got %T", second.Parts[7])
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(unknown.Raw, &fields); err != nil || fields["beam"] != float64(3) {
+		t.Errorf("unknown part lost its fields: %s", unknown.Raw)
+	}
+}
+
+func TestMessage_UnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	raw := `[
+		{"info": {"id": "msg_1", "sessionID": "ses_1", "role": "user", "agent": "sisyphus", "model": {"providerID": "p", "modelID": "m"}, "time": {"created": 1}},
+		 "parts": [{"id": "prt_1", "sessionID": "ses_1", "messageID": "msg_1", "type": "text", "text": "hi"}]},
+		{"info": {"id": "msg_2", "sessionID": "ses_1", "role": "assistant", "error": {"name": "MessageAbortedError", "data": {"message": "aborted"}}},
+		 "parts": []}
+	]`
+
+	var msgs []MessageWithParts
+	if err := json.Unmarshal([]byte(raw), &msgs); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if msgs[0].Info.Role() != "user" || msgs[0].Info.User == nil || msgs[0].Info.User.Model.ModelID != "m" {
+		t.Errorf("unexpected user message: %+v", msgs[0].Info)
+	}
+	if msgs[0].Parts.Text() != "hi" {
+		t.Errorf("user text = %q, want %q", msgs[0].Parts.Text(), "hi")
+	}
+
+	a := msgs[1].Info.Assistant
+	if msgs[1].Info.Role() != "assistant" || a == nil || msgs[1].Info.ID() != "msg_2" {
+		t.Fatalf("unexpected assistant message: %+v", msgs[1].Info)
+	}
+	if a.Error == nil || a.Error.Error() != "MessageAbortedError: aborted" {
+		t.Errorf("unexpected assistant error: %v", a.Error)
+	}
+}
+
+func TestParts_UndecodablePart(t *testing.T) {
+	t.Parallel()
+
+	raw := `[
+		{"id": "prt_1", "type": "tool", "tool": "bash", "state": "not an object"},
+		{"id": "prt_2", "type": "text", "text": "still here"}
+	]`
+
+	var parts Parts
+	if err := json.Unmarshal([]byte(raw), &parts); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	unknown, ok := parts[0].(*UnknownPart)
+	if !ok || unknown.PartType() != "tool" || unknown.ID != "prt_1" {
+		t.Errorf("part 0: expected the undecodable tool part kept raw, got %#v", parts[0])
+	}
+	if got := parts.Text(); got != "still here" {
+		t.Errorf("Text() = %q, want %q", got, "still here")
+	}
+}
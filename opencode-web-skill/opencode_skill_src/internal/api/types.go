@@ -1,61 +1,154 @@
 package api
 
-// Request Types
+import (
+	"fmt"
+	"strings"
+)
 
-type PromptRequest struct {
-	Agent string       `json:"agent"`
-	Model ModelDetails `json:"model"`
-	Parts []Part       `json:"parts"`
+// Response Types
+
+type APIResponse struct {
+	Status  string      `json:"status,omitempty"` // Sometimes used
+	Message string      `json:"message,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
 }
 
-type CommandRequest struct {
-	Agent     string       `json:"agent"`
-	Model     ModelDetails `json:"model"`
-	Command   string       `json:"command"`
-	Arguments string       `json:"arguments"`
-	Parts     []Part       `json:"parts"`
+type SessionResponse struct {
+	ID        string         `json:"id"`
+	Title     string         `json:"title"`
+	Directory string         `json:"directory,omitempty"`
+	ParentID  string         `json:"parentID,omitempty"`
+	Time      SessionTime    `json:"time"`
+	Revert    *SessionRevert `json:"revert,omitempty"`
 }
 
-type AnswerRequest struct {
-	RequestID string     `json:"requestID"`
-	Answers   [][]string `json:"answers"`
+type SessionTime struct {
+	Created int64 `json:"created"`
+	Updated int64 `json:"updated"`
 }
 
-type ModelDetails struct {
-	ProviderID string `json:"providerID"`
-	ModelID    string `json:"modelID"`
+// SessionRevert is set while a session is reverted: MessageID (or PartID
+// within it) and everything after it are undone until the session is
+// unreverted or prompted again.
+type SessionRevert struct {
+	MessageID string `json:"messageID"`
+	PartID    string `json:"partID,omitempty"`
+	Snapshot  string `json:"snapshot,omitempty"`
+	Diff      string `json:"diff,omitempty"`
 }
 
-type Part struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+type Question struct {
+	ID        string         `json:"id"`
+	SessionID string         `json:"sessionID"`
+	Questions []QuestionInfo `json:"questions"`
 }
 
-// Response Types
+// QuestionInfo is one question of a request. Multiple allows selecting
+// several options; Custom, true unless set, allows answers that are not an
+// option label.
+type QuestionInfo struct {
+	Question string   `json:"question"`
+	Header   string   `json:"header,omitempty"`
+	Options  []Option `json:"options,omitempty"`
+	Multiple bool     `json:"multiple,omitempty"`
+	Custom   *bool    `json:"custom,omitempty"`
+}
 
-type APIResponse struct {
-	Status  string      `json:"status,omitempty"` // Sometimes used
-	Message string      `json:"message,omitempty"`
-	Result  interface{} `json:"result,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+func (q QuestionInfo) AllowsCustom() bool {
+	return q.Custom == nil || *q.Custom
 }
 
-type SessionResponse struct {
-	ID    string `json:"id"`
-	Title string `json:"title"`
+// Option returns the option labelled label, compared case-insensitively.
+func (q QuestionInfo) Option(label string) (Option, bool) {
+	for _, o := range q.Options {
+		if strings.EqualFold(o.Label, label) {
+			return o, true
+		}
+	}
+	return Option{}, false
 }
 
-type Question struct {
-	ID        string `json:"id"`
-	SessionID string `json:"sessionID"`
-	Questions []struct {
-		Question string   `json:"question"`
-		Options  []Option `json:"options,omitempty"`
-	} `json:"questions"`
+// CheckAnswers reports whether answers, one list of labels per question in
+// order, is a complete and valid reply to the request.
+func (q Question) CheckAnswers(answers [][]string) error {
+	if len(answers) != len(q.Questions) {
+		return fmt.Errorf("request %s has %d question(s), got %d answer(s)", q.ID, len(q.Questions), len(answers))
+	}
+	for i, info := range q.Questions {
+		labels := answers[i]
+		switch {
+		case len(labels) == 0:
+			return fmt.Errorf("question %d has no answer", i+1)
+		case len(labels) > 1 && !info.Multiple:
+			return fmt.Errorf("question %d takes a single answer, got %d", i+1, len(labels))
+		}
+		if info.AllowsCustom() {
+			continue
+		}
+		for _, label := range labels {
+			if o, ok := info.Option(label); !ok || o.Label != label {
+				return fmt.Errorf("question %d: %q is not one of its options", i+1, label)
+			}
+		}
+	}
+	return nil
 }
 
 type Option struct {
 	Label       string `json:"label"`
 	Description string `json:"description,omitempty"`
 }
+
+// PermissionRequest is OpenCode asking to run a tool, e.g. permission "bash"
+// with patterns ["rm -rf build"] or "edit" with the file path.
+type PermissionRequest struct {
+	ID         string                 `json:"id"`
+	SessionID  string                 `json:"sessionID"`
+	Permission string                 `json:"permission"`
+	Patterns   []string               `json:"patterns"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Always     []string               `json:"always"`
+	Tool       *struct {
+		MessageID string `json:"messageID"`
+		CallID    string `json:"callID"`
+	} `json:"tool,omitempty"`
+}
+
+type Todo struct {
+	ID       string `json:"id"`
+	Content  string `json:"content"`
+	Status   string `json:"status"`   // pending, in_progress, completed, cancelled
+	Priority string `json:"priority"` // high, medium, low
+}
+
+// Agent is one entry of GET /agent.
+type Agent struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+}
+
+// Provider is one entry of GET /config/providers.
+type Provider struct {
+	ID     string                   `json:"id"`
+	Models map[string]ProviderModel `json:"models"`
+}
+
+type ProviderModel struct {
+	ID    string `json:"id"`
+	Limit struct {
+		Context int `json:"context"`
+		Output  int `json:"output"`
+	} `json:"limit"`
+}
+
+// SessionStatus is "idle", "busy" or "retry"; Attempt, Message and Next
+// are only set for retry.
+type SessionStatus struct {
+	Type    string `json:"type"`
+	Attempt int    `json:"attempt,omitempty"`
+	Message string `json:"message,omitempty"`
+	Next    int64  `json:"next,omitempty"`
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"opencode_skill/internal/api"
+)
+
+// errNoSessionPicked is returned when the user picks no session to adopt.
+var errNoSessionPicked = errors.New("no session picked")
+
+// ListRemoteSessions returns OpenCode's top-level sessions of the project
+// workingDir belongs to, most recently updated first. An empty workingDir
+// lists those of the project OpenCode runs in.
+func (c *Client) ListRemoteSessions(workingDir string) ([]api.SessionResponse, error) {
+	var payload map[string]interface{}
+	if workingDir != "" {
+		payload = map[string]interface{}{"working_dir": workingDir}
+	}
+	var sessions []api.SessionResponse
+	if err := c.getData("LIST_REMOTE_SESSIONS", payload, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// AdoptSession registers an existing OpenCode session as project/sessionName.
+// An empty workingDir uses the session's own directory.
+func (c *Client) AdoptSession(project, sessionName, sessionID, workingDir string) (*SessionData, error) {
+	payload := map[string]string{
+		"project":             project,
+		"session_name":        sessionName,
+		"opencode_session_id": sessionID,
+	}
+	if workingDir != "" {
+		payload["working_dir"] = workingDir
+	}
+
+	resp, err := c.SendRequest("ADOPT_SESSION", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if status, _ := resp["status"].(string); status != "ok" {
+		return nil, fmt.Errorf("%v", resp["message"])
+	}
+
+	return &SessionData{
+		Project:     project,
+		SessionName: sessionName,
+		ID:          getString(resp, "session_id"),
+		WorkingDir:  getString(resp, "working_dir"),
+	}, nil
+}
+
+// PickRemoteSession lists sessions with a number each and reads the number
+// of the one to adopt. registered maps the IDs already in the registry to
+// their project and session name.
+func PickRemoteSession(sessions []api.SessionResponse, registered map[string]string, in *bufio.Reader, out io.Writer) (string, error) {
+	if len(sessions) == 0 {
+		return "", fmt.Errorf("no OpenCode sessions found")
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, s := range sessions {
+		title := s.Title
+		if name, ok := registered[s.ID]; ok {
+			title += " (registered as " + name + ")"
+		}
+		fmt.Fprintf(w, "%3d.\t%s\t%s\t%s\t%s\n", i+1, s.ID, formatTime(s.Time.Updated), s.Directory, title)
+	}
+	w.Flush()
+
+	for {
+		fmt.Fprintf(out, "Session to adopt [1-%d, empty to cancel]: ", len(sessions))
+		line, err := in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return "", errNoSessionPicked
+		}
+		if n, convErr := strconv.Atoi(line); convErr == nil && n >= 1 && n <= len(sessions) {
+			return sessions[n-1].ID, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(out, "%q is not a number from the list.\n", line)
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"opencode_skill/internal/api"
+)
+
+func TestPickRemoteSession(t *testing.T) {
+	t.Parallel()
+
+	sessions := []api.SessionResponse{
+		{ID: "ses_a", Title: "Plan the login page", Directory: "/work/app"},
+		{ID: "ses_b", Title: "Fix flaky test", Directory: "/work/app"},
+	}
+	registered := map[string]string{"ses_b": "app tests"}
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"2\n", "ses_b", nil},
+		{"x\n3\n1\n", "ses_a", nil},
+		{"\n", "", errNoSessionPicked},
+		{"", "", errNoSessionPicked},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		got, err := PickRemoteSession(sessions, registered, bufio.NewReader(strings.NewReader(tt.input)), &out)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("input %q: got %q, %v; want %q, %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+		if !strings.Contains(out.String(), "Fix flaky test (registered as app tests)") {
+			t.Errorf("input %q: expected registered sessions to be marked, got:\n%s", tt.input, out.String())
+		}
+	}
+
+	if _, err := PickRemoteSession(nil, nil, bufio.NewReader(strings.NewReader("1\n")), &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error without sessions")
+	}
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/types"
+)
+
+// ParseAnswers builds the reply to a pending question request from /answer
+// arguments:
+//
+//	[--request <id>] [N=]ANSWER ...
+//
+// --request picks the request, by default the oldest one. An argument
+// prefixed with "N=" answers question N (1-based); repeating N selects
+// several labels for a multiple-choice question. Unprefixed arguments answer
+// the next question that has no answer yet. An answer is an option label,
+// matched case-insensitively and sent as the option's own label, or, for a
+// question with options, option numbers such as "2" or "1,3".
+func ParseAnswers(questions []api.Question, args []string) (types.AnswerRequest, error) {
+	q, rest, err := selectRequest(questions, args)
+	if err != nil {
+		return types.AnswerRequest{}, err
+	}
+	if len(rest) == 0 {
+		return types.AnswerRequest{}, fmt.Errorf("no answers given")
+	}
+
+	answers := make([][]string, len(q.Questions))
+	next := 0
+	for _, arg := range rest {
+		index, answer, explicit := splitIndexed(arg)
+		if !explicit {
+			for next < len(answers) && len(answers[next]) > 0 {
+				next++
+			}
+			index = next
+			next++
+		}
+		if index < 0 || index >= len(q.Questions) {
+			return types.AnswerRequest{}, fmt.Errorf("request %s has %d question(s), no question %d", q.ID, len(q.Questions), index+1)
+		}
+
+		labels, err := resolveAnswer(q.Questions[index], answer)
+		if err != nil {
+			return types.AnswerRequest{}, fmt.Errorf("question %d: %v", index+1, err)
+		}
+		answers[index] = append(answers[index], labels...)
+	}
+
+	if err := q.CheckAnswers(answers); err != nil {
+		return types.AnswerRequest{}, err
+	}
+	return types.AnswerRequest{RequestID: q.ID, Answers: answers}, nil
+}
+
+// selectRequest picks the request named by a --request argument, or the
+// oldest one, and returns the remaining arguments.
+func selectRequest(questions []api.Question, args []string) (api.Question, []string, error) {
+	if len(questions) == 0 {
+		return api.Question{}, nil, fmt.Errorf("no pending questions")
+	}
+
+	requestID := ""
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--request":
+			if i+1 == len(args) {
+				return api.Question{}, nil, fmt.Errorf("--request needs a request ID")
+			}
+			i++
+			requestID = args[i]
+		case strings.HasPrefix(arg, "--request="):
+			requestID = strings.TrimPrefix(arg, "--request=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	if requestID == "" {
+		return questions[0], rest, nil
+	}
+	for _, q := range questions {
+		if q.ID == requestID {
+			return q, rest, nil
+		}
+	}
+	return api.Question{}, nil, fmt.Errorf("no pending question request %s", requestID)
+}
+
+// resolveAnswer turns one answer argument into option labels. A label wins
+// over an option number, so an option labelled "2" can still be chosen.
+func resolveAnswer(info api.QuestionInfo, answer string) ([]string, error) {
+	if o, ok := info.Option(answer); ok {
+		return []string{o.Label}, nil
+	}
+
+	if numbers, ok := optionNumbers(answer); ok && len(info.Options) > 0 {
+		labels := make([]string, 0, len(numbers))
+		for _, n := range numbers {
+			if n < 1 || n > len(info.Options) {
+				return nil, fmt.Errorf("no option %d (options are 1-%d)", n, len(info.Options))
+			}
+			labels = append(labels, info.Options[n-1].Label)
+		}
+		return labels, nil
+	}
+	return []string{answer}, nil
+}
+
+// optionNumbers parses a comma-separated list of numbers such as "1,3".
+func optionNumbers(s string) ([]int, bool) {
+	var numbers []int
+	for _, field := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, false
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, true
+}
+
+// splitIndexed splits an "N=ANSWER" argument into the 0-based question
+// index and the answer.
+func splitIndexed(arg string) (int, string, bool) {
+	prefix, answer, ok := strings.Cut(arg, "=")
+	if !ok {
+		return 0, arg, false
+	}
+	n, err := strconv.Atoi(prefix)
+	if err != nil || n < 1 {
+		return 0, arg, false
+	}
+	return n - 1, answer, true
+}
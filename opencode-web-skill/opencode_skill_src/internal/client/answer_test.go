@@ -0,0 +1,86 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"opencode_skill/internal/api"
+)
+
+func answerFixture() []api.Question {
+	no := false
+	return []api.Question{
+		{ID: "que_1", Questions: []api.QuestionInfo{
+			{Question: "Which database?", Options: []api.Option{{Label: "Postgres"}, {Label: "SQLite"}}, Custom: &no},
+			{Question: "Which caches?", Options: []api.Option{{Label: "Redis"}, {Label: "Memcached"}}, Multiple: true, Custom: &no},
+			{Question: "Anything else?"},
+		}},
+		{ID: "que_2", Questions: []api.QuestionInfo{
+			{Question: "Proceed?", Options: []api.Option{{Label: "Yes"}, {Label: "No"}}},
+		}},
+		{ID: "que_3", Questions: []api.QuestionInfo{
+			{Question: "How many replicas?", Options: []api.Option{{Label: "3"}, {Label: "1"}}},
+		}},
+	}
+}
+
+func TestParseAnswers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    [][]string
+		request string
+	}{
+		{"positional", []string{"Postgres", "Redis", "no"}, [][]string{{"Postgres"}, {"Redis"}, {"no"}}, "que_1"},
+		{"indexed multi-select", []string{"2=Redis", "2=memcached", "1=sqlite", "3=later"}, [][]string{{"SQLite"}, {"Redis", "Memcached"}, {"later"}}, "que_1"},
+		{"mixed", []string{"Postgres", "2=Redis", "2=Memcached", "n/a"}, [][]string{{"Postgres"}, {"Redis", "Memcached"}, {"n/a"}}, "que_1"},
+		{"other request", []string{"--request", "que_2", "yes"}, [][]string{{"Yes"}}, "que_2"},
+		{"other request, joined flag", []string{"--request=que_2", "Maybe later"}, [][]string{{"Maybe later"}}, "que_2"},
+		{"label with equals sign", []string{"--request=que_2", "x=1"}, [][]string{{"x=1"}}, "que_2"},
+		{"numeric label", []string{"--request=que_3", "1"}, [][]string{{"1"}}, "que_3"},
+		{"number of numeric label", []string{"--request=que_3", "2"}, [][]string{{"1"}}, "que_3"},
+	}
+
+	for _, tt := range tests {
+		req, err := ParseAnswers(answerFixture(), tt.args)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if req.RequestID != tt.request || !reflect.DeepEqual(req.Answers, tt.want) {
+			t.Errorf("%s: got %s %v, want %s %v", tt.name, req.RequestID, req.Answers, tt.request, tt.want)
+		}
+	}
+}
+
+func TestParseAnswers_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"Postgres", "Redis"}, "question 3 has no answer"},
+		{[]string{"MySQL", "Redis", "x"}, `"MySQL" is not one of its options`},
+		{[]string{"1=Postgres", "1=SQLite", "2=Redis", "3=x"}, "takes a single answer"},
+		{[]string{"4=x"}, "no question 4"},
+		{[]string{"a", "b", "c", "d"}, "no question 4"},
+		{[]string{"--request", "que_9", "x"}, "no pending question request que_9"},
+		{[]string{"--request"}, "needs a request ID"},
+		{[]string{"--request", "que_2"}, "no answers given"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseAnswers(answerFixture(), tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseAnswers(%q) error = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+
+	if _, err := ParseAnswers(nil, []string{"x"}); err == nil {
+		t.Error("Expected an error without pending questions")
+	}
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"opencode_skill/internal/config"
+	"opencode_skill/internal/types"
+)
+
+// FileParts reads the files named by --file paths and --glob patterns into
+// prompt file parts, in the order given with duplicates dropped. Each file is
+// sent inline as a data: URL, so OpenCode need not see the same filesystem.
+func FileParts(files, globs []string) ([]types.Part, error) {
+	paths := append([]string{}, files...)
+	for _, pattern := range globs {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("glob %q matches no files", pattern)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			// Globs skip directories rather than failing on them
+			if info, err := os.Stat(m); err == nil && !info.IsDir() {
+				paths = append(paths, m)
+			}
+		}
+	}
+
+	var parts []types.Part
+	seen := map[string]bool{}
+	total := 0
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+
+		part, size, err := filePart(abs)
+		if err != nil {
+			return nil, err
+		}
+		total += size
+		if total > config.MaxAttachmentSize {
+			return nil, fmt.Errorf("attachments exceed %s in total", formatSize(config.MaxAttachmentSize))
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+func filePart(path string) (types.Part, int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return types.Part{}, 0, err
+	}
+	if info.IsDir() {
+		return types.Part{}, 0, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > config.MaxFileSize {
+		return types.Part{}, 0, fmt.Errorf("%s is %s, larger than the %s limit", path, formatSize(int(info.Size())), formatSize(config.MaxFileSize))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return types.Part{}, 0, err
+	}
+
+	mimeType := detectMime(path, data)
+	return types.Part{
+		Type:     "file",
+		Mime:     mimeType,
+		Filename: filepath.Base(path),
+		URL:      "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data),
+	}, len(data), nil
+}
+
+// detectMime returns the file's media type without parameters. Anything that
+// sniffs as text is sent as text/plain, which OpenCode inlines for the model
+// whatever the extension; other files are typed by extension, then content.
+func detectMime(path string, data []byte) string {
+	sniffed := baseMediaType(http.DetectContentType(data))
+	if sniffed == "text/plain" {
+		return sniffed
+	}
+	if byExt := baseMediaType(mime.TypeByExtension(filepath.Ext(path))); byExt != "" {
+		return byExt
+	}
+	return sniffed
+}
+
+func baseMediaType(t string) string {
+	if t == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(t)
+	if err != nil {
+		return t
+	}
+	return mediaType
+}
+
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"opencode_skill/internal/config"
+)
+
+func TestFileParts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	files := map[string][]byte{
+		"build.log":  []byte("FAIL: TestX\n"),
+		"main.go":    []byte("package main\n"),
+		"design.png": png,
+		"spec.pdf":   []byte("%PDF-1.7\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "sub.log"), 0755)
+
+	parts, err := FileParts(
+		[]string{filepath.Join(dir, "design.png"), filepath.Join(dir, "spec.pdf")},
+		[]string{filepath.Join(dir, "*.log"), filepath.Join(dir, "*.png")},
+	)
+	if err != nil {
+		t.Fatalf("FileParts failed: %v", err)
+	}
+
+	want := []struct{ filename, mime string }{
+		{"design.png", "image/png"},
+		{"spec.pdf", "application/pdf"},
+		{"build.log", "text/plain"},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("Expected %d parts (directories and duplicates skipped), got %+v", len(want), parts)
+	}
+	for i, w := range want {
+		p := parts[i]
+		if p.Type != "file" || p.Filename != w.filename || p.Mime != w.mime {
+			t.Errorf("Part %d = %s %s %s, want file %s %s", i, p.Type, p.Filename, p.Mime, w.filename, w.mime)
+		}
+		prefix := "data:" + w.mime + ";base64,"
+		if !strings.HasPrefix(p.URL, prefix) {
+			t.Errorf("Part %d URL %q does not start with %q", i, p.URL, prefix)
+			continue
+		}
+		data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(p.URL, prefix))
+		if string(data) != string(files[w.filename]) {
+			t.Errorf("Part %d carries %q, want %q", i, data, files[w.filename])
+		}
+	}
+
+	parts, err = FileParts([]string{filepath.Join(dir, "main.go")}, nil)
+	if err != nil || parts[0].Mime != "text/plain" {
+		t.Errorf("Expected source code as text/plain, got %+v, %v", parts, err)
+	}
+}
+
+func TestFileParts_Errors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.bin")
+	if err := os.WriteFile(big, make([]byte, config.MaxFileSize+1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		files, globs []string
+		want         string
+	}{
+		{"missing file", []string{filepath.Join(dir, "nope.txt")}, nil, "no such file"},
+		{"directory", []string{dir}, nil, "is a directory"},
+		{"too large", []string{big}, nil, "larger than the 10.0 MiB limit"},
+		{"empty glob", nil, []string{filepath.Join(dir, "*.txt")}, "matches no files"},
+		{"bad glob", nil, []string{"[" + dir}, "invalid glob"},
+	}
+	for _, tt := range tests {
+		if _, err := FileParts(tt.files, tt.globs); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -1,15 +1,19 @@
 package client
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"opencode_skill/internal/api"
 	"opencode_skill/internal/config"
 	"opencode_skill/internal/manager"
 )
@@ -19,15 +23,32 @@ type Client struct {
 	Project     string
 	SessionName string
 	Quiet       bool
-	conn        net.Conn
+	Output      OutputMode
+	Follow      bool
+
+	mu      sync.Mutex // Protects conn, enc, pending, streams, nextID
+	conn    net.Conn
+	enc     *json.Encoder
+	pending map[uint64]chan map[string]interface{}
+	streams map[uint64]chan map[string]interface{}
+	nextID  uint64
 }
 
+// streamBuffer is how many events a subscription may queue before the client
+// starts dropping them. Events are full state snapshots, so a dropped event
+// is superseded by the next one.
+const streamBuffer = 256
+
+var errConnClosed = errors.New("connection to daemon closed")
+
 // SessionData represents session information from daemon
 type SessionData struct {
-	Project     string
-	SessionName string
-	ID          string
-	WorkingDir  string
+	Project      string
+	SessionName  string
+	ID           string
+	WorkingDir   string
+	LastActivity string
+	Archived     bool
 }
 
 func NewClient(sessionID string) *Client {
@@ -48,6 +69,21 @@ func (c *Client) SetQuiet(quiet bool) {
 	c.Quiet = quiet
 }
 
+func (c *Client) SetOutput(mode OutputMode) {
+	c.Output = mode
+}
+
+// SetFollow makes WaitForResult print the agent's progress while it works.
+func (c *Client) SetFollow(follow bool) {
+	c.Follow = follow
+}
+
+// verbose reports whether informational messages should be printed. JSON
+// output is kept free of them so it can be parsed as is.
+func (c *Client) verbose() bool {
+	return !c.Quiet && c.Output != OutputJSON
+}
+
 func (c *Client) fullSessionRef() string {
 	if c.Project != "" && c.SessionName != "" {
 		return c.Project + " " + c.SessionName
@@ -55,19 +91,125 @@ func (c *Client) fullSessionRef() string {
 	return c.SessionID
 }
 
+// Connect opens a persistent connection to the daemon, preferring the Unix
+// socket and falling back to TCP. It is a no-op if the client is already
+// connected.
 func (c *Client) Connect() error {
-	addr := net.JoinHostPort(config.DaemonHost, strconv.Itoa(config.DaemonPort))
-	conn, err := net.Dial("tcp", addr)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		return nil
+	}
+
+	conn, err := net.Dial("unix", config.SocketFile)
 	if err != nil {
-		return err
+		addr := net.JoinHostPort(config.DaemonHost, strconv.Itoa(config.DaemonPort))
+		conn, err = net.Dial("tcp", addr)
+		if err != nil {
+			return err
+		}
 	}
-	c.conn = conn
+	c.attachLocked(conn)
 	return nil
 }
 
+// Close closes the daemon connection. Requests still waiting for a response
+// fail with errConnClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	return c.dropLocked(c.conn)
+}
+
+func (c *Client) attachLocked(conn net.Conn) {
+	c.conn = conn
+	c.enc = json.NewEncoder(conn)
+	c.pending = make(map[uint64]chan map[string]interface{})
+	c.streams = make(map[uint64]chan map[string]interface{})
+	go c.readLoop(conn)
+}
+
+func (c *Client) dropLocked(conn net.Conn) error {
+	if c.conn != conn {
+		return nil
+	}
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	for id, ch := range c.streams {
+		close(ch)
+		delete(c.streams, id)
+	}
+	c.conn = nil
+	c.enc = nil
+	return conn.Close()
+}
+
+// readLoop routes response frames to the requests waiting on them by ID.
+func (c *Client) readLoop(conn net.Conn) {
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		var resp map[string]interface{}
+		if err := dec.Decode(&resp); err != nil {
+			break
+		}
+
+		id, _ := resp["id"].(float64)
+		c.mu.Lock()
+		if st, ok := c.streams[uint64(id)]; ok {
+			c.deliverLocked(uint64(id), st, resp)
+			c.mu.Unlock()
+			continue
+		}
+		ch, ok := c.pending[uint64(id)]
+		if ok {
+			delete(c.pending, uint64(id))
+		}
+		c.mu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+
+	c.mu.Lock()
+	c.dropLocked(conn)
+	c.mu.Unlock()
+}
+
+// deliverLocked forwards a subscription frame without blocking the read loop.
+// If the reader has fallen behind, the oldest queued frame makes room: every
+// state frame carries the full snapshot, so the newest one, which may be the
+// final IDLE, is the one that must arrive. The stream is closed after its
+// "end" frame or an error.
+func (c *Client) deliverLocked(id uint64, st chan map[string]interface{}, resp map[string]interface{}) {
+	if resp["event"] != "end" {
+		for sent := false; !sent; {
+			select {
+			case st <- resp:
+				sent = true
+			default:
+				select {
+				case <-st:
+				default:
+				}
+			}
+		}
+	}
+	if resp["event"] == "end" || resp["status"] != "ok" {
+		close(st)
+		delete(c.streams, id)
+	}
+}
+
 func (c *Client) EnsureDaemon() error {
 	if c.Connect() == nil {
-		c.conn.Close()
 		return nil
 	}
 
@@ -93,194 +235,393 @@ func (c *Client) EnsureDaemon() error {
 	for i := 0; i < 10; i++ {
 		time.Sleep(500 * time.Millisecond)
 		if c.Connect() == nil {
-			c.conn.Close()
 			return nil
 		}
 	}
 	return fmt.Errorf("daemon failed to start")
 }
 
+// SendRequest sends a request over the client's persistent connection and
+// waits for the matching response. It is safe for concurrent use; concurrent
+// calls are pipelined over the same connection.
 func (c *Client) SendRequest(action string, payload interface{}) (map[string]interface{}, error) {
 	if err := c.Connect(); err != nil {
 		// Try spawning once
 		if err := c.EnsureDaemon(); err != nil {
 			return nil, err
 		}
-		if err := c.Connect(); err != nil {
-			return nil, err
-		}
 	}
-	defer c.conn.Close()
 
-	req := map[string]interface{}{
+	ch, err := c.send(action, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		return nil, errConnClosed
+	}
+	return resp, nil
+}
+
+func (c *Client) send(action string, payload interface{}) (chan map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil, errConnClosed
+	}
+
+	c.nextID++
+	id := c.nextID
+	ch := make(chan map[string]interface{}, 1)
+	c.pending[id] = ch
+	if err := c.encodeLocked(id, action, payload); err != nil {
+		delete(c.pending, id)
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (c *Client) encodeLocked(id uint64, action string, payload interface{}) error {
+	return c.enc.Encode(map[string]interface{}{
+		"id":         id,
 		"action":     action,
 		"session_id": c.SessionID,
 		"payload":    payload,
+	})
+}
+
+// Subscribe asks the daemon to stream the session's state transitions. The
+// first event is the current state. With progress, OpenCode's part, todo and
+// status updates are relayed too as "progress" events. The returned channel
+// is closed when the stream ends, after which the caller may subscribe again.
+func (c *Client) Subscribe(progress bool) (uint64, <-chan map[string]interface{}, error) {
+	if err := c.Connect(); err != nil {
+		if err := c.EnsureDaemon(); err != nil {
+			return 0, nil, err
+		}
 	}
 
-	if err := json.NewEncoder(c.conn).Encode(req); err != nil {
-		return nil, err
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return 0, nil, errConnClosed
 	}
 
-	var resp map[string]interface{}
-	if err := json.NewDecoder(c.conn).Decode(&resp); err != nil {
-		return nil, err
+	c.nextID++
+	id := c.nextID
+	ch := make(chan map[string]interface{}, streamBuffer)
+	c.streams[id] = ch
+	var payload interface{}
+	if progress {
+		payload = map[string]interface{}{"progress": true}
 	}
-	return resp, nil
+	if err := c.encodeLocked(id, "SUBSCRIBE", payload); err != nil {
+		delete(c.streams, id)
+		return 0, nil, err
+	}
+	return id, ch, nil
+}
+
+// Unsubscribe ends a subscription. It is a no-op if the stream already ended.
+func (c *Client) Unsubscribe(id uint64) error {
+	c.mu.Lock()
+	_, ok := c.streams[id]
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	_, err := c.SendRequest("UNSUBSCRIBE", map[string]interface{}{"subscription": id})
+	return err
 }
 
 func (c *Client) WaitForResult() {
 	start := time.Now()
-	if !c.Quiet {
+	if c.verbose() {
 		fmt.Printf("Waiting for result (Timeout: %v)...\n", config.ClientTimeout)
 	}
 
+	var progress *progressPrinter
+	if c.Follow {
+		progress = newProgressPrinter(os.Stdout, c.Output == OutputJSON)
+	}
+
 	for time.Since(start) < config.ClientTimeout {
-		resp, err := c.SendRequest("GET_STATUS", nil)
+		subID, events, err := c.Subscribe(c.Follow)
 		if err != nil {
-			fmt.Printf("Error checking status: %v\n", err)
-			time.Sleep(config.PollInterval)
-			continue
-		}
-
-		if status, ok := resp["status"].(string); !ok || status != "ok" {
-			fmt.Printf("Daemon error: %v\n", resp["message"])
+			if c.verbose() {
+				fmt.Printf("Error checking status: %v\n", err)
+			}
 			time.Sleep(config.PollInterval)
 			continue
 		}
 
-		data, _ := resp["data"].(map[string]interface{})
-		state, _ := data["state"].(string)
-
-		// Check questions
-		if questionsRaw, ok := data["questions"].([]interface{}); ok && len(questionsRaw) > 0 {
-			c.printQuestions(questionsRaw)
+		done, timedOut := c.waitOnStream(events, progress, config.ClientTimeout-time.Since(start))
+		c.Unsubscribe(subID)
+		if done {
 			return
 		}
-
-		// Check result
-		latestResp, _ := data["latest_response"].(map[string]interface{})
-
-		if state == string(manager.StateIdle) && latestResp != nil {
-			if errStr, ok := latestResp["error"].(string); ok && errStr != "" {
-				fmt.Printf("Error: %s\n", errStr)
-			} else if res, ok := latestResp["result"]; ok {
-				formatted, _ := json.MarshalIndent(res, "", "  ")
-				if c.Quiet {
-					fmt.Println(string(formatted))
-				} else {
-					fmt.Println("Response received:")
-					fmt.Println(string(formatted))
-				}
-			}
-			return
+		if timedOut {
+			break
 		}
 
+		// The stream ended early (daemon restarted or dropped us); subscribe again
 		time.Sleep(config.PollInterval)
 	}
 
-	if c.Quiet {
+	switch {
+	case c.Output == OutputJSON:
+		printErrorResult(ErrorResult{Error: "timeout waiting for result", Timeout: true})
+	case c.Quiet:
 		fmt.Println("Error: Timeout waiting for result")
-	} else {
+	default:
 		fmt.Printf("\n[TIMEOUT] Message is taking longer than %v.\n", config.ClientTimeout)
 		fmt.Println("Daemon is still running in background.")
 		fmt.Printf("Run: `opencode_skill %s /wait` to check again.\n", c.fullSessionRef())
 	}
 }
 
-func (c *Client) printQuestions(questions []interface{}) {
+// waitOnStream consumes subscription events until the session has a result
+// or questions (done), the timeout expires (timedOut) or the stream ends.
+// Progress events go to progress, if any. A stream error only ends the
+// stream, since the caller subscribes again; it is reported like the other
+// informational messages, so JSON output stays parseable.
+func (c *Client) waitOnStream(events <-chan map[string]interface{}, progress *progressPrinter, timeout time.Duration) (done bool, timedOut bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false, false
+			}
+			if status, _ := ev["status"].(string); status != "ok" {
+				if c.verbose() {
+					fmt.Printf("Daemon error: %v\n", ev["message"])
+				}
+				return false, false
+			}
+			if ev["event"] == "progress" {
+				if progress != nil {
+					progress.handle(ev["data"])
+				}
+				continue
+			}
+			snap, err := decodeSnapshot(ev["data"])
+			if err != nil {
+				if c.verbose() {
+					fmt.Printf("Daemon error: %v\n", err)
+				}
+				return false, false
+			}
+			if progress != nil && resultReady(snap) {
+				progress.flush()
+			}
+			if c.printResult(snap) {
+				return true, false
+			}
+		case <-timer.C:
+			return false, true
+		}
+	}
+}
+
+// printResult prints pending questions or the finished result from a status
+// snapshot. It reports false while the session is still working.
+func (c *Client) printResult(snap *manager.Snapshot) bool {
+	if !resultReady(snap) {
+		return false
+	}
+	c.printSnapshot(snap)
+	return true
+}
+
+// resultReady reports whether the session needs the caller: it has pending
+// questions or permissions, or finished its task.
+func resultReady(snap *manager.Snapshot) bool {
+	return len(snap.Questions) > 0 || len(snap.Permissions) > 0 ||
+		(snap.State == manager.StateIdle && snap.LatestResponse != nil)
+}
+
+func (c *Client) printQuestions(questions []api.Question) {
 	if !c.Quiet {
 		fmt.Println("\n" + strings.Repeat("=", 40))
 		fmt.Println("  ACTION REQUIRED")
 		fmt.Println(strings.Repeat("=", 40))
 	}
 
-	// We need to decode map[string]interface{} to api.Question manually or just traverse
-	for _, qRaw := range questions {
-		q, _ := qRaw.(map[string]interface{})
-		if c.Quiet {
-			fmt.Printf("[?] Request ID: %v\n", q["id"])
-		} else {
-			fmt.Printf("[?] Request ID: %v\n", q["id"])
-		}
+	for _, q := range questions {
+		fmt.Printf("[?] Request ID: %s\n", q.ID)
 
-		if subQs, ok := q["questions"].([]interface{}); ok {
-			for _, subQRaw := range subQs {
-				subQ, _ := subQRaw.(map[string]interface{})
-				fmt.Printf("    %v\n", subQ["question"])
+		for i, subQ := range q.Questions {
+			prefix := "    "
+			if len(q.Questions) > 1 {
+				prefix = fmt.Sprintf("    %d. ", i+1)
+			}
+			if subQ.Header != "" {
+				fmt.Printf("%s[%s] %s\n", prefix, subQ.Header, subQ.Question)
+			} else {
+				fmt.Printf("%s%s\n", prefix, subQ.Question)
+			}
 
-				if opts, ok := subQ["options"].([]interface{}); ok {
+			if len(subQ.Options) > 0 {
+				switch {
+				case subQ.Multiple && !subQ.AllowsCustom():
+					fmt.Println("    Options (one or more):")
+				case subQ.Multiple:
+					fmt.Println("    Options (one or more, or your own answer):")
+				case !subQ.AllowsCustom():
+					fmt.Println("    Options (pick one):")
+				default:
 					fmt.Println("    Options:")
-					for _, optRaw := range opts {
-						opt, _ := optRaw.(map[string]interface{})
-						label := opt["label"]
-						desc := opt["description"]
-						if desc != nil && desc != "" {
-							fmt.Printf("      - %v: %v\n", label, desc)
-						} else {
-							fmt.Printf("      - %v\n", label)
-						}
+				}
+				for j, opt := range subQ.Options {
+					if opt.Description != "" {
+						fmt.Printf("      %d. %s: %s\n", j+1, opt.Label, opt.Description)
+					} else {
+						fmt.Printf("      %d. %s\n", j+1, opt.Label)
 					}
 				}
 			}
 		}
 	}
 	if !c.Quiet {
-		fmt.Printf("\nRun: `opencode_skill %s /answer ...`\n", c.fullSessionRef())
+		fmt.Printf("\nRun: `opencode_skill %s /answer <option number or label> ...` (or /answer -i)\n", c.fullSessionRef())
+		if len(questions) > 1 {
+			fmt.Println("Answers go to the first request unless you pass --request <ID>.")
+		}
+		fmt.Printf("To dismiss it instead: `opencode_skill %s /reject`\n", c.fullSessionRef())
 	}
 }
 
-func (c *Client) Status() {
+func (c *Client) printPermissions(permissions []api.PermissionRequest) {
+	if !c.Quiet {
+		fmt.Println("\n" + strings.Repeat("=", 40))
+		fmt.Println("  PERMISSION REQUIRED")
+		fmt.Println(strings.Repeat("=", 40))
+	}
+
+	for _, p := range permissions {
+		fmt.Printf("[!] Permission ID: %s\n", p.ID)
+		fmt.Printf("    %s: %s\n", p.Permission, strings.Join(p.Patterns, ", "))
+	}
+	if !c.Quiet {
+		fmt.Printf("\nRun: `opencode_skill %s /permit once|always|reject [message]`\n", c.fullSessionRef())
+	}
+}
+
+// GetStatus fetches the session's current snapshot from the daemon.
+func (c *Client) GetStatus() (*manager.Snapshot, error) {
 	resp, err := c.SendRequest("GET_STATUS", nil)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return
+		return nil, err
+	}
+
+	if status, _ := resp["status"].(string); status != "ok" {
+		return nil, fmt.Errorf("%v", resp["message"])
+	}
+
+	return decodeSnapshot(resp["data"])
+}
+
+// decodeSnapshot converts the generically decoded "data" of a status frame
+// back into a typed snapshot.
+func decodeSnapshot(data interface{}) (*manager.Snapshot, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var snap manager.Snapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return nil, fmt.Errorf("invalid status data: %v", err)
 	}
+	return &snap, nil
+}
 
-	if status, ok := resp["status"].(string); !ok || status != "ok" {
-		fmt.Printf("Error: %v\n", resp["message"])
+func (c *Client) Status() {
+	snap, err := c.GetStatus()
+	if err != nil {
+		c.PrintError(err)
 		return
 	}
 
-	data, _ := resp["data"].(map[string]interface{})
-	state, _ := data["state"].(string)
+	if c.Output == OutputJSON {
+		c.printSnapshot(snap)
+		return
+	}
 
 	fmt.Println("\n" + strings.Repeat("=", 40))
-	fmt.Printf("  SESSION STATUS: %s\n", state)
+	fmt.Printf("  SESSION STATUS: %s\n", snap.State)
 	fmt.Println(strings.Repeat("=", 40))
 
-	// Safely get questions
-	var qs []interface{}
-	if qSlice, ok := data["questions"].([]interface{}); ok {
-		qs = qSlice
+	if snap.Revert != nil {
+		fmt.Println("\n[REVERTED]")
+		if snap.Revert.PartID != "" {
+			fmt.Printf("Undone from part %s of message %s on. Run `/redo` to restore.\n", snap.Revert.PartID, snap.Revert.MessageID)
+		} else {
+			fmt.Printf("Undone from message %s on. Run `/redo` to restore.\n", snap.Revert.MessageID)
+		}
 	}
 
-	if len(qs) > 0 {
+	if snap.Context != nil && snap.Context.Limit > 0 {
+		fmt.Printf("\n[CONTEXT] %s\n", contextSummary(snap.Context))
+	}
+
+	if len(snap.Todos) > 0 {
+		fmt.Printf("\n[TODO] %s\n", todoSummary(snap.Todos))
+		fmt.Println("Run `/todo` for the full list.")
+	}
+
+	if len(snap.Questions) > 0 {
 		fmt.Println("\n[QUESTIONS PENDING]")
-		c.printQuestions(qs)
+		c.printQuestions(snap.Questions)
+	}
+
+	if len(snap.Permissions) > 0 {
+		fmt.Println("\n[PERMISSIONS PENDING]")
+		c.printPermissions(snap.Permissions)
 	}
 
-	latestResp, _ := data["latest_response"].(map[string]interface{})
-	if latestResp != nil {
+	if snap.LatestResponse != nil {
 		fmt.Println("\n[LATEST RESPONSE]")
-		formatted, _ := json.MarshalIndent(latestResp, "", "  ")
-		fmt.Println(string(formatted))
+		result := NewResult(&manager.Snapshot{State: snap.State, LatestResponse: snap.LatestResponse})
+		if c.Output == OutputMarkdown {
+			fmt.Print(renderMarkdown(result))
+		} else {
+			fmt.Print(renderText(result))
+		}
 	}
 
-	if state == "IDLE" && len(qs) == 0 && latestResp == nil {
+	if snap.State == manager.StateIdle && len(snap.Questions) == 0 && len(snap.Permissions) == 0 && snap.LatestResponse == nil {
 		fmt.Println("\nSession is idle with no pending work.")
-	} else if state == "BUSY" {
+	} else if snap.State == manager.StateBusy {
 		fmt.Println("\nSession is currently processing...")
 		fmt.Println("Run `/wait` to monitor for completion.")
 	}
 }
 
-func (c *Client) InitSession(project, sessionName, workingDir string) (*SessionData, error) {
-	resp, err := c.SendRequest("INIT_SESSION", map[string]string{
+// InitSession creates the session. permissionPolicy is a JSON rule list (see
+// package policy) and may be empty. autoCompact is the share of the context
+// window, in percent, at which the session is compacted; 0 turns it off.
+func (c *Client) InitSession(project, sessionName, workingDir, permissionPolicy string, autoCompact int) (*SessionData, error) {
+	payload := map[string]interface{}{
 		"project":      project,
 		"session_name": sessionName,
 		"working_dir":  workingDir,
-	})
+	}
+	if permissionPolicy != "" {
+		payload["permission_policy"] = permissionPolicy
+	}
+	if autoCompact != 0 {
+		payload["auto_compact"] = autoCompact
+	}
+
+	resp, err := c.SendRequest("INIT_SESSION", payload)
 	if err != nil {
 		return nil, err
 	}
@@ -298,6 +639,35 @@ func (c *Client) InitSession(project, sessionName, workingDir string) (*SessionD
 	}, nil
 }
 
+// ForkSession branches a session into newSessionName, at messageID if given.
+// The fork works in its parent's directory.
+func (c *Client) ForkSession(project, sessionName, newSessionName, messageID string) (*SessionData, error) {
+	payload := map[string]string{
+		"project":          project,
+		"session_name":     sessionName,
+		"new_session_name": newSessionName,
+	}
+	if messageID != "" {
+		payload["message_id"] = messageID
+	}
+
+	resp, err := c.SendRequest("FORK_SESSION", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if status, _ := resp["status"].(string); status != "ok" {
+		return nil, fmt.Errorf("%v", resp["message"])
+	}
+
+	return &SessionData{
+		Project:     project,
+		SessionName: newSessionName,
+		ID:          getString(resp, "session_id"),
+		WorkingDir:  getString(resp, "working_dir"),
+	}, nil
+}
+
 func (c *Client) AbortSession(project, sessionName string) error {
 	resp, err := c.SendRequest("ABORT_SESSION", map[string]string{
 		"project":      project,
@@ -314,6 +684,61 @@ func (c *Client) AbortSession(project, sessionName string) error {
 	return nil
 }
 
+// DeleteSession removes a session from the registry and stops its manager.
+// With remote, OpenCode deletes the session and its messages too.
+func (c *Client) DeleteSession(project, sessionName string, remote bool) (string, error) {
+	return c.sessionAction("DELETE_SESSION", map[string]interface{}{
+		"project":      project,
+		"session_name": sessionName,
+		"remote":       remote,
+	})
+}
+
+// ArchiveSession archives a session, which keeps it in the registry but out
+// of recovery at daemon start, or restores it with archived false.
+func (c *Client) ArchiveSession(project, sessionName string, archived bool) (string, error) {
+	return c.sessionAction("ARCHIVE_SESSION", map[string]interface{}{
+		"project":      project,
+		"session_name": sessionName,
+		"archived":     archived,
+	})
+}
+
+// PruneSessions deletes the sessions inactive for longer than olderThan,
+// such as 14d, and returns them with the daemon's summary. With dryRun
+// nothing is deleted.
+func (c *Client) PruneSessions(olderThan string, remote, dryRun bool) ([]SessionData, string, error) {
+	resp, err := c.SendRequest("PRUNE_SESSIONS", map[string]interface{}{
+		"older_than": olderThan,
+		"remote":     remote,
+		"dry_run":    dryRun,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if status, _ := resp["status"].(string); status != "ok" {
+		return nil, "", fmt.Errorf("%v", resp["message"])
+	}
+
+	return parseSessions(resp["data"]), getString(resp, "message"), nil
+}
+
+// sessionAction sends a request about a registered session and returns the
+// daemon's message.
+func (c *Client) sessionAction(action string, payload map[string]interface{}) (string, error) {
+	resp, err := c.SendRequest(action, payload)
+	if err != nil {
+		return "", err
+	}
+
+	if status, _ := resp["status"].(string); status != "ok" {
+		return "", fmt.Errorf("%v", resp["message"])
+	}
+
+	return getString(resp, "message"), nil
+}
+
 func (c *Client) ListSessions() ([]SessionData, error) {
 	resp, err := c.SendRequest("LIST_SESSIONS", nil)
 	if err != nil {
@@ -324,20 +749,27 @@ func (c *Client) ListSessions() ([]SessionData, error) {
 		return nil, fmt.Errorf("%v", resp["message"])
 	}
 
-	sessionsRaw, _ := resp["sessions"].([]interface{})
+	return parseSessions(resp["sessions"]), nil
+}
+
+func parseSessions(raw interface{}) []SessionData {
+	sessionsRaw, _ := raw.([]interface{})
 	sessions := make([]SessionData, 0, len(sessionsRaw))
 
 	for _, sRaw := range sessionsRaw {
 		s, _ := sRaw.(map[string]interface{})
+		archived, _ := s["archived"].(bool)
 		sessions = append(sessions, SessionData{
-			Project:     getString(s, "project"),
-			SessionName: getString(s, "session_name"),
-			ID:          getString(s, "session_id"),
-			WorkingDir:  getString(s, "working_dir"),
+			Project:      getString(s, "project"),
+			SessionName:  getString(s, "session_name"),
+			ID:           getString(s, "session_id"),
+			WorkingDir:   getString(s, "working_dir"),
+			LastActivity: getString(s, "last_activity"),
+			Archived:     archived,
 		})
 	}
 
-	return sessions, nil
+	return sessions
 }
 
 func (c *Client) GetSession(project, sessionName string) (*SessionData, error) {
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/manager"
 	"opencode_skill/internal/testutil"
 )
 
@@ -122,29 +126,42 @@ func (m *testServer) start(t *testing.T) {
 func (m *testServer) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	buf := make([]byte, 4096)
-	n, err := conn.Read(buf)
-	if err != nil {
-		return
-	}
+	var mu sync.Mutex
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
 
-	var req struct {
-		Action    string                 `json:"action"`
-		SessionID string                 `json:"session_id"`
-		Payload   map[string]interface{} `json:"payload"`
-	}
+	for {
+		var req struct {
+			ID        uint64                 `json:"id"`
+			Action    string                 `json:"action"`
+			SessionID string                 `json:"session_id"`
+			Payload   map[string]interface{} `json:"payload"`
+		}
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
 
-	if err := json.Unmarshal(buf[:n], &req); err != nil {
-		return
-	}
+		go func() {
+			var response map[string]interface{}
+			if m.handleFn != nil {
+				response = m.handleFn(req.Action, req.Payload)
+			} else {
+				response = m.responses[req.Action]
+			}
+			if response == nil {
+				response = map[string]interface{}{"status": "error", "message": "Unknown action"}
+			}
 
-	response := m.responses[req.Action]
-	if response == nil {
-		response = map[string]interface{}{"status": "error", "message": "Unknown action"}
-	}
+			framed := map[string]interface{}{"id": req.ID}
+			for k, v := range response {
+				framed[k] = v
+			}
 
-	bytes, _ := json.Marshal(response)
-	conn.Write(bytes)
+			mu.Lock()
+			enc.Encode(framed)
+			mu.Unlock()
+		}()
+	}
 }
 
 func (m *testServer) Addr() string {
@@ -259,6 +276,103 @@ func TestClient_SendRequest(t *testing.T) {
 	})
 }
 
+// connectTo attaches c to a server at addr instead of the daemon address.
+func connectTo(t *testing.T, c *Client, addr string) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial %s: %v", addr, err)
+	}
+	c.mu.Lock()
+	c.attachLocked(conn)
+	c.mu.Unlock()
+	t.Cleanup(func() { c.Close() })
+}
+
+func TestClient_SendRequest_Pipelined(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServerWithRandomPort(t, nil)
+	server.handleFn = func(action string, payload map[string]interface{}) map[string]interface{} {
+		// Answer later requests first so responses arrive out of order
+		n, _ := payload["n"].(float64)
+		time.Sleep(time.Duration(20-int(n)) * time.Millisecond)
+		return map[string]interface{}{"status": "ok", "n": n}
+	}
+	server.start(t)
+	defer server.Close()
+
+	c := NewClient("test-session")
+	connectTo(t, c, server.Addr())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			resp, err := c.SendRequest("PING", map[string]interface{}{"n": n})
+			if err != nil {
+				t.Errorf("SendRequest(%d) failed: %v", n, err)
+				return
+			}
+			if got, _ := resp["n"].(float64); int(got) != n {
+				t.Errorf("SendRequest(%d) got response for %v", n, resp["n"])
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestClient_SendRequest_LargePayload(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServerWithRandomPort(t, nil)
+	server.handleFn = func(action string, payload map[string]interface{}) map[string]interface{} {
+		text, _ := payload["text"].(string)
+		return map[string]interface{}{"status": "ok", "length": len(text)}
+	}
+	server.start(t)
+	defer server.Close()
+
+	c := NewClient("test-session")
+	connectTo(t, c, server.Addr())
+
+	text := strings.Repeat("stack trace line\n", 100000)
+	resp, err := c.SendRequest("PROMPT", map[string]interface{}{"text": text})
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	if got, _ := resp["length"].(float64); int(got) != len(text) {
+		t.Errorf("expected server to receive %d bytes, got %v", len(text), resp["length"])
+	}
+}
+
+func TestClient_SendRequest_ConnectionClosed(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServerWithRandomPort(t, nil)
+	server.handleFn = func(action string, payload map[string]interface{}) map[string]interface{} {
+		time.Sleep(time.Second)
+		return nil
+	}
+	server.start(t)
+	defer server.Close()
+
+	c := NewClient("test-session")
+	connectTo(t, c, server.Addr())
+
+	ch, err := c.send("PING", nil)
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	c.Close()
+
+	if _, ok := <-ch; ok {
+		t.Error("expected pending request to fail after Close")
+	}
+}
+
 func TestClient_SessionData(t *testing.T) {
 	t.Parallel()
 
@@ -416,3 +530,119 @@ func TestClient_Concurrent(t *testing.T) {
 	elapsed := time.Since(start)
 	t.Logf("Created 100 clients in %v", elapsed)
 }
+
+func TestClient_Subscribe(t *testing.T) {
+	t.Parallel()
+
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+
+	c := NewClient("ses_1")
+	c.mu.Lock()
+	c.attachLocked(clientConn)
+	c.mu.Unlock()
+	defer c.Close()
+
+	go func() {
+		dec := json.NewDecoder(serverConn)
+		enc := json.NewEncoder(serverConn)
+
+		var req map[string]interface{}
+		if err := dec.Decode(&req); err != nil || req["action"] != "SUBSCRIBE" {
+			return
+		}
+		id := req["id"]
+		enc.Encode(map[string]interface{}{"id": id, "status": "ok", "event": "state", "data": map[string]interface{}{"state": "BUSY"}})
+		enc.Encode(map[string]interface{}{"id": id, "status": "ok", "event": "state", "data": map[string]interface{}{
+			"state":           "IDLE",
+			"latest_response": map[string]interface{}{"result": "done"},
+		}})
+		enc.Encode(map[string]interface{}{"id": id, "status": "ok", "event": "end"})
+	}()
+
+	_, events, err := c.Subscribe(false)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	var states []string
+	for ev := range events {
+		data, _ := ev["data"].(map[string]interface{})
+		state, _ := data["state"].(string)
+		states = append(states, state)
+	}
+
+	if len(states) != 2 || states[0] != "BUSY" || states[1] != "IDLE" {
+		t.Errorf("Expected [BUSY IDLE] before stream end, got %v", states)
+	}
+}
+
+func TestClient_deliverLocked_KeepsNewest(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient("ses_1")
+	st := make(chan map[string]interface{}, 2)
+	c.streams = map[uint64]chan map[string]interface{}{1: st}
+
+	// A reader that fell behind still gets the final state
+	for _, state := range []string{"BUSY", "WAITING_FOR_INPUT", "IDLE"} {
+		c.deliverLocked(1, st, map[string]interface{}{"status": "ok", "event": "state", "data": state})
+	}
+
+	var states []interface{}
+	for len(st) > 0 {
+		states = append(states, (<-st)["data"])
+	}
+	if len(states) != 2 || states[0] != "WAITING_FOR_INPUT" || states[1] != "IDLE" {
+		t.Errorf("Expected the oldest frame dropped, got %v", states)
+	}
+}
+
+func TestClient_printResult(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient("test-session")
+	c.SetQuiet(true)
+
+	tests := []struct {
+		name string
+		snap manager.Snapshot
+		want bool
+	}{
+		{"busy", manager.Snapshot{State: manager.StateBusy}, false},
+		{"idle without response", manager.Snapshot{State: manager.StateIdle}, false},
+		{"idle with result", manager.Snapshot{State: manager.StateIdle, LatestResponse: &manager.Response{Result: &api.AssistantResponse{}}}, true},
+		{"idle with error", manager.Snapshot{State: manager.StateIdle, LatestResponse: &manager.Response{Error: "boom"}}, true},
+		{"questions", manager.Snapshot{State: manager.StateWaitingForInput, Questions: []api.Question{{ID: "q1"}}}, true},
+	}
+
+	for _, tt := range tests {
+		if got := c.printResult(&tt.snap); got != tt.want {
+			t.Errorf("%s: printResult() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeSnapshot(t *testing.T) {
+	t.Parallel()
+
+	var data interface{}
+	raw := `{"state":"IDLE","session_id":"ses_1","latest_response":{"result":{"info":{"id":"msg_1","role":"assistant"},"parts":[{"type":"text","text":"done"}]}},"questions":[]}`
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := decodeSnapshot(data)
+	if err != nil {
+		t.Fatalf("decodeSnapshot() error = %v", err)
+	}
+	if snap.State != manager.StateIdle || snap.SessionID != "ses_1" {
+		t.Errorf("unexpected snapshot header: %+v", snap)
+	}
+	if snap.LatestResponse == nil || snap.LatestResponse.Result == nil {
+		t.Fatalf("expected a result, got %+v", snap.LatestResponse)
+	}
+	if got := snap.LatestResponse.Result.Text(); got != "done" {
+		t.Errorf("Text() = %q, want %q", got, "done")
+	}
+}
@@ -0,0 +1,360 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"opencode_skill/internal/api"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around each change.
+	diffContext = 3
+	// maxDiffCells bounds the LCS table; larger changes are shown as the old
+	// lines removed and the new ones added.
+	maxDiffCells = 1 << 22
+	// maxStatBar is the widest +/- bar of a --stat line.
+	maxStatBar = 40
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// GetDiff returns the files changed in the session, or only those changed
+// by the turn of the given user message.
+func (c *Client) GetDiff(messageID string) ([]api.FileDiff, error) {
+	var payload map[string]interface{}
+	if messageID != "" {
+		payload = map[string]interface{}{"messageID": messageID}
+	}
+	var diffs []api.FileDiff
+	if err := c.getData("GET_DIFF", payload, &diffs); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// Diff prints the session's changes in the client's output mode: a unified
+// diff, or with stat a per-file summary.
+func (c *Client) Diff(messageID string, stat bool) {
+	diffs, err := c.GetDiff(messageID)
+	if err != nil {
+		c.PrintError(err)
+		return
+	}
+
+	switch c.Output {
+	case OutputJSON:
+		if stat {
+			diffs = stripContents(diffs)
+		}
+		out, _ := json.MarshalIndent(diffs, "", "  ")
+		fmt.Println(string(out))
+	case OutputMarkdown:
+		if len(diffs) == 0 {
+			fmt.Println("No changes.")
+			return
+		}
+		lang, body := "diff", ""
+		if stat {
+			lang, body = "text", RenderDiffStat(diffs, false)
+		} else {
+			for _, d := range diffs {
+				body += RenderUnifiedDiff(d, false)
+			}
+		}
+		fmt.Printf("```%s\n%s```\n", lang, body)
+	default:
+		if len(diffs) == 0 {
+			fmt.Println("No changes.")
+			return
+		}
+		color := useColor()
+		if stat {
+			fmt.Print(RenderDiffStat(diffs, color))
+			return
+		}
+		for _, d := range diffs {
+			fmt.Print(RenderUnifiedDiff(d, color))
+		}
+	}
+}
+
+// useColor reports whether to color output: stdout is a terminal and
+// NO_COLOR is not set.
+func useColor() bool {
+	return os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+func stripContents(diffs []api.FileDiff) []api.FileDiff {
+	stripped := make([]api.FileDiff, len(diffs))
+	for i, d := range diffs {
+		d.Before, d.After = "", ""
+		stripped[i] = d
+	}
+	return stripped
+}
+
+// RenderDiffStat summarizes diffs like git diff --stat: a line per file with
+// its changed line count and a +/- bar, then the totals.
+func RenderDiffStat(diffs []api.FileDiff, color bool) string {
+	nameWidth, countWidth, maxChanges := 0, 1, 0
+	for _, d := range diffs {
+		nameWidth = max(nameWidth, len(d.File))
+		changes := d.Additions + d.Deletions
+		countWidth = max(countWidth, len(fmt.Sprint(changes)))
+		maxChanges = max(maxChanges, changes)
+	}
+
+	var b strings.Builder
+	additions, deletions := 0, 0
+	for _, d := range diffs {
+		additions += d.Additions
+		deletions += d.Deletions
+
+		plus, minus := d.Additions, d.Deletions
+		if maxChanges > maxStatBar {
+			plus = scaleBar(plus, maxChanges)
+			minus = scaleBar(minus, maxChanges)
+		}
+		bar := paint(strings.Repeat("+", plus), colorGreen, color) + paint(strings.Repeat("-", minus), colorRed, color)
+		fmt.Fprintf(&b, " %-*s | %*d %s\n", nameWidth, d.File, countWidth, d.Additions+d.Deletions, bar)
+	}
+	fmt.Fprintf(&b, " %s\n", diffTotals(len(diffs), additions, deletions))
+	return b.String()
+}
+
+// scaleBar scales n changes to the bar width, keeping at least one mark for
+// any change.
+func scaleBar(n, maxChanges int) int {
+	if n == 0 {
+		return 0
+	}
+	return max(1, n*maxStatBar/maxChanges)
+}
+
+func diffTotals(files, additions, deletions int) string {
+	s := fmt.Sprintf("%d file%s changed", files, plural(files))
+	if additions > 0 || deletions == 0 {
+		s += fmt.Sprintf(", %d insertion%s(+)", additions, plural(additions))
+	}
+	if deletions > 0 || additions == 0 {
+		s += fmt.Sprintf(", %d deletion%s(-)", deletions, plural(deletions))
+	}
+	return s
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+func paint(s, code string, color bool) string {
+	if !color || s == "" {
+		return s
+	}
+	return code + s + colorReset
+}
+
+// RenderUnifiedDiff renders one file's change as a git-style unified diff.
+func RenderUnifiedDiff(d api.FileDiff, color bool) string {
+	var b strings.Builder
+
+	from, to := "a/"+d.File, "b/"+d.File
+	switch d.Status {
+	case "added":
+		from = "/dev/null"
+	case "deleted":
+		to = "/dev/null"
+	}
+	b.WriteString(paint(fmt.Sprintf("diff --git a/%s b/%s", d.File, d.File), colorBold, color) + "\n")
+	b.WriteString(paint("--- "+from, colorBold, color) + "\n")
+	b.WriteString(paint("+++ "+to, colorBold, color) + "\n")
+
+	ops := diffLines(splitLines(d.Before), splitLines(d.After))
+	for _, h := range hunks(ops) {
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.oldStart, h.oldLines), hunkRange(h.newStart, h.newLines))
+		b.WriteString(paint(header, colorCyan, color) + "\n")
+		for _, op := range h.ops {
+			line := string(op.kind) + op.line
+			switch op.kind {
+			case '-':
+				line = paint(line, colorRed, color)
+			case '+':
+				line = paint(line, colorGreen, color)
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// hunkRange formats the start,count of a hunk header. An empty range starts
+// at the line before it.
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		start--
+	}
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns an edit script turning a into b, from a longest common
+// subsequence of the lines between the common prefix and suffix.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func diffMiddle(a, b []string) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > maxDiffCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+type hunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	ops                []diffOp
+}
+
+// hunks groups the changes of an edit script with diffContext lines of
+// context, merging changes whose context overlaps.
+func hunks(ops []diffOp) []hunk {
+	var result []hunk
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// Back up over the leading context
+		start := max(0, i-diffContext)
+		for k := start; k < i; k++ {
+			oldLine--
+			newLine--
+		}
+		h := hunk{oldStart: oldLine, newStart: newLine}
+
+		// Extend until a run of unchanged lines is long enough to split on
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				end = min(run, end+diffContext)
+				break
+			}
+			end = run
+		}
+
+		for _, op := range ops[start:end] {
+			h.ops = append(h.ops, op)
+			if op.kind != '+' {
+				h.oldLines++
+				oldLine++
+			}
+			if op.kind != '-' {
+				h.newLines++
+				newLine++
+			}
+		}
+		result = append(result, h)
+		i = end
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"opencode_skill/internal/api"
+)
+
+func TestRenderUnifiedDiff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		diff api.FileDiff
+		want string
+	}{
+		{
+			name: "modified",
+			diff: api.FileDiff{File: "a.go", Before: "1\n2\n3\n4\n5\n", After: "1\n2\nthree\n4\n5\n6\n"},
+			want: "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n" +
+				"@@ -1,5 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n+6\n",
+		},
+		{
+			name: "added",
+			diff: api.FileDiff{File: "new.go", After: "package x\n", Status: "added"},
+			want: "diff --git a/new.go b/new.go\n--- /dev/null\n+++ b/new.go\n" +
+				"@@ -0,0 +1 @@\n+package x\n",
+		},
+		{
+			name: "deleted",
+			diff: api.FileDiff{File: "old.go", Before: "a\nb\n", Status: "deleted"},
+			want: "diff --git a/old.go b/old.go\n--- a/old.go\n+++ /dev/null\n" +
+				"@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := RenderUnifiedDiff(tt.diff, false); got != tt.want {
+			t.Errorf("%s: RenderUnifiedDiff() =\n%s\nwant:\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderUnifiedDiff_SplitsHunks(t *testing.T) {
+	t.Parallel()
+
+	var before []string
+	for i := 1; i <= 20; i++ {
+		before = append(before, fmt.Sprint(i))
+	}
+	after := append([]string{}, before...)
+	after[1] = "two"
+	after[17] = "eighteen"
+
+	got := RenderUnifiedDiff(api.FileDiff{
+		File:   "n.txt",
+		Before: strings.Join(before, "\n") + "\n",
+		After:  strings.Join(after, "\n") + "\n",
+	}, false)
+
+	for _, want := range []string{
+		"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n",
+		"@@ -15,6 +15,6 @@\n 15\n 16\n 17\n-18\n+eighteen\n 19\n 20\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("RenderUnifiedDiff() missing %q in:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Errorf("expected 2 hunks, got %d in:\n%s", n, got)
+	}
+}
+
+func TestRenderDiffStat(t *testing.T) {
+	t.Parallel()
+
+	got := RenderDiffStat([]api.FileDiff{
+		{File: "main.go", Additions: 3, Deletions: 1},
+		{File: "internal/x.go", Additions: 120},
+	}, false)
+
+	want := " main.go       |   4 +-\n" +
+		" internal/x.go | 120 " + strings.Repeat("+", maxStatBar) + "\n" +
+		" 2 files changed, 123 insertions(+), 1 deletion(-)\n"
+	if got != want {
+		t.Errorf("RenderDiffStat() =\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,262 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"opencode_skill/internal/api"
+)
+
+// maxSummaryLen caps the first line of text shown per /history entry.
+const maxSummaryLen = 80
+
+// HistoryEntry is one message of /history.
+type HistoryEntry struct {
+	ID      string `json:"id"`
+	Role    string `json:"role"`
+	Agent   string `json:"agent,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Created int64  `json:"created"`
+	Summary string `json:"summary"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewHistoryEntry summarizes a message by the first line of its text.
+func NewHistoryEntry(m api.MessageWithParts) HistoryEntry {
+	e := HistoryEntry{ID: m.Info.ID(), Role: m.Info.Role(), Summary: firstLine(m.Parts.Text())}
+	if u := m.Info.User; u != nil {
+		e.Agent = u.Agent
+		e.Model = modelName(u.Model.ProviderID, u.Model.ModelID)
+		e.Created = u.Time.Created
+	}
+	if a := m.Info.Assistant; a != nil {
+		e.Agent = a.Agent
+		if e.Agent == "" {
+			e.Agent = a.Mode
+		}
+		e.Model = modelName(a.ProviderID, a.ModelID)
+		e.Created = a.Time.Created
+		if a.Error != nil {
+			e.Error = a.Error.Error()
+		}
+		if e.Summary == "" {
+			e.Summary = toolSummary(m.Parts.Tools())
+		}
+	}
+	return e
+}
+
+// GetHistory returns the session's last limit messages, oldest first, or
+// all of them if limit is 0.
+func (c *Client) GetHistory(limit int) ([]api.MessageWithParts, error) {
+	var payload map[string]interface{}
+	if limit > 0 {
+		payload = map[string]interface{}{"limit": limit}
+	}
+	var messages []api.MessageWithParts
+	if err := c.getData("GET_HISTORY", payload, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetMessage returns one message of the session with its parts.
+func (c *Client) GetMessage(messageID string) (*api.MessageWithParts, error) {
+	var message api.MessageWithParts
+	if err := c.getData("GET_MESSAGE", map[string]interface{}{"messageID": messageID}, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// getData sends a request and decodes the data field of its response.
+func (c *Client) getData(action string, payload interface{}, v interface{}) error {
+	resp, err := c.SendRequest(action, payload)
+	if err != nil {
+		return err
+	}
+
+	if status, _ := resp["status"].(string); status != "ok" {
+		return fmt.Errorf("%v", resp["message"])
+	}
+
+	raw, err := json.Marshal(resp["data"])
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid response data: %v", err)
+	}
+	return nil
+}
+
+// History prints a line per message of the session's last limit messages.
+func (c *Client) History(limit int) {
+	messages, err := c.GetHistory(limit)
+	if err != nil {
+		c.PrintError(err)
+		return
+	}
+
+	entries := make([]HistoryEntry, len(messages))
+	for i, m := range messages {
+		entries[i] = NewHistoryEntry(m)
+	}
+	switch c.Output {
+	case OutputJSON:
+		out, _ := json.MarshalIndent(entries, "", "  ")
+		fmt.Println(string(out))
+	case OutputMarkdown:
+		fmt.Print(renderHistoryMarkdown(entries))
+	default:
+		fmt.Print(renderHistory(entries))
+		if len(entries) > 0 && c.verbose() {
+			fmt.Printf("Run: `opencode_skill %s /show MESSAGE_ID` to read one in full.\n", c.fullSessionRef())
+		}
+	}
+}
+
+// Show prints one message in full.
+func (c *Client) Show(messageID string) {
+	message, err := c.GetMessage(messageID)
+	if err != nil {
+		c.PrintError(err)
+		return
+	}
+
+	switch c.Output {
+	case OutputJSON:
+		out, _ := json.MarshalIndent(message, "", "  ")
+		fmt.Println(string(out))
+	case OutputMarkdown:
+		fmt.Print(renderMessageMarkdown(*message))
+	default:
+		fmt.Print(renderMessage(*message))
+	}
+}
+
+func renderHistory(entries []HistoryEntry) string {
+	if len(entries) == 0 {
+		return "No messages.\n"
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, e := range entries {
+		summary := e.Summary
+		if e.Error != "" {
+			summary = strings.TrimSpace(summary + " [ERROR] " + e.Error)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, formatTime(e.Created), e.Role, e.Agent, e.Model, summary)
+	}
+	w.Flush()
+	return b.String()
+}
+
+func renderHistoryMarkdown(entries []HistoryEntry) string {
+	if len(entries) == 0 {
+		return "No messages.\n"
+	}
+
+	var b strings.Builder
+	b.WriteString("| ID | Time | Role | Agent | Model | Summary |\n")
+	b.WriteString("|----|------|------|-------|-------|---------|\n")
+	for _, e := range entries {
+		summary := escapeCell(e.Summary)
+		if e.Error != "" {
+			summary = strings.TrimSpace(summary + " **Error:** " + escapeCell(e.Error))
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s | %s |\n", e.ID, formatTime(e.Created), e.Role, e.Agent, e.Model, summary)
+	}
+	return b.String()
+}
+
+// renderMessage renders a message as a header line followed by what text
+// mode shows of a result.
+func renderMessage(m api.MessageWithParts) string {
+	header := messageHeader(NewHistoryEntry(m))
+	if m.Info.Assistant == nil {
+		return fmt.Sprintf("%s\n%s\n", header, m.Parts.Text())
+	}
+	return header + "\n" + renderText(messageResult(m))
+}
+
+func renderMessageMarkdown(m api.MessageWithParts) string {
+	e := NewHistoryEntry(m)
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s `%s`\n\n", strings.ToUpper(e.Role[:1])+e.Role[1:], e.ID)
+	fmt.Fprintf(&b, "%s\n\n", strings.Join(messageMeta(e), " · "))
+	if m.Info.Assistant == nil {
+		b.WriteString(m.Parts.Text())
+		b.WriteString("\n")
+		return b.String()
+	}
+	b.WriteString(renderMarkdown(messageResult(m)))
+	return b.String()
+}
+
+func messageResult(m api.MessageWithParts) Result {
+	r := Result{Tools: []ToolCall{}, Patches: []Patch{}}
+	r.setReply(&api.AssistantResponse{Info: *m.Info.Assistant, Parts: m.Parts})
+	return r
+}
+
+func messageHeader(e HistoryEntry) string {
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(e.Role), strings.Join(append([]string{e.ID}, messageMeta(e)...), "  "))
+}
+
+func messageMeta(e HistoryEntry) []string {
+	var meta []string
+	for _, s := range []string{e.Agent, e.Model, formatTime(e.Created)} {
+		if s != "" {
+			meta = append(meta, s)
+		}
+	}
+	return meta
+}
+
+// toolSummary names the tools of a reply without text, such as a shell
+// command's.
+func toolSummary(tools []*api.ToolPart) string {
+	if len(tools) == 0 {
+		return ""
+	}
+	names := make([]string, len(tools))
+	for i, t := range tools {
+		names[i] = t.Tool
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = strings.TrimSpace(s[:i]) + " …"
+	}
+	if r := []rune(s); len(r) > maxSummaryLen {
+		s = string(r[:maxSummaryLen-1]) + "…"
+	}
+	return s
+}
+
+func modelName(providerID, modelID string) string {
+	if providerID == "" {
+		return modelID
+	}
+	return providerID + "/" + modelID
+}
+
+// formatTime formats an OpenCode timestamp, in milliseconds, in local time.
+func formatTime(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).Format("2006-01-02 15:04")
+}
+
+func escapeCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
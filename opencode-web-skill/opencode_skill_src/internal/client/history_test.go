@@ -0,0 +1,108 @@
+package client
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"opencode_skill/internal/api"
+)
+
+func testHistory(t *testing.T) []api.MessageWithParts {
+	t.Helper()
+
+	var messages []api.MessageWithParts
+	err := json.Unmarshal([]byte(`[
+		{"info": {"id": "msg_1", "role": "user", "agent": "prometheus", "model": {"providerID": "zai", "modelID": "glm-5"}, "time": {"created": 1760000000000}},
+		 "parts": [{"type": "text", "text": "Plan the login page\nwith OAuth"}]},
+		{"info": {"id": "msg_2", "role": "assistant", "agent": "prometheus", "providerID": "zai", "modelID": "glm-5", "time": {"created": 1760000001000},
+		  "error": {"name": "APIError", "data": {"message": "rate limited"}}},
+		 "parts": [{"type": "text", "text": "1. Add the route"}]},
+		{"info": {"id": "msg_3", "role": "assistant", "mode": "build", "providerID": "zai", "modelID": "glm-5"},
+		 "parts": [{"type": "tool", "tool": "bash", "state": {"status": "completed", "input": {"command": "ls"}, "output": "main.go\n"}}]}
+	]`), &messages)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	return messages
+}
+
+func TestNewHistoryEntry(t *testing.T) {
+	t.Parallel()
+
+	messages := testHistory(t)
+	tests := []HistoryEntry{
+		{ID: "msg_1", Role: "user", Agent: "prometheus", Model: "zai/glm-5", Created: 1760000000000, Summary: "Plan the login page …"},
+		{ID: "msg_2", Role: "assistant", Agent: "prometheus", Model: "zai/glm-5", Created: 1760000001000, Summary: "1. Add the route", Error: "APIError: rate limited"},
+		{ID: "msg_3", Role: "assistant", Agent: "build", Model: "zai/glm-5", Summary: "(bash)"},
+	}
+	for i, want := range tests {
+		if got := NewHistoryEntry(messages[i]); got != want {
+			t.Errorf("NewHistoryEntry(%s) = %+v, want %+v", want.ID, got, want)
+		}
+	}
+}
+
+func TestRenderHistory(t *testing.T) {
+	t.Parallel()
+
+	var entries []HistoryEntry
+	for _, m := range testHistory(t) {
+		entries = append(entries, NewHistoryEntry(m))
+	}
+
+	lines := strings.Split(strings.TrimSuffix(renderHistory(entries), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a line per message, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[1], "msg_2  ") || !strings.HasSuffix(lines[1], "1. Add the route [ERROR] APIError: rate limited") {
+		t.Errorf("Unexpected line %q", lines[1])
+	}
+
+	markdown := renderHistoryMarkdown(entries)
+	if !strings.Contains(markdown, "| `msg_3` |  | assistant | build | zai/glm-5 | (bash) |") {
+		t.Errorf("Unexpected markdown:\n%s", markdown)
+	}
+
+	if got := renderHistory(nil); got != "No messages.\n" {
+		t.Errorf("renderHistory(nil) = %q", got)
+	}
+}
+
+func TestRenderMessage(t *testing.T) {
+	t.Parallel()
+
+	messages := testHistory(t)
+
+	if got := renderMessage(messages[0]); !strings.HasSuffix(got, "\nPlan the login page\nwith OAuth\n") {
+		t.Errorf("Expected the full user text, got %q", got)
+	}
+	if got := renderMessage(messages[2]); got != "[ASSISTANT] msg_3  build  zai/glm-5\nmain.go\n" {
+		t.Errorf("renderMessage() = %q", got)
+	}
+
+	markdown := renderMessageMarkdown(messages[1])
+	for _, want := range []string{"# Assistant `msg_2`", "## Response\n\n1. Add the route", "## Errors\n\n- APIError: rate limited"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Markdown missing %q:\n%s", want, markdown)
+		}
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"  one line  ", "one line"},
+		{"first\nsecond", "first …"},
+		{strings.Repeat("a", 100), strings.Repeat("a", maxSummaryLen-1) + "…"},
+	}
+	for _, tt := range tests {
+		if got := firstLine(tt.in); got != tt.want {
+			t.Errorf("firstLine(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
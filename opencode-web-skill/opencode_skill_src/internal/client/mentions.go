@@ -0,0 +1,156 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/types"
+)
+
+// mentionPattern matches an @word at the start of the text or after
+// whitespace. It does not consume what follows, so mentions separated by a
+// single space all match; mentionEnds checks that byte instead.
+var mentionPattern = regexp.MustCompile(`(?:^|\s)(@([A-Za-z][\w-]*))`)
+
+// mentionEnds reports whether a mention may end at text[end]: at the end of
+// the text, whitespace or punctuation, so e-mail addresses and paths such
+// as @types/node are left alone.
+func mentionEnds(text string, end int) bool {
+	return end == len(text) || strings.IndexByte(" \t\r\n.,;:!?", text[end]) >= 0
+}
+
+// AgentNames returns the names of the agents configured for the session's
+// project.
+func (c *Client) AgentNames() ([]string, error) {
+	var agents []api.Agent
+	if err := c.getData("LIST_AGENTS", nil, &agents); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(agents))
+	for i, a := range agents {
+		names[i] = a.Name
+	}
+	return names, nil
+}
+
+// HasMentions reports whether text has an @word that could name an agent,
+// i.e. whether AgentParts needs the agent list at all.
+func HasMentions(text string) bool {
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		if mentionEnds(text, m[3]) {
+			return true
+		}
+	}
+	return false
+}
+
+// AgentParts returns an agent part for each mention of one of agents in
+// text, which makes OpenCode hand the prompt to that agent as a subagent
+// task. Other @words, such as @param in prose, stay plain text.
+func AgentParts(text string, agents []string) []types.Part {
+	known := make(map[string]bool, len(agents))
+	for _, name := range agents {
+		known[name] = true
+	}
+
+	var parts []types.Part
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		name := text[m[4]:m[5]]
+		if !mentionEnds(text, m[3]) || !known[name] || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		parts = append(parts, types.Part{
+			Type: "agent",
+			Name: name,
+			Source: &types.PartSource{
+				Value: text[m[2]:m[3]],
+				Start: utf16Len(text[:m[2]]),
+				End:   utf16Len(text[:m[3]]),
+			},
+		})
+	}
+	return parts
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// ParseSubtask parses a --subtask value, agent:description:prompt, into a
+// subtask part. Fields may be double-quoted to contain colons; the prompt
+// is everything after the second separator.
+func ParseSubtask(value string) (types.Part, error) {
+	fields, err := splitQuoted(value, ':', 3)
+	if err != nil {
+		return types.Part{}, fmt.Errorf("invalid --subtask %q: %v", value, err)
+	}
+	if len(fields) != 3 || fields[0] == "" || fields[1] == "" || fields[2] == "" {
+		return types.Part{}, fmt.Errorf("invalid --subtask %q: want agent:\"description\":\"prompt\"", value)
+	}
+	return types.Part{
+		Type:        "subtask",
+		Agent:       strings.TrimPrefix(fields[0], "@"),
+		Description: fields[1],
+		Prompt:      fields[2],
+	}, nil
+}
+
+// splitQuoted splits s at sep into at most n fields. A field that starts
+// with a double quote runs to the matching quote, with \" and \\ escapes.
+// The last field is the rest of s, unquoted if it is one quoted string.
+func splitQuoted(s string, sep byte, n int) ([]string, error) {
+	var fields []string
+	for {
+		s = strings.TrimSpace(s)
+		last := len(fields) == n-1
+
+		if strings.HasPrefix(s, `"`) {
+			field, rest, err := unquote(s)
+			if err != nil && !last {
+				return nil, err
+			}
+			rest = strings.TrimSpace(rest)
+			switch {
+			case err == nil && rest == "":
+				return append(fields, field), nil
+			case err == nil && !last && rest[0] == sep:
+				fields = append(fields, field)
+				s = rest[1:]
+				continue
+			case !last:
+				return nil, fmt.Errorf("unexpected %q after a quoted field", rest)
+			}
+		}
+
+		end := strings.IndexByte(s, sep)
+		if last || end < 0 {
+			return append(fields, s), nil
+		}
+		fields = append(fields, strings.TrimSpace(s[:end]))
+		s = s[end+1:]
+	}
+}
+
+// unquote reads the double-quoted string at the start of s and returns it
+// with the rest of s.
+func unquote(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return "", "", fmt.Errorf("unterminated quote")
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"opencode_skill/internal/types"
+)
+
+func TestAgentParts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text string
+		want []types.Part
+	}{
+		{"@oracle review the auth flow", []types.Part{
+			{Type: "agent", Name: "oracle", Source: &types.PartSource{Value: "@oracle", Start: 0, End: 7}},
+		}},
+		{"Ask @explore, then @oracle: and @explore again", []types.Part{
+			{Type: "agent", Name: "explore", Source: &types.PartSource{Value: "@explore", Start: 4, End: 12}},
+			{Type: "agent", Name: "oracle", Source: &types.PartSource{Value: "@oracle", Start: 19, End: 26}},
+		}},
+		// Offsets count UTF-16 units, as in OpenCode
+		{"Überprüfe 🙂 @librarian", []types.Part{
+			{Type: "agent", Name: "librarian", Source: &types.PartSource{Value: "@librarian", Start: 13, End: 23}},
+		}},
+		{"@explore @oracle", []types.Part{
+			{Type: "agent", Name: "explore", Source: &types.PartSource{Value: "@explore", Start: 0, End: 8}},
+			{Type: "agent", Name: "oracle", Source: &types.PartSource{Value: "@oracle", Start: 9, End: 16}},
+		}},
+		{"mail me@example.com or install @types/node", nil},
+		{"Document @param and @returns for @oracle", []types.Part{
+			{Type: "agent", Name: "oracle", Source: &types.PartSource{Value: "@oracle", Start: 33, End: 40}},
+		}},
+		{"no mentions here", nil},
+	}
+
+	agents := []string{"explore", "oracle", "librarian", "sisyphus"}
+	for _, tt := range tests {
+		if got := AgentParts(tt.text, agents); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AgentParts(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHasMentions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"@oracle review the auth flow", true},
+		{"Document @param", true},
+		{"mail me@example.com or install @types/node", false},
+		{"no mentions here", false},
+	}
+
+	for _, tt := range tests {
+		if got := HasMentions(tt.text); got != tt.want {
+			t.Errorf("HasMentions(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseSubtask(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value                      string
+		agent, description, prompt string
+	}{
+		// As left by the shell for oracle:"Review auth":"Check the login flow"
+		{`oracle:Review auth:Check the login flow: all of it`, "oracle", "Review auth", "Check the login flow: all of it"},
+		{`oracle:"Review: auth":"Check \"login\""`, "oracle", "Review: auth", `Check "login"`},
+		{`@explore:"Find callers":"grep" for them`, "explore", "Find callers", `"grep" for them`},
+	}
+
+	for _, tt := range tests {
+		part, err := ParseSubtask(tt.value)
+		if err != nil {
+			t.Errorf("ParseSubtask(%q) failed: %v", tt.value, err)
+			continue
+		}
+		want := types.Part{Type: "subtask", Agent: tt.agent, Description: tt.description, Prompt: tt.prompt}
+		if part != want {
+			t.Errorf("ParseSubtask(%q) = %+v, want %+v", tt.value, part, want)
+		}
+	}
+
+	for _, value := range []string{"oracle", "oracle:desc", `oracle:"desc:prompt`, `oracle:"desc"x:prompt`, "::prompt"} {
+		if _, err := ParseSubtask(value); err == nil {
+			t.Errorf("ParseSubtask(%q) succeeded, want an error", value)
+		}
+	}
+}
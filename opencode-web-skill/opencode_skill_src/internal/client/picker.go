@@ -0,0 +1,298 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/types"
+)
+
+// errPickerCancelled is returned when the user leaves the picker with q or
+// Ctrl-C.
+var errPickerCancelled = errors.New("answer cancelled")
+
+type pickerKey int
+
+const (
+	keyOther pickerKey = iota
+	keyUp
+	keyDown
+	keyToggle
+	keyEnter
+	keyCancel
+)
+
+// AnswerInteractively lets the user answer a pending question request with
+// a terminal picker. args may hold --request <id>, as for ParseAnswers.
+func AnswerInteractively(questions []api.Question, args []string) (types.AnswerRequest, error) {
+	q, rest, err := selectRequest(questions, args)
+	if err != nil {
+		return types.AnswerRequest{}, err
+	}
+	if len(rest) > 0 {
+		return types.AnswerRequest{}, fmt.Errorf("unexpected arguments with -i: %s", strings.Join(rest, " "))
+	}
+	if !isTerminal(os.Stdin) {
+		return types.AnswerRequest{}, fmt.Errorf("-i needs a terminal; answer with /answer <option> ... instead")
+	}
+
+	restore, err := rawMode()
+	if err != nil {
+		return types.AnswerRequest{}, fmt.Errorf("cannot switch the terminal to raw mode: %v", err)
+	}
+	defer restore()
+
+	return pickAnswers(q, bufio.NewReader(os.Stdin), os.Stdout)
+}
+
+// pickAnswers runs the picker for each question of q in turn. The terminal
+// must already be in raw mode.
+func pickAnswers(q api.Question, in *bufio.Reader, out io.Writer) (types.AnswerRequest, error) {
+	fmt.Fprintf(out, "[?] Request ID: %s\r\n", q.ID)
+
+	answers := make([][]string, len(q.Questions))
+	for i, info := range q.Questions {
+		p := newPicker(info)
+		p.title = questionTitle(info, i, len(q.Questions))
+
+		labels, err := p.run(in, out)
+		if err != nil {
+			return types.AnswerRequest{}, err
+		}
+		answers[i] = labels
+	}
+
+	if err := q.CheckAnswers(answers); err != nil {
+		return types.AnswerRequest{}, err
+	}
+	return types.AnswerRequest{RequestID: q.ID, Answers: answers}, nil
+}
+
+func questionTitle(info api.QuestionInfo, index, total int) string {
+	title := info.Question
+	if info.Header != "" {
+		title = fmt.Sprintf("[%s] %s", info.Header, title)
+	}
+	if total > 1 {
+		title = fmt.Sprintf("%d. %s", index+1, title)
+	}
+	return title
+}
+
+// picker selects the answer to one question. The last item is a free-text
+// entry when the question accepts custom answers.
+type picker struct {
+	info     api.QuestionInfo
+	title    string
+	items    []string
+	custom   bool
+	cursor   int
+	selected map[int]bool
+	drawn    int
+}
+
+func newPicker(info api.QuestionInfo) *picker {
+	p := &picker{info: info, selected: map[int]bool{}}
+	for _, o := range info.Options {
+		item := o.Label
+		if o.Description != "" {
+			item += " - " + o.Description
+		}
+		p.items = append(p.items, item)
+	}
+	if info.AllowsCustom() {
+		p.custom = true
+		p.items = append(p.items, "Type your own answer")
+	}
+	return p
+}
+
+func (p *picker) run(in *bufio.Reader, out io.Writer) ([]string, error) {
+	if len(p.items) == 0 {
+		return nil, fmt.Errorf("%q has no options and takes no custom answer", p.info.Question)
+	}
+	for {
+		p.draw(out)
+
+		key, r, err := readKey(in)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case keyUp:
+			p.cursor = (p.cursor + len(p.items) - 1) % len(p.items)
+		case keyDown:
+			p.cursor = (p.cursor + 1) % len(p.items)
+		case keyToggle:
+			if p.info.Multiple && !p.onCustom() {
+				p.selected[p.cursor] = !p.selected[p.cursor]
+			}
+		case keyCancel:
+			return nil, errPickerCancelled
+		case keyOther:
+			// Digits jump to an option
+			if n := int(r - '1'); r >= '1' && r <= '9' && n < len(p.items) {
+				p.cursor = n
+			}
+		case keyEnter:
+			labels := p.labels()
+			if p.onCustom() {
+				fmt.Fprint(out, "  Your answer: ")
+				text, err := readLine(in, out)
+				if err != nil {
+					return nil, err
+				}
+				if text == "" {
+					// Redraw over the prompt line too
+					p.drawn++
+					continue
+				}
+				labels = append(labels, text)
+			} else if len(labels) == 0 {
+				labels = []string{p.info.Options[p.cursor].Label}
+			}
+			fmt.Fprintf(out, "  -> %s\r\n", strings.Join(labels, ", "))
+			return labels, nil
+		}
+	}
+}
+
+func (p *picker) onCustom() bool {
+	return p.custom && p.cursor == len(p.items)-1
+}
+
+// labels returns the labels of the selected options, in option order.
+func (p *picker) labels() []string {
+	var labels []string
+	for i, o := range p.info.Options {
+		if p.selected[i] {
+			labels = append(labels, o.Label)
+		}
+	}
+	return labels
+}
+
+// draw renders the picker, replacing its previous rendering.
+func (p *picker) draw(out io.Writer) {
+	if p.drawn > 0 {
+		fmt.Fprintf(out, "\x1b[%dA\r\x1b[J", p.drawn)
+	}
+
+	lines := []string{p.title}
+	for i, item := range p.items {
+		cursor := "  "
+		if i == p.cursor {
+			cursor = "> "
+		}
+		box := ""
+		if p.info.Multiple && !(p.custom && i == len(p.items)-1) {
+			box = "[ ] "
+			if p.selected[i] {
+				box = "[x] "
+			}
+		}
+		lines = append(lines, fmt.Sprintf("  %s%s%d. %s", cursor, box, i+1, item))
+	}
+	help := "up/down move, enter confirm, q cancel"
+	if p.info.Multiple {
+		help = "up/down move, space select, enter confirm, q cancel"
+	}
+	lines = append(lines, "  ("+help+")")
+
+	for _, line := range lines {
+		fmt.Fprint(out, line, "\r\n")
+	}
+	p.drawn = len(lines)
+}
+
+// readKey reads one key press from a raw-mode terminal.
+func readKey(in *bufio.Reader) (pickerKey, rune, error) {
+	r, _, err := in.ReadRune()
+	if err != nil {
+		return keyOther, 0, err
+	}
+	switch r {
+	case '\r', '\n':
+		return keyEnter, r, nil
+	case ' ':
+		return keyToggle, r, nil
+	case 'k':
+		return keyUp, r, nil
+	case 'j':
+		return keyDown, r, nil
+	case 'q', 3: // Ctrl-C
+		return keyCancel, r, nil
+	case 0x1b:
+		// Arrow keys arrive as ESC [ A / ESC [ B
+		if next, _, err := in.ReadRune(); err != nil || next != '[' {
+			return keyOther, r, err
+		}
+		code, _, err := in.ReadRune()
+		switch code {
+		case 'A':
+			return keyUp, r, err
+		case 'B':
+			return keyDown, r, err
+		}
+		return keyOther, r, err
+	}
+	return keyOther, r, nil
+}
+
+// readLine reads a line of text from a raw-mode terminal, echoing it and
+// handling backspace.
+func readLine(in *bufio.Reader, out io.Writer) (string, error) {
+	var text []rune
+	for {
+		r, _, err := in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case r == '\r' || r == '\n':
+			fmt.Fprint(out, "\r\n")
+			return strings.TrimSpace(string(text)), nil
+		case r == 3: // Ctrl-C
+			return "", errPickerCancelled
+		case r == 0x7f || r == '\b':
+			if len(text) > 0 {
+				text = text[:len(text)-1]
+				fmt.Fprint(out, "\b \b")
+			}
+		case r >= ' ':
+			text = append(text, r)
+			fmt.Fprint(out, string(r))
+		}
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// rawMode puts the terminal on stdin into raw mode with stty and returns a
+// function restoring the previous settings.
+func rawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
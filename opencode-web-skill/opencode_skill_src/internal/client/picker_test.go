@@ -0,0 +1,55 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"opencode_skill/internal/api"
+)
+
+func TestPickAnswers(t *testing.T) {
+	t.Parallel()
+
+	no := false
+	q := api.Question{ID: "que_1", Questions: []api.QuestionInfo{
+		{Question: "Which database?", Header: "DB", Options: []api.Option{{Label: "Postgres"}, {Label: "SQLite", Description: "file based"}}, Custom: &no},
+		{Question: "Which caches?", Options: []api.Option{{Label: "Redis"}, {Label: "Memcached"}, {Label: "None"}}, Multiple: true},
+		{Question: "Anything else?", Options: []api.Option{{Label: "No"}}},
+	}}
+
+	input := strings.Join([]string{
+		"\x1b[B\r",          // down to SQLite, confirm
+		" jj \x1b[A\x1b[A ", // select Redis and None, then unselect Redis
+		"j \r",              // select Memcached, confirm
+		"2\rok\x7fK\r",      // jump to the custom entry and type "oK"
+	}, "")
+
+	var out bytes.Buffer
+	req, err := pickAnswers(q, bufio.NewReader(strings.NewReader(input)), &out)
+	if err != nil {
+		t.Fatalf("pickAnswers failed: %v", err)
+	}
+
+	want := [][]string{{"SQLite"}, {"Memcached", "None"}, {"oK"}}
+	if req.RequestID != "que_1" || !reflect.DeepEqual(req.Answers, want) {
+		t.Errorf("Got %s %v, want que_1 %v", req.RequestID, req.Answers, want)
+	}
+	for _, s := range []string{"1. [DB] Which database?", "2. SQLite - file based", "[x] 2. Memcached", "2. Type your own answer", "-> Memcached, None"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Expected %q in picker output:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestPickAnswers_Cancel(t *testing.T) {
+	t.Parallel()
+
+	q := api.Question{ID: "que_1", Questions: []api.QuestionInfo{{Question: "Proceed?", Options: []api.Option{{Label: "Yes"}}}}}
+	_, err := pickAnswers(q, bufio.NewReader(strings.NewReader("jq")), &bytes.Buffer{})
+	if err != errPickerCancelled {
+		t.Errorf("Expected errPickerCancelled, got %v", err)
+	}
+}
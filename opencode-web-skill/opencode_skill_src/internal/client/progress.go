@@ -0,0 +1,150 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"opencode_skill/internal/api"
+)
+
+// maxProgressTitle caps the tool summary printed on a progress line.
+const maxProgressTitle = 80
+
+// progressPrinter prints the progress events relayed by the daemon during
+// `/wait --follow`: assistant text as it streams, tool calls as their status
+// changes, step boundaries, todo counts and retries. In JSON mode each event
+// is printed as is, one per line.
+type progressPrinter struct {
+	out  io.Writer
+	json bool
+
+	// printed is how much of each text part has been printed. Only parts
+	// that received a delta are streamed, which leaves out the user's prompt.
+	printed map[string]int
+	tools   map[string]string
+	midLine bool
+}
+
+func newProgressPrinter(out io.Writer, jsonLines bool) *progressPrinter {
+	return &progressPrinter{
+		out:     out,
+		json:    jsonLines,
+		printed: make(map[string]int),
+		tools:   make(map[string]string),
+	}
+}
+
+// handle prints one progress event, given as the generically decoded "data"
+// of a progress frame.
+func (p *progressPrinter) handle(data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	var ev api.Event
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return
+	}
+
+	if p.json {
+		line, _ := json.Marshal(ev)
+		fmt.Fprintln(p.out, string(line))
+		return
+	}
+
+	switch ev.Type {
+	case "message.part.updated":
+		var upd api.PartUpdated
+		if err := json.Unmarshal(ev.Properties, &upd); err == nil {
+			p.part(upd)
+		}
+	case "todo.updated":
+		var upd api.TodoUpdated
+		if err := json.Unmarshal(ev.Properties, &upd); err == nil {
+			p.line("[todo] %s", todoSummary(upd.Todos))
+		}
+	case "session.status":
+		var upd api.SessionStatusChanged
+		if err := json.Unmarshal(ev.Properties, &upd); err == nil && upd.Status.Type == "retry" {
+			p.line("[retry] attempt %d: %s", upd.Status.Attempt, upd.Status.Message)
+		}
+	}
+}
+
+func (p *progressPrinter) part(upd api.PartUpdated) {
+	switch part := upd.Part.(type) {
+	case *api.TextPart:
+		done, started := p.printed[part.ID]
+		if part.Synthetic || (!started && upd.Delta == "") || done >= len(part.Text) {
+			return
+		}
+		fmt.Fprint(p.out, part.Text[done:])
+		p.printed[part.ID] = len(part.Text)
+		p.midLine = !strings.HasSuffix(part.Text, "\n")
+
+	case *api.ToolPart:
+		status := part.State.Status
+		if status == api.ToolStatusPending || p.tools[part.ID] == status {
+			return
+		}
+		p.tools[part.ID] = status
+
+		title := part.State.Title
+		if title == "" {
+			title = summarizeInput(part.State.Input)
+		}
+		if len(title) > maxProgressTitle {
+			title = title[:maxProgressTitle] + "..."
+		}
+		if status == api.ToolStatusError {
+			p.line("[tool] %s error: %s", part.Tool, part.State.Error)
+		} else {
+			p.line("[tool] %s %s: %s", part.Tool, status, title)
+		}
+
+	case *api.StepStartPart:
+		p.line("[step] started")
+
+	case *api.StepFinishPart:
+		p.line("[step] finished (%s, %d tokens out)", part.Reason, part.Tokens.Output)
+	}
+}
+
+// line prints a progress line, first ending any text being streamed.
+func (p *progressPrinter) line(format string, args ...interface{}) {
+	p.flush()
+	fmt.Fprintf(p.out, format+"\n", args...)
+}
+
+// flush ends a partially printed line of streamed text.
+func (p *progressPrinter) flush() {
+	if p.midLine {
+		fmt.Fprintln(p.out)
+		p.midLine = false
+	}
+}
+
+// todoSummary renders a todo list as "3/7 completed", followed by the task
+// in progress, if any.
+func todoSummary(todos []api.Todo) string {
+	completed := 0
+	current := ""
+	for _, t := range todos {
+		switch t.Status {
+		case "completed":
+			completed++
+		case "in_progress":
+			if current == "" {
+				current = t.Content
+			}
+		}
+	}
+
+	summary := fmt.Sprintf("%d/%d completed", completed, len(todos))
+	if current != "" {
+		summary += "; in progress: " + current
+	}
+	return summary
+}
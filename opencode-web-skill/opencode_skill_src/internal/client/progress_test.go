@@ -0,0 +1,71 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func progressEvent(t *testing.T, raw string) interface{} {
+	t.Helper()
+	var data interface{}
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestProgressPrinter(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	p := newProgressPrinter(&out, false)
+
+	events := []string{
+		// The user's prompt arrives without a delta and is not echoed
+		`{"type":"message.part.updated","properties":{"part":{"id":"prt_u","type":"text","text":"Fix it"}}}`,
+		`{"type":"message.part.updated","properties":{"part":{"id":"prt_s","type":"step-start"}}}`,
+		`{"type":"message.part.updated","properties":{"part":{"id":"prt_t","type":"text","text":"Look"},"delta":"Look"}}`,
+		// A missed delta is caught up from the full text
+		`{"type":"message.part.updated","properties":{"part":{"id":"prt_t","type":"text","text":"Looking at it"},"delta":" it"}}`,
+		`{"type":"message.part.updated","properties":{"part":{"id":"prt_b","type":"tool","tool":"bash","state":{"status":"pending"}}}}`,
+		`{"type":"message.part.updated","properties":{"part":{"id":"prt_b","type":"tool","tool":"bash","state":{"status":"running","title":"go test ./..."}}}}`,
+		`{"type":"message.part.updated","properties":{"part":{"id":"prt_b","type":"tool","tool":"bash","state":{"status":"running","title":"go test ./..."}}}}`,
+		`{"type":"message.part.updated","properties":{"part":{"id":"prt_b","type":"tool","tool":"bash","state":{"status":"completed","title":"go test ./..."}}}}`,
+		`{"type":"todo.updated","properties":{"sessionID":"ses_1","todos":[{"id":"1","content":"a","status":"completed"},{"id":"2","content":"b","status":"in_progress"},{"id":"3","content":"c","status":"pending"}]}}`,
+		`{"type":"session.status","properties":{"sessionID":"ses_1","status":{"type":"busy"}}}`,
+		`{"type":"session.status","properties":{"sessionID":"ses_1","status":{"type":"retry","attempt":2,"message":"rate limited","next":0}}}`,
+		`{"type":"message.part.updated","properties":{"part":{"id":"prt_f","type":"step-finish","reason":"stop","cost":0,"tokens":{"input":1,"output":42,"reasoning":0,"cache":{"read":0,"write":0}}}}}`,
+	}
+	for _, raw := range events {
+		p.handle(progressEvent(t, raw))
+	}
+	p.flush()
+
+	want := strings.Join([]string{
+		"[step] started",
+		"Looking at it",
+		"[tool] bash running: go test ./...",
+		"[tool] bash completed: go test ./...",
+		"[todo] 1/3 completed; in progress: b",
+		"[retry] attempt 2: rate limited",
+		"[step] finished (stop, 42 tokens out)",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("progress output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestProgressPrinter_JSON(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	p := newProgressPrinter(&out, true)
+	p.handle(progressEvent(t, `{"type":"todo.updated","properties":{"sessionID":"ses_1","todos":[]}}`))
+
+	if got := out.String(); got != `{"type":"todo.updated","properties":{"sessionID":"ses_1","todos":[]}}`+"\n" {
+		t.Errorf("JSON progress line = %q", got)
+	}
+}
@@ -0,0 +1,341 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/manager"
+)
+
+// OutputMode selects how results are printed by WaitForResult and Status.
+type OutputMode string
+
+const (
+	// OutputText prints only the assistant's final text.
+	OutputText OutputMode = "text"
+	// OutputMarkdown also renders tool calls, patches and errors as sections.
+	OutputMarkdown OutputMode = "markdown"
+	// OutputJSON prints a Result document.
+	OutputJSON OutputMode = "json"
+)
+
+// maxToolOutputLines caps how much of a tool's output markdown mode shows.
+const maxToolOutputLines = 20
+
+func ParseOutputMode(s string) (OutputMode, error) {
+	switch mode := OutputMode(strings.ToLower(s)); mode {
+	case OutputText, OutputMarkdown, OutputJSON:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown output mode %q (want text, markdown or json)", s)
+}
+
+// Result is the document printed with --output json. Fields are only ever
+// added, so callers can rely on the existing ones.
+type Result struct {
+	State       string                  `json:"state"`
+	SessionID   string                  `json:"session_id"`
+	Status      string                  `json:"status,omitempty"`
+	Text        string                  `json:"text"`
+	Error       string                  `json:"error,omitempty"`
+	Tools       []ToolCall              `json:"tools"`
+	Patches     []Patch                 `json:"patches"`
+	Diff        []api.FileDiff          `json:"diff"`
+	Questions   []api.Question          `json:"questions"`
+	Permissions []api.PermissionRequest `json:"permissions"`
+	Todos       []api.Todo              `json:"todos"`
+	Context     *manager.ContextUsage   `json:"context,omitempty"`
+	Revert      *api.SessionRevert      `json:"revert,omitempty"`
+	Tokens      *api.Tokens             `json:"tokens,omitempty"`
+	Cost        float64                 `json:"cost"`
+}
+
+// ErrorResult is printed in place of a Result with --output json when a
+// command fails or times out, so the output always parses.
+type ErrorResult struct {
+	Error   string `json:"error"`
+	Timeout bool   `json:"timeout,omitempty"`
+}
+
+// PrintError reports a failed command: as an ErrorResult with --output json,
+// otherwise as an "Error:" line.
+func (c *Client) PrintError(err interface{}) {
+	if c.Output == OutputJSON {
+		printErrorResult(ErrorResult{Error: fmt.Sprint(err)})
+		return
+	}
+	fmt.Printf("Error: %v\n", err)
+}
+
+func printErrorResult(res ErrorResult) {
+	out, _ := json.MarshalIndent(res, "", "  ")
+	fmt.Println(string(out))
+}
+
+// ToolCall is one tool invocation of the assistant's reply.
+type ToolCall struct {
+	Tool   string                 `json:"tool"`
+	Status string                 `json:"status"`
+	Title  string                 `json:"title,omitempty"`
+	Input  map[string]interface{} `json:"input,omitempty"`
+	Output string                 `json:"output,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// Patch lists the files changed by one step of the assistant's reply.
+type Patch struct {
+	Hash  string   `json:"hash"`
+	Files []string `json:"files"`
+}
+
+// NewResult flattens a status snapshot into a Result.
+func NewResult(snap *manager.Snapshot) Result {
+	r := Result{
+		State:       string(snap.State),
+		SessionID:   snap.SessionID,
+		Tools:       []ToolCall{},
+		Patches:     []Patch{},
+		Diff:        []api.FileDiff{},
+		Questions:   snap.Questions,
+		Permissions: snap.Permissions,
+		Todos:       snap.Todos,
+		Context:     snap.Context,
+		Revert:      snap.Revert,
+	}
+	if r.Questions == nil {
+		r.Questions = []api.Question{}
+	}
+	if r.Permissions == nil {
+		r.Permissions = []api.PermissionRequest{}
+	}
+	if r.Todos == nil {
+		r.Todos = []api.Todo{}
+	}
+
+	resp := snap.LatestResponse
+	if resp == nil {
+		return r
+	}
+	r.Status = resp.Status
+	r.Error = resp.Error
+	if resp.Diff != nil {
+		r.Diff = resp.Diff
+	}
+	if resp.Result != nil {
+		r.setReply(resp.Result)
+	}
+	return r
+}
+
+// setReply fills in the text, tool calls, patches and usage of an assistant
+// reply.
+func (r *Result) setReply(res *api.AssistantResponse) {
+	info := res.Info
+	r.Text = res.Text()
+	if info.Error != nil && r.Error == "" {
+		r.Error = info.Error.Error()
+	}
+	tokens := info.Tokens
+	r.Tokens = &tokens
+	r.Cost = info.Cost
+
+	for _, part := range res.Parts {
+		switch p := part.(type) {
+		case *api.ToolPart:
+			r.Tools = append(r.Tools, ToolCall{
+				Tool:   p.Tool,
+				Status: p.State.Status,
+				Title:  p.State.Title,
+				Input:  p.State.Input,
+				Output: p.State.Output,
+				Error:  p.State.Error,
+			})
+		case *api.PatchPart:
+			r.Patches = append(r.Patches, Patch{Hash: p.Hash, Files: p.Files})
+		}
+	}
+}
+
+// printSnapshot prints a finished snapshot in the client's output mode.
+func (c *Client) printSnapshot(snap *manager.Snapshot) {
+	switch c.Output {
+	case OutputJSON:
+		out, _ := json.MarshalIndent(NewResult(snap), "", "  ")
+		fmt.Println(string(out))
+	case OutputMarkdown:
+		if c.printPending(snap) {
+			return
+		}
+		fmt.Print(renderMarkdown(NewResult(snap)))
+	default:
+		if c.printPending(snap) {
+			return
+		}
+		r := NewResult(snap)
+		fmt.Print(renderText(r))
+		if len(r.Diff) > 0 && c.verbose() {
+			fmt.Printf("\n[CHANGES]\n%s", RenderDiffStat(r.Diff, useColor()))
+			fmt.Printf("Run: `opencode_skill %s /diff %s` to review them.\n", c.fullSessionRef(), snap.LatestResponse.Result.Info.ParentID)
+		}
+	}
+}
+
+// printPending prints what the session is waiting on, if anything.
+func (c *Client) printPending(snap *manager.Snapshot) bool {
+	if len(snap.Questions) > 0 {
+		c.printQuestions(snap.Questions)
+		return true
+	}
+	if len(snap.Permissions) > 0 {
+		c.printPermissions(snap.Permissions)
+		return true
+	}
+	return false
+}
+
+func renderText(r Result) string {
+	switch {
+	case r.Error != "":
+		return fmt.Sprintf("Error: %s\n", r.Error)
+	case r.Status == "aborted":
+		return "Task aborted.\n"
+	case r.Status == "compacted":
+		return "Session compacted.\n"
+	case r.Text == "":
+		if out := toolOutputs(r.Tools); out != "" {
+			return out
+		}
+		return "(no text response)\n"
+	}
+	return r.Text + "\n"
+}
+
+// toolOutputs joins the output of a reply's tool calls, which is all a
+// shell command's reply has to show.
+func toolOutputs(tools []ToolCall) string {
+	var b strings.Builder
+	for _, t := range tools {
+		if t.Output == "" {
+			continue
+		}
+		b.WriteString(t.Output)
+		if !strings.HasSuffix(t.Output, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func renderMarkdown(r Result) string {
+	var b strings.Builder
+
+	if r.Status == "aborted" {
+		b.WriteString("## Aborted\n\nTask aborted by user.\n")
+		return b.String()
+	}
+	if r.Status == "compacted" {
+		b.WriteString("## Compacted\n\nThe conversation so far was replaced by a summary.\n")
+		return b.String()
+	}
+
+	if r.Text != "" {
+		b.WriteString("## Response\n\n")
+		b.WriteString(r.Text)
+		b.WriteString("\n")
+	}
+
+	if len(r.Tools) > 0 {
+		b.WriteString("\n## Tool Calls\n\n")
+		for _, t := range r.Tools {
+			title := t.Title
+			if title == "" {
+				title = summarizeInput(t.Input)
+			}
+			fmt.Fprintf(&b, "- **%s** (%s)", t.Tool, t.Status)
+			if title != "" {
+				fmt.Fprintf(&b, ": %s", title)
+			}
+			b.WriteString("\n")
+			if t.Output != "" {
+				b.WriteString(indentBlock(truncateLines(t.Output, maxToolOutputLines)))
+			}
+		}
+	}
+
+	if len(r.Patches) > 0 {
+		b.WriteString("\n## Patches\n\n")
+		for _, p := range r.Patches {
+			fmt.Fprintf(&b, "- `%s`: %s\n", shortHash(p.Hash), strings.Join(p.Files, ", "))
+		}
+	}
+
+	if len(r.Diff) > 0 {
+		b.WriteString("\n## Changes\n\n```text\n")
+		b.WriteString(RenderDiffStat(r.Diff, false))
+		b.WriteString("```\n")
+	}
+
+	var errs []string
+	if r.Error != "" {
+		errs = append(errs, r.Error)
+	}
+	for _, t := range r.Tools {
+		if t.Error != "" {
+			errs = append(errs, fmt.Sprintf("%s: %s", t.Tool, t.Error))
+		}
+	}
+	if len(errs) > 0 {
+		b.WriteString("\n## Errors\n\n")
+		for _, e := range errs {
+			fmt.Fprintf(&b, "- %s\n", e)
+		}
+	}
+
+	if b.Len() == 0 {
+		b.WriteString("(no response)\n")
+	}
+	return b.String()
+}
+
+// summarizeInput renders tool input as "key=value" pairs in key order.
+func summarizeInput(input map[string]interface{}) string {
+	keys := make([]string, 0, len(input))
+	for k := range input {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, input[k]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+func truncateLines(s string, max int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) <= max {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines[:max], "\n") + fmt.Sprintf("\n... (%d more lines)", len(lines)-max)
+}
+
+func indentBlock(s string) string {
+	return "  ```\n  " + strings.ReplaceAll(s, "\n", "\n  ") + "\n  ```\n"
+}
+
+// contextSummary renders context usage as "45% used (90000 of 200000
+// tokens)".
+func contextSummary(u *manager.ContextUsage) string {
+	return fmt.Sprintf("%d%% used (%d of %d tokens)", u.Tokens*100/u.Limit, u.Tokens, u.Limit)
+}
+
+func shortHash(h string) string {
+	if len(h) > 8 {
+		return h[:8]
+	}
+	return h
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/manager"
+)
+
+func testSnapshot(t *testing.T) *manager.Snapshot {
+	t.Helper()
+
+	raw := `{
+		"info": {"id": "msg_1", "role": "assistant", "cost": 0.5, "tokens": {"input": 10, "output": 4, "reasoning": 0, "cache": {"read": 0, "write": 0}}},
+		"parts": [
+			{"type": "step-start"},
+			{"type": "tool", "tool": "bash", "state": {"status": "completed", "title": "go test ./...", "output": "ok\tpkg"}},
+			{"type": "tool", "tool": "read", "state": {"status": "error", "input": {"filePath": "missing.go"}, "error": "no such file"}},
+			{"type": "patch", "hash": "0123456789abcdef", "files": ["a.go", "b.go"]},
+			{"type": "text", "text": "Done."}
+		]
+	}`
+	var result api.AssistantResponse
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		t.Fatal(err)
+	}
+	return &manager.Snapshot{
+		State:          manager.StateIdle,
+		SessionID:      "ses_1",
+		LatestResponse: &manager.Response{Result: &result},
+	}
+}
+
+func TestParseOutputMode(t *testing.T) {
+	t.Parallel()
+
+	for _, in := range []string{"text", "markdown", "JSON"} {
+		if _, err := ParseOutputMode(in); err != nil {
+			t.Errorf("ParseOutputMode(%q) error = %v", in, err)
+		}
+	}
+	if _, err := ParseOutputMode("yaml"); err == nil {
+		t.Error("ParseOutputMode(yaml) expected an error")
+	}
+}
+
+func TestNewResult(t *testing.T) {
+	t.Parallel()
+
+	r := NewResult(testSnapshot(t))
+
+	if r.Text != "Done." {
+		t.Errorf("Text = %q, want %q", r.Text, "Done.")
+	}
+	if len(r.Tools) != 2 || r.Tools[0].Tool != "bash" || r.Tools[1].Error != "no such file" {
+		t.Errorf("unexpected tools: %+v", r.Tools)
+	}
+	if len(r.Patches) != 1 || len(r.Patches[0].Files) != 2 {
+		t.Errorf("unexpected patches: %+v", r.Patches)
+	}
+	if r.Tokens == nil || r.Tokens.Output != 4 || r.Cost != 0.5 {
+		t.Errorf("unexpected usage: tokens=%+v cost=%v", r.Tokens, r.Cost)
+	}
+
+	empty := NewResult(&manager.Snapshot{State: manager.StateBusy})
+	data, _ := json.Marshal(empty)
+	for _, field := range []string{`"tools":[]`, `"patches":[]`, `"questions":[]`, `"text":""`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("empty result %s missing %s", data, field)
+		}
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	t.Parallel()
+
+	if got := renderText(NewResult(testSnapshot(t))); got != "Done.\n" {
+		t.Errorf("renderText() = %q, want %q", got, "Done.\n")
+	}
+
+	failed := &manager.Snapshot{State: manager.StateIdle, LatestResponse: &manager.Response{Error: "boom"}}
+	if got := renderText(NewResult(failed)); got != "Error: boom\n" {
+		t.Errorf("renderText() = %q, want %q", got, "Error: boom\n")
+	}
+
+	shell := NewResult(&manager.Snapshot{State: manager.StateIdle})
+	shell.Tools = []ToolCall{{Tool: "bash", Output: "a.go\nb.go"}}
+	if got := renderText(shell); got != "a.go\nb.go\n" {
+		t.Errorf("renderText() = %q, want the tool output", got)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	t.Parallel()
+
+	got := renderMarkdown(NewResult(testSnapshot(t)))
+
+	for _, want := range []string{
+		"## Response\n\nDone.",
+		"- **bash** (completed): go test ./...",
+		"- **read** (error): filePath=missing.go",
+		"- `01234567`: a.go, b.go",
+		"## Errors\n\n- read: no such file",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("renderMarkdown() missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	t.Parallel()
+
+	got := truncateLines("1\n2\n3\n4\n", 2)
+	if got != "1\n2\n... (2 more lines)" {
+		t.Errorf("truncateLines() = %q", got)
+	}
+}
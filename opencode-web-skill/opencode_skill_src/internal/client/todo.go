@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"opencode_skill/internal/api"
+)
+
+// todoMarks are the checkboxes of the todo statuses in text output.
+var todoMarks = map[string]string{
+	"completed":   "[x]",
+	"in_progress": "[>]",
+	"cancelled":   "[-]",
+}
+
+// Todo prints the agent's todo list with its progress.
+func (c *Client) Todo() {
+	snap, err := c.GetStatus()
+	if err != nil {
+		c.PrintError(err)
+		return
+	}
+
+	todos := snap.Todos
+	if todos == nil {
+		todos = []api.Todo{}
+	}
+	switch c.Output {
+	case OutputJSON:
+		out, _ := json.MarshalIndent(todos, "", "  ")
+		fmt.Println(string(out))
+	case OutputMarkdown:
+		fmt.Print(renderTodosMarkdown(todos))
+	default:
+		fmt.Print(renderTodos(todos))
+	}
+}
+
+func renderTodos(todos []api.Todo) string {
+	if len(todos) == 0 {
+		return "No todo list.\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[TODO] %s\n", todoSummary(todos))
+	for _, t := range todos {
+		mark, ok := todoMarks[t.Status]
+		if !ok {
+			mark = "[ ]"
+		}
+		fmt.Fprintf(&b, "  %s %s", mark, t.Content)
+		if t.Priority != "" {
+			fmt.Fprintf(&b, " (%s)", t.Priority)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func renderTodosMarkdown(todos []api.Todo) string {
+	if len(todos) == 0 {
+		return "No todo list.\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Todo\n\n%s\n\n", todoSummary(todos))
+	for _, t := range todos {
+		box := "[ ]"
+		if t.Status == "completed" {
+			box = "[x]"
+		}
+		content := t.Content
+		switch t.Status {
+		case "in_progress":
+			content = "**" + content + "** (in progress)"
+		case "cancelled":
+			content = "~~" + content + "~~"
+		}
+		fmt.Fprintf(&b, "- %s %s", box, content)
+		if t.Priority != "" {
+			fmt.Fprintf(&b, " _%s_", t.Priority)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
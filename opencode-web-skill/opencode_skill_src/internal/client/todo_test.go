@@ -0,0 +1,40 @@
+package client
+
+import (
+	"testing"
+
+	"opencode_skill/internal/api"
+)
+
+func TestRenderTodos(t *testing.T) {
+	t.Parallel()
+
+	todos := []api.Todo{
+		{Content: "Write tests", Status: "completed", Priority: "high"},
+		{Content: "Update docs", Status: "in_progress", Priority: "medium"},
+		{Content: "Ship it", Status: "pending", Priority: "low"},
+		{Content: "Rewrite in Rust", Status: "cancelled"},
+	}
+
+	want := "[TODO] 1/4 completed; in progress: Update docs\n" +
+		"  [x] Write tests (high)\n" +
+		"  [>] Update docs (medium)\n" +
+		"  [ ] Ship it (low)\n" +
+		"  [-] Rewrite in Rust\n"
+	if got := renderTodos(todos); got != want {
+		t.Errorf("renderTodos() =\n%s\nwant:\n%s", got, want)
+	}
+
+	wantMarkdown := "## Todo\n\n1/4 completed; in progress: Update docs\n\n" +
+		"- [x] Write tests _high_\n" +
+		"- [ ] **Update docs** (in progress) _medium_\n" +
+		"- [ ] Ship it _low_\n" +
+		"- [ ] ~~Rewrite in Rust~~\n"
+	if got := renderTodosMarkdown(todos); got != wantMarkdown {
+		t.Errorf("renderTodosMarkdown() =\n%s\nwant:\n%s", got, wantMarkdown)
+	}
+
+	if got := renderTodos(nil); got != "No todo list.\n" {
+		t.Errorf("renderTodos(nil) = %q", got)
+	}
+}
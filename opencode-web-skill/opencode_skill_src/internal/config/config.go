@@ -15,15 +15,28 @@ const (
 
 // Daemon Configuration
 const (
-	DaemonHost = "127.0.0.1"
-	DaemonPort = 44111
+	DaemonHost     = "127.0.0.1"
+	DaemonPort     = 44111
+	DaemonHTTPPort = 44112
 )
 
 // Timing
 const (
-	PollInterval   = 2 * time.Second
-	ClientTimeout  = 10 * time.Minute
-	AutoFixTimeout = 15 * time.Minute
+	PollInterval       = 2 * time.Second
+	StatusPollInterval = 5 * time.Second // while the event stream is down
+	ClientTimeout      = 10 * time.Minute
+	AutoFixTimeout     = 15 * time.Minute
+)
+
+// Attachments
+const (
+	MaxFileSize       = 10 << 20 // per --file/--glob file
+	MaxAttachmentSize = 25 << 20 // all files of one prompt
+)
+
+// History
+const (
+	DefaultHistoryLimit = 20 // messages listed by /history without --limit
 )
 
 // Paths
@@ -31,7 +44,9 @@ var (
 	ProjectRoot    string
 	WrapperDir     string
 	PidFile        string
+	SocketFile     string
 	SessionMapFile string
+	HTTPTokenFile  string
 )
 
 func init() {
@@ -49,7 +64,9 @@ func init() {
 	}
 
 	PidFile = filepath.Join(WrapperDir, "daemon.pid")
+	SocketFile = filepath.Join(WrapperDir, "daemon.sock")
 	SessionMapFile = filepath.Join(WrapperDir, "sessions.db")
+	HTTPTokenFile = filepath.Join(WrapperDir, "http.token")
 }
 
 func getProjectRoot() (string, error) {
@@ -0,0 +1,129 @@
+package daemon
+
+import (
+	"log"
+	"time"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/config"
+	"opencode_skill/internal/manager"
+)
+
+// progressEvents are the OpenCode events relayed to SUBSCRIBE streams that
+// asked for progress.
+var progressEvents = map[string]bool{
+	"message.part.updated": true,
+	"todo.updated":         true,
+	"session.status":       true,
+}
+
+// dispatchEvent routes an OpenCode event to the manager of its session.
+// Events for sessions this daemon does not manage are ignored.
+func (s *Server) dispatchEvent(ev api.Event) {
+	sessionID := ev.SessionID()
+	if sessionID == "" {
+		return
+	}
+	sm, ok := s.getSession(sessionID)
+	if !ok {
+		return
+	}
+	sm.HandleEvent(ev)
+	if progressEvents[ev.Type] {
+		s.publishProgress(sessionID, ev)
+	}
+}
+
+// resync reloads pending questions, permissions, session status and todo
+// lists for every managed session after the event stream (re)connects, since
+// events may have been missed. All but the todos are fetched once per working
+// directory rather than once per session.
+func (s *Server) resync() {
+	s.mu.RLock()
+	byDir := make(map[string][]*manager.SessionManager)
+	for _, sm := range s.sessions {
+		dir := sm.WorkingDir()
+		byDir[dir] = append(byDir[dir], sm)
+	}
+	s.mu.RUnlock()
+
+	for dir, managers := range byDir {
+		client := s.apiClient(dir)
+		for _, sm := range managers {
+			sm.SyncTodos()
+			sm.SyncRevert()
+		}
+
+		questions, err := client.GetQuestions()
+		if err != nil {
+			log.Printf("Failed to resync questions for %s: %v", dir, err)
+		} else {
+			for _, sm := range managers {
+				sm.SyncQuestions(questions)
+			}
+		}
+
+		permissions, err := client.GetPermissions()
+		if err != nil {
+			log.Printf("Failed to resync permissions for %s: %v", dir, err)
+		} else {
+			for _, sm := range managers {
+				sm.SyncPermissions(permissions)
+			}
+		}
+
+		statuses, err := client.GetSessionStatus()
+		if err != nil {
+			log.Printf("Failed to resync session status for %s: %v", dir, err)
+			continue
+		}
+		for _, sm := range managers {
+			sm.SyncStatus(statuses)
+		}
+	}
+}
+
+// pollStatus polls session status while the event stream is down, so a task
+// that finishes during an outage is picked up without waiting for the stream
+// to come back.
+func (s *Server) pollStatus() {
+	ticker := time.NewTicker(config.StatusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if !s.streamConnected.Load() {
+				s.syncStatus()
+			}
+		}
+	}
+}
+
+// syncStatus fetches session status once per working directory with a busy
+// session and hands it to that directory's busy managers.
+func (s *Server) syncStatus() {
+	s.mu.RLock()
+	byDir := make(map[string][]*manager.SessionManager)
+	for _, sm := range s.sessions {
+		if sm.GetSnapshot().State == manager.StateIdle {
+			continue
+		}
+		dir := sm.WorkingDir()
+		byDir[dir] = append(byDir[dir], sm)
+	}
+	s.mu.RUnlock()
+
+	for dir, managers := range byDir {
+		statuses, err := s.apiClient(dir).GetSessionStatus()
+		if err != nil {
+			log.Printf("Failed to poll session status for %s: %v", dir, err)
+			continue
+		}
+		for _, sm := range managers {
+			sm.SyncStatus(statuses)
+		}
+	}
+}
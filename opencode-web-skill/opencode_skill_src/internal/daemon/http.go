@@ -0,0 +1,341 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"opencode_skill/internal/config"
+	"opencode_skill/internal/types"
+)
+
+//go:embed openapi.json
+var openAPIDoc []byte
+
+// httpHandler exposes the daemon actions as a resource-style HTTP/JSON API.
+// Every route maps onto the same handleRequest used by the socket protocol,
+// so both transports share behavior and response bodies.
+func (s *Server) httpHandler() http.Handler {
+	return s.guardHTTP(s.httpRoutes())
+}
+
+// guardHTTP only lets through requests a local client made on purpose: the
+// Host must be a loopback address, so DNS rebinding fails; a browser Origin
+// must be loopback too; the bearer token must match the one in the token
+// file, which only the current user can read; and request bodies must be
+// JSON, which HTML forms cannot send.
+func (s *Server) guardHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			writeJSON(w, http.StatusForbidden, errorResponse(http.StatusForbidden, "Host must be a loopback address"))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !isLoopbackHost(u.Host) {
+				writeJSON(w, http.StatusForbidden, errorResponse(http.StatusForbidden, "Cross-origin requests are not allowed"))
+				return
+			}
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.httpToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.httpToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, errorResponse(http.StatusUnauthorized, "Missing or invalid bearer token"))
+			return
+		}
+
+		if r.Method == http.MethodPost || r.Method == http.MethodPut {
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				writeJSON(w, http.StatusUnsupportedMediaType, errorResponse(http.StatusUnsupportedMediaType, "Content-Type must be application/json"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackHost reports whether host, with or without a port, names the
+// local machine.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// loadHTTPToken returns the HTTP API bearer token stored at path, creating
+// the file with a random token on first use. A token file other users can
+// read is refused.
+func loadHTTPToken(path string) (string, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			f.Close()
+			os.Remove(path)
+			return "", err
+		}
+		token := hex.EncodeToString(buf)
+		_, err = f.WriteString(token + "\n")
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return token, nil
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%s must not be accessible by other users (mode %o); run chmod 600", path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return token, nil
+}
+
+func (s *Server) httpRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPIDoc)
+	})
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		s.serveAction(w, request{Action: "PING"}, http.StatusOK)
+	})
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		s.serveAction(w, request{Action: "LIST_SESSIONS"}, http.StatusOK)
+	})
+
+	mux.HandleFunc("POST /sessions/prune", func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := decodeBody(w, r)
+		if !ok {
+			return
+		}
+		s.serveAction(w, request{Action: "PRUNE_SESSIONS", Payload: payload}, http.StatusOK)
+	})
+	mux.HandleFunc("GET /opencode/sessions", func(w http.ResponseWriter, r *http.Request) {
+		payload := map[string]interface{}{"working_dir": r.URL.Query().Get("working_dir")}
+		s.serveAction(w, request{Action: "LIST_REMOTE_SESSIONS", Payload: payload}, http.StatusOK)
+	})
+
+	mux.HandleFunc("GET /projects/{project}/sessions/{session}", func(w http.ResponseWriter, r *http.Request) {
+		s.serveAction(w, request{Action: "GET_SESSION", Payload: sessionPayload(r)}, http.StatusOK)
+	})
+	mux.HandleFunc("DELETE /projects/{project}/sessions/{session}", func(w http.ResponseWriter, r *http.Request) {
+		payload := sessionPayload(r)
+		payload["remote"] = r.URL.Query().Get("remote") == "true"
+		s.serveAction(w, request{Action: "DELETE_SESSION", Payload: payload}, http.StatusOK)
+	})
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}", func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := decodeBody(w, r)
+		if !ok {
+			return
+		}
+		for k, v := range sessionPayload(r) {
+			payload[k] = v
+		}
+		s.serveAction(w, request{Action: "INIT_SESSION", Payload: payload}, http.StatusCreated)
+	})
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/fork", func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := decodeBody(w, r)
+		if !ok {
+			return
+		}
+		for k, v := range sessionPayload(r) {
+			payload[k] = v
+		}
+		s.serveAction(w, request{Action: "FORK_SESSION", Payload: payload}, http.StatusCreated)
+	})
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/adopt", func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := decodeBody(w, r)
+		if !ok {
+			return
+		}
+		for k, v := range sessionPayload(r) {
+			payload[k] = v
+		}
+		s.serveAction(w, request{Action: "ADOPT_SESSION", Payload: payload}, http.StatusCreated)
+	})
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/archive", func(w http.ResponseWriter, r *http.Request) {
+		payload := sessionPayload(r)
+		payload["archived"] = true
+		s.serveAction(w, request{Action: "ARCHIVE_SESSION", Payload: payload}, http.StatusOK)
+	})
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/unarchive", func(w http.ResponseWriter, r *http.Request) {
+		payload := sessionPayload(r)
+		payload["archived"] = false
+		s.serveAction(w, request{Action: "ARCHIVE_SESSION", Payload: payload}, http.StatusOK)
+	})
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/abort", func(w http.ResponseWriter, r *http.Request) {
+		s.serveAction(w, request{Action: "ABORT_SESSION", Payload: sessionPayload(r)}, http.StatusOK)
+	})
+
+	mux.HandleFunc("GET /projects/{project}/sessions/{session}/status", s.sessionRoute("GET_STATUS", http.StatusOK))
+	mux.HandleFunc("GET /projects/{project}/sessions/{session}/diff", s.sessionRoute("GET_DIFF", http.StatusOK))
+	mux.HandleFunc("GET /projects/{project}/sessions/{session}/messages", s.sessionRoute("GET_HISTORY", http.StatusOK))
+	mux.HandleFunc("GET /projects/{project}/sessions/{session}/messages/{message}", s.sessionRoute("GET_MESSAGE", http.StatusOK))
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/prompt", s.sessionRoute("PROMPT", http.StatusAccepted))
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/command", s.sessionRoute("COMMAND", http.StatusAccepted))
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/shell", s.sessionRoute("SHELL", http.StatusAccepted))
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/answer", s.sessionRoute("ANSWER", http.StatusAccepted))
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/reject", s.sessionRoute("REJECT", http.StatusAccepted))
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/permit", s.sessionRoute("PERMIT", http.StatusAccepted))
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/undo", s.sessionRoute("UNDO", http.StatusAccepted))
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/redo", s.sessionRoute("REDO", http.StatusAccepted))
+	mux.HandleFunc("POST /projects/{project}/sessions/{session}/compact", s.sessionRoute("COMPACT", http.StatusAccepted))
+	mux.HandleFunc("PUT /projects/{project}/sessions/{session}/auto-compact", s.sessionRoute("SET_AUTO_COMPACT", http.StatusOK))
+
+	return mux
+}
+
+// sessionRoute serves an action addressed to a session's manager. The
+// session is resolved from the registry and its manager started on demand,
+// which the CLI otherwise does with START_SESSION.
+func (s *Server) sessionRoute(action string, okStatus int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := s.registry.Get(r.PathValue("project"), r.PathValue("session"))
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, errorResponse(http.StatusNotFound, "Session not found"))
+			return
+		}
+		if session.Archived {
+			writeJSON(w, http.StatusConflict, errorResponse(http.StatusConflict, archivedMessage(session)))
+			return
+		}
+
+		payload := map[string]interface{}{}
+		if r.Method != http.MethodGet {
+			var ok bool
+			if payload, ok = decodeBody(w, r); !ok {
+				return
+			}
+		} else {
+			for key := range r.URL.Query() {
+				payload[key] = r.URL.Query().Get(key)
+			}
+			if id := r.PathValue("message"); id != "" {
+				payload["messageID"] = id
+			}
+		}
+
+		switch action {
+		case "PROMPT":
+			applyPromptDefaults(payload)
+		case "COMMAND", "SHELL":
+			applyAgentDefaults(payload)
+		case "GET_HISTORY":
+			if limit, ok := payload["limit"].(string); ok {
+				n, err := strconv.Atoi(limit)
+				if err != nil {
+					writeJSON(w, http.StatusBadRequest, errorResponse(http.StatusBadRequest, "limit must be a non-negative integer"))
+					return
+				}
+				payload["limit"] = float64(n)
+			}
+		case "COMPACT":
+			if model, ok := payload["model"].(string); ok {
+				payload["model"] = types.ParseModel(model)
+			}
+		}
+
+		s.startManager(session.ID, session.WorkingDir)
+		s.serveAction(w, request{Action: action, SessionID: session.ID, Payload: payload}, okStatus)
+	}
+}
+
+func (s *Server) serveAction(w http.ResponseWriter, req request, okStatus int) {
+	response := s.handleRequest(req)
+
+	status := okStatus
+	if response["status"] == "error" {
+		status = http.StatusInternalServerError
+		if code, ok := response["code"].(int); ok {
+			status = code
+		}
+	}
+	writeJSON(w, status, response)
+}
+
+func sessionPayload(r *http.Request) map[string]interface{} {
+	return map[string]interface{}{
+		"project":      r.PathValue("project"),
+		"session_name": r.PathValue("session"),
+	}
+}
+
+// decodeBody decodes a JSON object request body. An empty body yields an
+// empty payload.
+func decodeBody(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	payload := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, errorResponse(http.StatusBadRequest, "Invalid JSON"))
+		return nil, false
+	}
+	return payload, true
+}
+
+// applyPromptDefaults fills in the CLI defaults and accepts a plain "text"
+// field as shorthand for a single text part.
+func applyPromptDefaults(payload map[string]interface{}) {
+	applyAgentDefaults(payload)
+	if _, ok := payload["parts"]; !ok {
+		if text, ok := payload["text"].(string); ok {
+			payload["parts"] = []interface{}{map[string]interface{}{"type": "text", "text": text}}
+		}
+	}
+	delete(payload, "text")
+}
+
+func applyAgentDefaults(payload map[string]interface{}) {
+	if agent, _ := payload["agent"].(string); agent == "" {
+		payload["agent"] = config.DefaultAgent
+	}
+	switch model := payload["model"].(type) {
+	case string:
+		payload["model"] = types.ParseModel(model)
+	case nil:
+		payload["model"] = types.ParseModel(config.DefaultModel)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,378 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHTTPToken = "test-token"
+
+// bearerTransport adds the test token to every request.
+type bearerTransport struct {
+	base http.RoundTripper
+}
+
+func (t bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	if r.Header.Get("Authorization") == "" {
+		r.Header.Set("Authorization", "Bearer "+testHTTPToken)
+	}
+	return t.base.RoundTrip(r)
+}
+
+// newHTTPTestServer serves the HTTP API of a fresh server. ts.Client()
+// authenticates with the server's token.
+func newHTTPTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	t.Cleanup(func() { registry.Close() })
+
+	s := newTestServer(t, registry)
+	s.httpToken = testHTTPToken
+	ts := httptest.NewServer(s.httpHandler())
+	t.Cleanup(ts.Close)
+	ts.Client().Transport = bearerTransport{base: ts.Client().Transport}
+	return s, ts
+}
+
+func decodeResponse(t *testing.T, resp *http.Response) map[string]interface{} {
+	t.Helper()
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+	return body
+}
+
+func TestHTTP_Health(t *testing.T) {
+	t.Parallel()
+
+	_, ts := newHTTPTestServer(t)
+
+	resp, err := ts.Client().Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatalf("GET /health failed: %v", err)
+	}
+	body := decodeResponse(t, resp)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+	if body["message"] != "PONG" {
+		t.Errorf("Expected PONG, got %v", body)
+	}
+}
+
+func TestHTTP_ListAndGetSession(t *testing.T) {
+	t.Parallel()
+
+	s, ts := newHTTPTestServer(t)
+	if err := s.registry.Create("proj", "task-1", "ses_1", "/work"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/sessions")
+	if err != nil {
+		t.Fatalf("GET /sessions failed: %v", err)
+	}
+	body := decodeResponse(t, resp)
+	if sessions, _ := body["sessions"].([]interface{}); len(sessions) != 1 {
+		t.Errorf("Expected 1 session, got %v", body["sessions"])
+	}
+
+	resp, err = ts.Client().Get(ts.URL + "/projects/proj/sessions/task-1")
+	if err != nil {
+		t.Fatalf("GET session failed: %v", err)
+	}
+	body = decodeResponse(t, resp)
+	session, _ := body["session"].(map[string]interface{})
+	if resp.StatusCode != http.StatusOK || session["session_id"] != "ses_1" {
+		t.Errorf("Expected session ses_1 with 200, got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestHTTP_NotFound(t *testing.T) {
+	t.Parallel()
+
+	_, ts := newHTTPTestServer(t)
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/projects/proj/sessions/missing"},
+		{"GET", "/projects/proj/sessions/missing/status"},
+		{"GET", "/projects/proj/sessions/missing/diff?messageID=msg_1"},
+		{"GET", "/projects/proj/sessions/missing/messages/msg_1"},
+		{"POST", "/projects/proj/sessions/missing/prompt"},
+		{"POST", "/projects/proj/sessions/missing/abort"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(`{"text": "hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", tt.method, tt.path, err)
+		}
+		body := decodeResponse(t, resp)
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d", tt.method, tt.path, resp.StatusCode)
+		}
+		if body["status"] != "error" {
+			t.Errorf("%s %s: expected error body, got %v", tt.method, tt.path, body)
+		}
+	}
+}
+
+func TestHTTP_RequestGuards(t *testing.T) {
+	t.Parallel()
+
+	_, ts := newHTTPTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		host   string
+		code   int
+	}{
+		{"no token", "GET", map[string]string{"Authorization": "None"}, "", http.StatusUnauthorized},
+		{"wrong token", "GET", map[string]string{"Authorization": "Bearer nope"}, "", http.StatusUnauthorized},
+		{"foreign origin", "GET", map[string]string{"Origin": "https://evil.example"}, "", http.StatusForbidden},
+		{"rebound host", "GET", nil, "evil.example:44112", http.StatusForbidden},
+		{"form body", "POST", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, "", http.StatusUnsupportedMediaType},
+		{"no content type", "POST", nil, "", http.StatusUnsupportedMediaType},
+		{"loopback origin", "GET", map[string]string{"Origin": "http://localhost:3000"}, "", http.StatusOK},
+		{"localhost host", "GET", nil, "localhost:44112", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		path := "/health"
+		if tt.method == "POST" {
+			path = "/sessions/prune"
+		}
+		req, _ := http.NewRequest(tt.method, ts.URL+path, strings.NewReader(`{}`))
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		decodeResponse(t, resp)
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.code, resp.StatusCode)
+		}
+	}
+}
+
+func TestLoadHTTPToken(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "http.token")
+	token, err := loadHTTPToken(path)
+	if err != nil {
+		t.Fatalf("loadHTTPToken failed: %v", err)
+	}
+	if len(token) != 64 {
+		t.Errorf("Expected a 64 character token, got %q", token)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat token file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected token file mode 0600, got %o", perm)
+	}
+
+	again, err := loadHTTPToken(path)
+	if err != nil || again != token {
+		t.Errorf("Expected the stored token %q, got %q, %v", token, again, err)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if _, err := loadHTTPToken(path); err == nil {
+		t.Error("Expected a token file other users can read to be refused")
+	}
+}
+
+func TestHTTP_InvalidJSON(t *testing.T) {
+	t.Parallel()
+
+	s, ts := newHTTPTestServer(t)
+	if err := s.registry.Create("proj", "task-1", "ses_1", "/work"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	resp, err := ts.Client().Post(ts.URL+"/projects/proj/sessions/task-1/prompt", "application/json", strings.NewReader("{nope"))
+	if err != nil {
+		t.Fatalf("POST prompt failed: %v", err)
+	}
+	decodeResponse(t, resp)
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_HistoryLimit(t *testing.T) {
+	t.Parallel()
+
+	s, ts := newHTTPTestServer(t)
+	if err := s.registry.Create("proj", "task-1", "ses_1", "/work"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	for _, limit := range []string{"ten", "-1"} {
+		resp, err := ts.Client().Get(ts.URL + "/projects/proj/sessions/task-1/messages?limit=" + limit)
+		if err != nil {
+			t.Fatalf("GET messages failed: %v", err)
+		}
+		decodeResponse(t, resp)
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("limit=%s: expected 400, got %d", limit, resp.StatusCode)
+		}
+	}
+}
+
+func TestHTTP_OpenAPIDocument(t *testing.T) {
+	t.Parallel()
+
+	_, ts := newHTTPTestServer(t)
+
+	resp, err := ts.Client().Get(ts.URL + "/openapi.json")
+	if err != nil {
+		t.Fatalf("GET /openapi.json failed: %v", err)
+	}
+	body := decodeResponse(t, resp)
+
+	paths, _ := body["paths"].(map[string]interface{})
+	if _, ok := paths["/projects/{project}/sessions/{session}/prompt"]; !ok {
+		t.Errorf("Expected prompt route in OpenAPI document, got paths %v", paths)
+	}
+}
+
+func TestApplyPromptDefaults(t *testing.T) {
+	t.Parallel()
+
+	payload := map[string]interface{}{"text": "hello", "model": "openai/gpt-5"}
+	applyPromptDefaults(payload)
+
+	if payload["agent"] != "sisyphus" {
+		t.Errorf("Expected default agent sisyphus, got %v", payload["agent"])
+	}
+	parts, _ := payload["parts"].([]interface{})
+	if len(parts) != 1 {
+		t.Fatalf("Expected 1 part, got %v", payload["parts"])
+	}
+	if part, _ := parts[0].(map[string]interface{}); part["text"] != "hello" {
+		t.Errorf("Expected text part 'hello', got %v", parts[0])
+	}
+	if _, ok := payload["text"]; ok {
+		t.Error("Expected text shorthand to be removed")
+	}
+}
+
+func TestHTTP_ForkErrors(t *testing.T) {
+	t.Parallel()
+
+	s, ts := newHTTPTestServer(t)
+	if err := s.registry.Create("proj", "task", "ses_1", "/tmp"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := s.registry.Create("proj", "taken", "ses_2", "/tmp"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	tests := []struct {
+		path, body string
+		code       int
+	}{
+		{"/projects/proj/sessions/missing/fork", `{"new_session_name": "try-b"}`, http.StatusNotFound},
+		{"/projects/proj/sessions/task/fork", `{}`, http.StatusBadRequest},
+		{"/projects/proj/sessions/task/fork", `{"new_session_name": "taken"}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		resp, err := ts.Client().Post(ts.URL+tt.path, "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", tt.path, err)
+		}
+		body := decodeResponse(t, resp)
+		if resp.StatusCode != tt.code || body["status"] != "error" {
+			t.Errorf("POST %s %s: expected %d error, got %d %v", tt.path, tt.body, tt.code, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestHTTP_AdoptErrors(t *testing.T) {
+	t.Parallel()
+
+	s, ts := newHTTPTestServer(t)
+	if err := s.registry.Create("proj", "taken", "ses_1", "/tmp"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	tests := []struct {
+		path, body string
+		code       int
+	}{
+		{"/projects/proj/sessions/new/adopt", `{}`, http.StatusBadRequest},
+		{"/projects/proj/sessions/taken/adopt", `{"opencode_session_id": "ses_2"}`, http.StatusConflict},
+		{"/projects/proj/sessions/new/adopt", `{"opencode_session_id": "ses_1"}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		resp, err := ts.Client().Post(ts.URL+tt.path, "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", tt.path, err)
+		}
+		body := decodeResponse(t, resp)
+		if resp.StatusCode != tt.code || body["status"] != "error" {
+			t.Errorf("POST %s %s: expected %d error, got %d %v", tt.path, tt.body, tt.code, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestHTTP_ArchivedSession(t *testing.T) {
+	t.Parallel()
+
+	s, ts := newHTTPTestServer(t)
+	if err := s.registry.Create("proj", "task", "ses_1", "/tmp"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := s.registry.UpdateArchived("proj", "task", true); err != nil {
+		t.Fatalf("UpdateArchived failed: %v", err)
+	}
+
+	resp, err := ts.Client().Post(ts.URL+"/projects/proj/sessions/task/prompt", "application/json", strings.NewReader(`{"text": "hi"}`))
+	if err != nil {
+		t.Fatalf("POST prompt failed: %v", err)
+	}
+	body := decodeResponse(t, resp)
+	if resp.StatusCode != http.StatusConflict || !strings.Contains(body["message"].(string), "--undo") {
+		t.Errorf("Expected 409 pointing at archive-session --undo, got %d %v", resp.StatusCode, body)
+	}
+	if _, ok := s.getSession("ses_1"); ok {
+		t.Error("Expected no manager for an archived session")
+	}
+}
@@ -3,24 +3,33 @@ package daemon
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type SessionData struct {
-	Project        string `json:"project"`
-	SessionName    string `json:"session_name"`
-	ID             string `json:"session_id"`
-	WorkingDir     string `json:"working_dir"`
-	LastAgent      string `json:"last_agent"`
-	IsAgentLocked  bool   `json:"is_agent_locked"`
-	State          string `json:"state"`
-	LatestResponse string `json:"latest_response"`
-	Questions      string `json:"questions"`
-	LastActivity   string `json:"last_activity"`
+	Project          string `json:"project"`
+	SessionName      string `json:"session_name"`
+	ID               string `json:"session_id"`
+	WorkingDir       string `json:"working_dir"`
+	LastAgent        string `json:"last_agent"`
+	IsAgentLocked    bool   `json:"is_agent_locked"`
+	State            string `json:"state"`
+	LatestResponse   string `json:"latest_response"`
+	Questions        string `json:"questions"`
+	LastActivity     string `json:"last_activity"`
+	PermissionPolicy string `json:"permission_policy"`
+	AutoCompact      int    `json:"auto_compact"`
+	Archived         bool   `json:"archived"`
+	Permissions      string `json:"permissions"`
+	Todos            string `json:"todos"`
+	Context          string `json:"context"`
+	Revert           string `json:"revert"`
 }
 
 var (
@@ -64,6 +73,13 @@ func NewRegistry(dbPath string) (*Registry, error) {
 		"latest_response" TEXT DEFAULT '',
 		"questions" TEXT DEFAULT '[]',
 		"last_activity" TEXT DEFAULT '',
+		"permission_policy" TEXT DEFAULT '',
+		"auto_compact" INTEGER DEFAULT 0,
+		"archived" INTEGER DEFAULT 0,
+		"permissions" TEXT DEFAULT '[]',
+		"todos" TEXT DEFAULT '',
+		"context" TEXT DEFAULT '',
+		"revert" TEXT DEFAULT '',
 		PRIMARY KEY (project, session_name)
 	);`
 
@@ -72,20 +88,76 @@ func NewRegistry(dbPath string) (*Registry, error) {
 		return nil, err
 	}
 
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &Registry{db: db}, nil
 }
 
+// addedColumns are columns introduced after the sessions table was first
+// shipped, with their definitions. Databases created by older versions get
+// them on open.
+var addedColumns = []struct{ name, def string }{
+	{"permission_policy", "TEXT DEFAULT ''"},
+	{"auto_compact", "INTEGER DEFAULT 0"},
+	{"archived", "INTEGER DEFAULT 0"},
+	{"permissions", "TEXT DEFAULT '[]'"},
+	{"todos", "TEXT DEFAULT ''"},
+	{"context", "TEXT DEFAULT ''"},
+	{"revert", "TEXT DEFAULT ''"},
+}
+
+func migrate(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(sessions)")
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, col := range addedColumns {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE sessions ADD COLUMN %q %s", col.name, col.def)); err != nil {
+			return err
+		}
+	}
+
+	// Sessions created before Create recorded the time have no activity;
+	// start their clock now so prune can age them out like any other
+	_, err = db.Exec("UPDATE sessions SET last_activity = ? WHERE last_activity IS NULL OR last_activity = ''", time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
 func (r *Registry) Create(project, sessionName, id, workingDir string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	stmt, err := r.db.Prepare("INSERT INTO sessions (project, session_name, id, working_dir, last_agent) VALUES (?, ?, ?, ?, '')")
+	stmt, err := r.db.Prepare("INSERT INTO sessions (project, session_name, id, working_dir, last_agent, last_activity) VALUES (?, ?, ?, ?, '', ?)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(project, sessionName, id, workingDir)
+	_, err = stmt.Exec(project, sessionName, id, workingDir, time.Now().UTC().Format(time.RFC3339))
 	if err != nil {
 		if err.Error() == "UNIQUE constraint failed: sessions.project, sessions.session_name" {
 			return ErrDuplicate
@@ -100,10 +172,10 @@ func (r *Registry) Get(project, sessionName string) (*SessionData, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	row := r.db.QueryRow("SELECT project, session_name, id, working_dir, last_agent, is_agent_locked, state, latest_response, questions, last_activity FROM sessions WHERE project = ? AND session_name = ?", project, sessionName)
+	row := r.db.QueryRow("SELECT project, session_name, id, working_dir, last_agent, is_agent_locked, state, latest_response, questions, last_activity, permission_policy, auto_compact, archived, permissions, todos, context, revert FROM sessions WHERE project = ? AND session_name = ?", project, sessionName)
 
 	var session SessionData
-	err := row.Scan(&session.Project, &session.SessionName, &session.ID, &session.WorkingDir, &session.LastAgent, &session.IsAgentLocked, &session.State, &session.LatestResponse, &session.Questions, &session.LastActivity)
+	err := row.Scan(&session.Project, &session.SessionName, &session.ID, &session.WorkingDir, &session.LastAgent, &session.IsAgentLocked, &session.State, &session.LatestResponse, &session.Questions, &session.LastActivity, &session.PermissionPolicy, &session.AutoCompact, &session.Archived, &session.Permissions, &session.Todos, &session.Context, &session.Revert)
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	}
@@ -118,7 +190,7 @@ func (r *Registry) List() ([]SessionData, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	rows, err := r.db.Query("SELECT project, session_name, id, working_dir, last_agent, is_agent_locked, state, latest_response, questions, last_activity FROM sessions ORDER BY project, session_name")
+	rows, err := r.db.Query("SELECT project, session_name, id, working_dir, last_agent, is_agent_locked, state, latest_response, questions, last_activity, permission_policy, auto_compact, archived, permissions, todos, context, revert FROM sessions ORDER BY project, session_name")
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +199,7 @@ func (r *Registry) List() ([]SessionData, error) {
 	var sessions []SessionData
 	for rows.Next() {
 		var s SessionData
-		if err := rows.Scan(&s.Project, &s.SessionName, &s.ID, &s.WorkingDir, &s.LastAgent, &s.IsAgentLocked, &s.State, &s.LatestResponse, &s.Questions, &s.LastActivity); err != nil {
+		if err := rows.Scan(&s.Project, &s.SessionName, &s.ID, &s.WorkingDir, &s.LastAgent, &s.IsAgentLocked, &s.State, &s.LatestResponse, &s.Questions, &s.LastActivity, &s.PermissionPolicy, &s.AutoCompact, &s.Archived, &s.Permissions, &s.Todos, &s.Context, &s.Revert); err != nil {
 			return nil, err
 		}
 		sessions = append(sessions, s)
@@ -225,6 +297,78 @@ func (r *Registry) UpdateLastActivity(project, sessionName, timestamp string) er
 	return nil
 }
 
+func (r *Registry) UpdatePermissionPolicy(project, sessionName, policy string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, err := r.db.Exec("UPDATE sessions SET permission_policy = ? WHERE project = ? AND session_name = ?", policy, project, sessionName)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateAutoCompact sets the session's auto-compaction threshold, in percent
+// of the context window; 0 turns it off.
+func (r *Registry) UpdateAutoCompact(project, sessionName string, percent int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, err := r.db.Exec("UPDATE sessions SET auto_compact = ? WHERE project = ? AND session_name = ?", percent, project, sessionName)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateArchived archives or restores the session. Archived sessions stay
+// in the registry but are not recovered when the daemon starts.
+func (r *Registry) UpdateArchived(project, sessionName string, archived bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	archivedInt := 0
+	if archived {
+		archivedInt = 1
+	}
+
+	result, err := r.db.Exec("UPDATE sessions SET archived = ? WHERE project = ? AND session_name = ?", archivedInt, project, sessionName)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 func (r *Registry) UpdateSessionData(project, sessionName string, session SessionData) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -235,8 +379,8 @@ func (r *Registry) UpdateSessionData(project, sessionName string, session Sessio
 	}
 
 	result, err := r.db.Exec(
-		"UPDATE sessions SET last_agent = ?, is_agent_locked = ?, state = ?, latest_response = ?, questions = ?, last_activity = ? WHERE project = ? AND session_name = ?",
-		session.LastAgent, lockedInt, session.State, session.LatestResponse, session.Questions, session.LastActivity, project, sessionName,
+		"UPDATE sessions SET last_agent = ?, is_agent_locked = ?, state = ?, latest_response = ?, questions = ?, permissions = ?, todos = ?, context = ?, revert = ?, last_activity = ? WHERE project = ? AND session_name = ?",
+		session.LastAgent, lockedInt, session.State, session.LatestResponse, session.Questions, session.Permissions, session.Todos, session.Context, session.Revert, session.LastActivity, project, sessionName,
 	)
 	if err != nil {
 		return err
@@ -264,10 +408,10 @@ func (r *Registry) FindByID(sessionID string) (*SessionData, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	row := r.db.QueryRow("SELECT project, session_name, id, working_dir, last_agent, is_agent_locked, state, latest_response, questions, last_activity FROM sessions WHERE id = ?", sessionID)
+	row := r.db.QueryRow("SELECT project, session_name, id, working_dir, last_agent, is_agent_locked, state, latest_response, questions, last_activity, permission_policy, auto_compact, archived, permissions, todos, context, revert FROM sessions WHERE id = ?", sessionID)
 
 	var session SessionData
-	err := row.Scan(&session.Project, &session.SessionName, &session.ID, &session.WorkingDir, &session.LastAgent, &session.IsAgentLocked, &session.State, &session.LatestResponse, &session.Questions, &session.LastActivity)
+	err := row.Scan(&session.Project, &session.SessionName, &session.ID, &session.WorkingDir, &session.LastAgent, &session.IsAgentLocked, &session.State, &session.LatestResponse, &session.Questions, &session.LastActivity, &session.PermissionPolicy, &session.AutoCompact, &session.Archived, &session.Permissions, &session.Todos, &session.Context, &session.Revert)
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	}
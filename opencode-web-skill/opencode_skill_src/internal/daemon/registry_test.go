@@ -1,9 +1,11 @@
 package daemon
 
 import (
+	"database/sql"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestRegistry_CreateAndGet(t *testing.T) {
@@ -546,6 +548,8 @@ func TestRegistry_UpdateSessionData(t *testing.T) {
 		State:          "BUSY",
 		LatestResponse: `{"result": "success"}`,
 		Questions:      `[{"id": "q1", "text": "Question?"}]`,
+		Todos:          `[{"id": "1", "content": "Plan"}]`,
+		Revert:         `{"messageID": "msg_1"}`,
 		LastActivity:   "2026-02-16T14:00:00Z",
 	}
 
@@ -577,6 +581,12 @@ func TestRegistry_UpdateSessionData(t *testing.T) {
 	if session.LastActivity != "2026-02-16T14:00:00Z" {
 		t.Errorf("Expected last_activity timestamp, got %s", session.LastActivity)
 	}
+	if session.Todos != `[{"id": "1", "content": "Plan"}]` {
+		t.Errorf("Expected todos JSON, got %s", session.Todos)
+	}
+	if session.Revert != `{"messageID": "msg_1"}` {
+		t.Errorf("Expected revert JSON, got %s", session.Revert)
+	}
 }
 
 func TestRegistry_UpdateSessionData_NotFound(t *testing.T) {
@@ -599,3 +609,147 @@ func TestRegistry_UpdateSessionData_NotFound(t *testing.T) {
 		t.Errorf("Expected ErrNotFound, got %v", err)
 	}
 }
+
+func TestRegistry_UpdatePermissionPolicy(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	registry, err := NewRegistry(dbPath)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	if err := registry.Create("project", "session", "id-1", "/dir1"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	policy := `[{"permission":"bash","pattern":"go test*","action":"allow"}]`
+	if err := registry.UpdatePermissionPolicy("project", "session", policy); err != nil {
+		t.Fatalf("UpdatePermissionPolicy failed: %v", err)
+	}
+
+	session, err := registry.FindByID("id-1")
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if session.PermissionPolicy != policy {
+		t.Errorf("Expected permission_policy %s, got %s", policy, session.PermissionPolicy)
+	}
+
+	if err := registry.UpdatePermissionPolicy("nonexistent", "session", policy); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRegistry_UpdateAutoCompact(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	registry, err := NewRegistry(dbPath)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	if err := registry.Create("project", "session", "id-1", "/dir1"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if err := registry.UpdateAutoCompact("project", "session", 80); err != nil {
+		t.Fatalf("UpdateAutoCompact failed: %v", err)
+	}
+
+	session, err := registry.Get("project", "session")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if session.AutoCompact != 80 {
+		t.Errorf("Expected auto_compact 80, got %d", session.AutoCompact)
+	}
+
+	if err := registry.UpdateAutoCompact("nonexistent", "session", 80); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRegistry_UpdateArchived(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	registry, err := NewRegistry(dbPath)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	if err := registry.Create("project", "session", "id-1", "/dir1"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	for _, archived := range []bool{true, false} {
+		if err := registry.UpdateArchived("project", "session", archived); err != nil {
+			t.Fatalf("UpdateArchived failed: %v", err)
+		}
+		sessions, err := registry.List()
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].Archived != archived {
+			t.Errorf("Expected archived %v, got %+v", archived, sessions)
+		}
+	}
+
+	if err := registry.UpdateArchived("nonexistent", "session", true); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRegistry_MigratesOldSchema(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE sessions (
+		"project" TEXT NOT NULL,
+		"session_name" TEXT NOT NULL,
+		"id" TEXT,
+		"working_dir" TEXT,
+		"last_agent" TEXT DEFAULT '',
+		"is_agent_locked" INTEGER DEFAULT 0,
+		"state" TEXT DEFAULT 'IDLE',
+		"latest_response" TEXT DEFAULT '',
+		"questions" TEXT DEFAULT '[]',
+		"last_activity" TEXT DEFAULT '',
+		PRIMARY KEY (project, session_name)
+	);
+	INSERT INTO sessions (project, session_name, id, working_dir) VALUES ('project', 'session', 'id-1', '/dir1');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := NewRegistry(dbPath)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	session, err := registry.Get("project", "session")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if session.PermissionPolicy != "" {
+		t.Errorf("Expected empty permission_policy, got %q", session.PermissionPolicy)
+	}
+	// A session that was never used gets a last_activity, so prune can age it out
+	if _, err := time.Parse(time.RFC3339, session.LastActivity); err != nil {
+		t.Errorf("Expected last_activity to be backfilled, got %q", session.LastActivity)
+	}
+	registry.Close()
+
+	// Reopening an already migrated database is a no-op
+	registry, err = NewRegistry(dbPath)
+	if err != nil {
+		t.Fatalf("NewRegistry on migrated database failed: %v", err)
+	}
+	registry.Close()
+}
@@ -1,53 +1,91 @@
 package daemon
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"opencode_skill/internal/api"
 	"opencode_skill/internal/config"
 	"opencode_skill/internal/manager"
+	"opencode_skill/internal/policy"
 	"opencode_skill/internal/types"
 )
 
 type Server struct {
-	sessions map[string]*manager.SessionManager
-	listener net.Listener
-	registry *Registry
-	port     int
+	mu         sync.RWMutex // Protects sessions
+	sessions   map[string]*manager.SessionManager
+	subsMu     sync.Mutex // Protects subs
+	subs       map[string]map[*subscriber]struct{}
+	listeners  []net.Listener
+	registry   *Registry
+	socketPath string
+	port       int    // TCP port; 0 disables the TCP listener
+	httpPort   int    // HTTP API port; 0 disables the HTTP API
+	httpToken  string // bearer token the HTTP API requires
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+	// streamConnected reports whether the OpenCode event stream is up;
+	// while it is not, session status is polled instead.
+	streamConnected atomic.Bool
+	// openCodeURL overrides the OpenCode server the daemon's own requests go
+	// to; tests point it at a fake.
+	openCodeURL string
 }
 
+// NewServer creates a server listening on the Unix socket only.
 func NewServer(registry *Registry) *Server {
-	return &Server{
-		sessions: make(map[string]*manager.SessionManager),
-		registry: registry,
-		port:     config.DaemonPort,
-	}
+	return NewServerWithPorts(registry, 0, 0)
 }
 
+// NewServerWithPort creates a server listening on the Unix socket and on the
+// given TCP port, without the HTTP API. A port of 0 serves the Unix socket
+// only.
 func NewServerWithPort(registry *Registry, port int) *Server {
+	return NewServerWithPorts(registry, port, 0)
+}
+
+// NewServerWithPorts creates a server listening on the Unix socket, on the
+// given TCP port and with the HTTP API on httpPort. A port of 0 disables its
+// listener.
+func NewServerWithPorts(registry *Registry, port, httpPort int) *Server {
 	return &Server{
-		sessions: make(map[string]*manager.SessionManager),
-		registry: registry,
-		port:     port,
+		sessions:   make(map[string]*manager.SessionManager),
+		registry:   registry,
+		socketPath: config.SocketFile,
+		port:       port,
+		httpPort:   httpPort,
+		stopChan:   make(chan struct{}),
 	}
 }
 
+// SetSocketPath makes the server listen on path instead of the default
+// socket. It must be called before Start.
+func (s *Server) SetSocketPath(path string) {
+	s.socketPath = path
+}
+
 func (s *Server) Start() error {
 	// Clean up stale PID file if process is dead
 	cleanupStalePID()
 
 	// Check if daemon is already running
-	if isDaemonRunning() {
-		return fmt.Errorf("daemon is already running on port %d", s.port)
+	if s.isDaemonRunning() {
+		return fmt.Errorf("daemon is already running (socket %s)", s.socketPath)
 	}
 
 	if err := s.writePID(); err != nil {
@@ -59,38 +97,76 @@ func (s *Server) Start() error {
 	if err != nil {
 		log.Printf("Warning: failed to list sessions for recovery: %v", err)
 	} else {
+		recovered := 0
 		for _, session := range sessions {
+			if session.Archived {
+				continue
+			}
 			fullData, err := s.registry.Get(session.Project, session.SessionName)
 			if err != nil {
 				log.Printf("Warning: failed to get full data for session %s/%s: %v", session.Project, session.SessionName, err)
 				fullData = &session
 			}
 
-			persistedState := &manager.PersistedState{
-				LastAgent:      fullData.LastAgent,
-				IsAgentLocked:  fullData.IsAgentLocked,
-				State:          fullData.State,
-				LatestResponse: fullData.LatestResponse,
-				Questions:      fullData.Questions,
-				LastActivity:   fullData.LastActivity,
-			}
-
-			sm := manager.NewSessionManager(session.ID, session.WorkingDir, persistedState)
+			sm := manager.NewSessionManager(session.ID, session.WorkingDir, persistedState(fullData))
+			setPolicy(sm, fullData.PermissionPolicy)
+			sm.SetAutoCompact(fullData.AutoCompact)
 			s.setupStatePersistence(sm)
 			sm.Start()
 			s.sessions[session.ID] = sm
+			recovered++
 			log.Printf("Recovered session: %s %s (ID: %s, Dir: %s, State: %s)", session.Project, session.SessionName, session.ID, session.WorkingDir, fullData.State)
 		}
-		log.Printf("Recovered %d session(s) from registry", len(sessions))
+		log.Printf("Recovered %d session(s) from registry, %d archived", recovered, len(sessions)-recovered)
+	}
+
+	events := api.NewEventStream()
+	events.OnEvent = s.dispatchEvent
+	events.OnConnect = func() {
+		s.streamConnected.Store(true)
+		s.resync()
 	}
+	events.OnDisconnect = func() { s.streamConnected.Store(false) }
+	go events.Run(s.stopChan)
+	go s.pollStatus()
 
-	addr := net.JoinHostPort(config.DaemonHost, strconv.Itoa(s.port))
-	ln, err := net.Listen("tcp", addr)
+	unixLn, err := listenUnix(s.socketPath)
 	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+		return fmt.Errorf("failed to listen on %s: %v", s.socketPath, err)
+	}
+	s.listeners = append(s.listeners, unixLn)
+	log.Printf("Daemon listening on %s", s.socketPath)
+
+	if s.port != 0 {
+		addr := net.JoinHostPort(config.DaemonHost, strconv.Itoa(s.port))
+		tcpLn, err := net.Listen("tcp", addr)
+		if err != nil {
+			unixLn.Close()
+			return fmt.Errorf("failed to listen on %s: %v", addr, err)
+		}
+		s.listeners = append(s.listeners, tcpLn)
+		log.Printf("Daemon listening on %s", addr)
+	}
+
+	var httpLn net.Listener
+	if s.httpPort != 0 {
+		if s.httpToken, err = loadHTTPToken(config.HTTPTokenFile); err != nil {
+			for _, ln := range s.listeners {
+				ln.Close()
+			}
+			return fmt.Errorf("failed to load HTTP API token: %v", err)
+		}
+		addr := net.JoinHostPort(config.DaemonHost, strconv.Itoa(s.httpPort))
+		httpLn, err = net.Listen("tcp", addr)
+		if err != nil {
+			for _, ln := range s.listeners {
+				ln.Close()
+			}
+			return fmt.Errorf("failed to listen on %s: %v", addr, err)
+		}
+		s.listeners = append(s.listeners, httpLn)
+		log.Printf("HTTP API listening on http://%s", addr)
 	}
-	s.listener = ln
-	log.Printf("Daemon listening on %s", addr)
 
 	// Handle signals
 	c := make(chan os.Signal, 1)
@@ -100,61 +176,168 @@ func (s *Server) Start() error {
 		s.Stop()
 	}()
 
+	var wg sync.WaitGroup
+	for _, ln := range s.listeners {
+		wg.Add(1)
+		go func(ln net.Listener) {
+			defer wg.Done()
+			if ln == httpLn {
+				http.Serve(ln, s.httpHandler())
+				return
+			}
+			s.serve(ln)
+		}(ln)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *Server) serve(ln net.Listener) {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			// Check if closed
-			select {
-			case <-c:
-				return nil
-			default:
-				log.Printf("Accept error: %v", err)
-				continue
+			if errors.Is(err, net.ErrClosed) {
+				return
 			}
+			log.Printf("Accept error: %v", err)
+			continue
 		}
 		go s.handleConnection(conn)
 	}
+}
 
+// listenUnix listens on a Unix socket that only the current user can connect
+// to. A stale socket left by a crashed daemon is replaced, but not one a
+// daemon still accepts connections on, nor a file that is not a socket.
+func listenUnix(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is in use by another daemon", path)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Create the socket with mode 0600 so there is no window in which other
+	// users could connect.
+	oldMask := syscall.Umask(0177)
+	ln, err := net.Listen("unix", path)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
 }
 
+// Stop shuts the daemon down and exits. Only the first call does anything,
+// so a signal arriving during a shutdown is harmless.
 func (s *Server) Stop() {
+	s.stopOnce.Do(s.shutdown)
+	os.Exit(0)
+}
+
+func (s *Server) shutdown() {
 	log.Println("Stopping daemon...")
-	if s.listener != nil {
-		s.listener.Close()
+	close(s.stopChan)
+	for _, ln := range s.listeners {
+		ln.Close()
 	}
 
 	// Stop all managers
+	s.mu.RLock()
 	for _, sm := range s.sessions {
 		sm.Stop()
 	}
+	s.mu.RUnlock()
 
 	if err := os.Remove(config.PidFile); err != nil {
 		log.Printf("Failed to remove PID file: %v", err)
 	}
-	os.Exit(0)
+}
+
+// request is a single frame of the daemon wire protocol. Frames are
+// newline-delimited JSON objects with no size limit; ID is echoed back on the
+// matching response so clients can pipeline several requests over one
+// connection.
+type request struct {
+	ID        uint64                 `json:"id,omitempty"`
+	Action    string                 `json:"action"`
+	SessionID string                 `json:"session_id"`
+	Payload   map[string]interface{} `json:"payload"`
+}
+
+// connWriter serializes response frames written by concurrent handlers.
+type connWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *connWriter) send(resp map[string]interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(resp)
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	buf := make([]byte, 4096)
-	n, err := conn.Read(buf)
-	if err != nil {
-		return
-	}
+	w := &connWriter{enc: json.NewEncoder(conn)}
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	state := newConnState()
 
-	var req struct {
-		Action    string                 `json:"action"`
-		SessionID string                 `json:"session_id"`
-		Payload   map[string]interface{} `json:"payload"`
-	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(state.done)
 
-	if err := json.Unmarshal(buf[:n], &req); err != nil {
-		s.sendError(conn, "Invalid JSON")
-		return
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+				w.send(errorResponse(http.StatusBadRequest, "Invalid JSON"))
+			}
+			return
+		}
+
+		// Requests on one connection are handled concurrently; responses
+		// carry the request ID so they may be written back out of order.
+		wg.Add(1)
+		go func(req request) {
+			defer wg.Done()
+			if req.Action == "SUBSCRIBE" {
+				s.handleSubscribe(req, w, state)
+				return
+			}
+
+			var response map[string]interface{}
+			if req.Action == "UNSUBSCRIBE" {
+				response = s.handleUnsubscribe(req, state)
+			} else {
+				response = s.handleRequest(req)
+			}
+			if req.ID != 0 {
+				response["id"] = req.ID
+			}
+			w.send(response)
+		}(req)
 	}
+}
 
-	response := map[string]interface{}{"status": "error", "message": "Unknown action"}
+func (s *Server) handleRequest(req request) map[string]interface{} {
+	response := errorResponse(http.StatusBadRequest, "Unknown action")
 
 	switch req.Action {
 	case "PING":
@@ -165,25 +348,95 @@ func (s *Server) handleConnection(conn net.Conn) {
 		if workingDir == "" {
 			workingDir = config.ProjectRoot
 		}
-
-		if sm, exists := s.sessions[req.SessionID]; exists {
-			sm.UpdateWorkingDir(workingDir)
-			log.Printf("Updated working dir for session %s to %s", req.SessionID, workingDir)
-		} else {
-			sm := manager.NewSessionManager(req.SessionID, workingDir, nil)
-			s.setupStatePersistence(sm)
-			sm.Start()
-			s.sessions[req.SessionID] = sm
-			log.Printf("Started manager for session %s with dir %s", req.SessionID, workingDir)
+		if s.registry != nil {
+			if session, err := s.registry.FindByID(req.SessionID); err == nil && session.Archived {
+				response = errorResponse(http.StatusConflict, archivedMessage(session))
+				break
+			}
 		}
+
+		s.startManager(req.SessionID, workingDir)
 		response = map[string]interface{}{"status": "ok", "message": "Session managed"}
 
 	case "GET_STATUS":
-		if sm, ok := s.sessions[req.SessionID]; ok {
+		if sm, ok := s.getSession(req.SessionID); ok {
 			response = map[string]interface{}{"status": "ok", "data": sm.GetSnapshot()}
 		} else {
-			response = map[string]interface{}{"status": "error", "message": "Session not found"}
+			response = errorResponse(http.StatusNotFound, "Session not found")
+		}
+
+	case "GET_DIFF":
+		sm, ok := s.getSession(req.SessionID)
+		if !ok {
+			response = errorResponse(http.StatusNotFound, "Session not found")
+			break
+		}
+
+		messageID, _ := req.Payload["messageID"].(string)
+		diffs, err := sm.Diff(messageID)
+		if err != nil {
+			response = errorResponse(http.StatusBadGateway, "Failed to get diff: "+err.Error())
+			break
+		}
+		if diffs == nil {
+			diffs = []api.FileDiff{}
+		}
+		response = map[string]interface{}{"status": "ok", "data": diffs}
+
+	case "GET_HISTORY":
+		sm, ok := s.getSession(req.SessionID)
+		if !ok {
+			response = errorResponse(http.StatusNotFound, "Session not found")
+			break
+		}
+
+		limit, err := limitFromPayload(req.Payload["limit"])
+		if err != nil {
+			response = errorResponse(http.StatusBadRequest, err.Error())
+			break
+		}
+		messages, err := sm.History(limit)
+		if err != nil {
+			response = errorResponse(http.StatusBadGateway, "Failed to get history: "+err.Error())
+			break
+		}
+		if messages == nil {
+			messages = []api.MessageWithParts{}
+		}
+		response = map[string]interface{}{"status": "ok", "data": messages}
+
+	case "GET_MESSAGE":
+		sm, ok := s.getSession(req.SessionID)
+		if !ok {
+			response = errorResponse(http.StatusNotFound, "Session not found")
+			break
+		}
+
+		messageID, _ := req.Payload["messageID"].(string)
+		if messageID == "" {
+			response = errorResponse(http.StatusBadRequest, "messageID is required")
+			break
+		}
+		message, err := sm.Message(messageID)
+		if err != nil {
+			response = errorResponse(http.StatusBadGateway, "Failed to get message: "+err.Error())
+			break
 		}
+		response = map[string]interface{}{"status": "ok", "data": message}
+
+	case "LIST_AGENTS":
+		sm, ok := s.getSession(req.SessionID)
+		if !ok {
+			response = errorResponse(http.StatusNotFound, "Session not found")
+			break
+		}
+
+		agents, err := sm.Agents()
+		if err != nil {
+			response = errorResponse(http.StatusBadGateway, "Failed to list agents: "+err.Error())
+			break
+		}
+		response = map[string]interface{}{"status": "ok", "data": agents}
 
 	case "INIT_SESSION":
 		project, _ := req.Payload["project"].(string)
@@ -191,7 +444,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 		workingDir, _ := req.Payload["working_dir"].(string)
 
 		if project == "" || sessionName == "" {
-			response = map[string]interface{}{"status": "error", "message": "project and session_name are required"}
+			response = errorResponse(http.StatusBadRequest, "project and session_name are required")
 			break
 		}
 
@@ -199,9 +452,20 @@ func (s *Server) handleConnection(conn net.Conn) {
 			workingDir = config.ProjectRoot
 		}
 
+		permissionPolicy, err := policyFromPayload(req.Payload["permission_policy"])
+		if err != nil {
+			response = errorResponse(http.StatusBadRequest, err.Error())
+			break
+		}
+		autoCompact, err := autoCompactFromPayload(req.Payload["auto_compact"])
+		if err != nil {
+			response = errorResponse(http.StatusBadRequest, err.Error())
+			break
+		}
+
 		if existing, err := s.registry.Get(project, sessionName); err == nil {
 			log.Printf("Session %s/%s exists, aborting old session %s", project, sessionName, existing.ID)
-			if err := api.NewClient(existing.WorkingDir).AbortSession(existing.ID); err != nil {
+			if err := s.apiClient(existing.WorkingDir).AbortSession(existing.ID); err != nil {
 				log.Printf("Failed to abort old session: %v", err)
 			}
 			if err := s.registry.Delete(project, sessionName); err != nil {
@@ -209,39 +473,165 @@ func (s *Server) handleConnection(conn net.Conn) {
 			}
 		}
 
-		client := api.NewClient(workingDir)
+		client := s.apiClient(workingDir)
 		sessionID, err := client.CreateSession(sessionName)
 		if err != nil {
-			response = map[string]interface{}{"status": "error", "message": "Failed to create session: " + err.Error()}
+			response = errorResponse(http.StatusBadGateway, "Failed to create session: "+err.Error())
 			break
 		}
 
 		if err := s.registry.Create(project, sessionName, sessionID, workingDir); err != nil {
 			log.Printf("Failed to save session to registry: %v", err)
-			response = map[string]interface{}{"status": "error", "message": "Failed to save session: " + err.Error()}
+			response = errorResponse(http.StatusInternalServerError, "Failed to save session: "+err.Error())
 			break
 		}
+		if permissionPolicy != "" {
+			if err := s.registry.UpdatePermissionPolicy(project, sessionName, permissionPolicy); err != nil {
+				response = errorResponse(http.StatusInternalServerError, "Failed to save permission policy: "+err.Error())
+				break
+			}
+		}
+		if autoCompact != 0 {
+			if err := s.registry.UpdateAutoCompact(project, sessionName, autoCompact); err != nil {
+				response = errorResponse(http.StatusInternalServerError, "Failed to save auto-compaction threshold: "+err.Error())
+				break
+			}
+		}
 
 		log.Printf("Initialized session %s/%s with ID %s", project, sessionName, sessionID)
 		response = map[string]interface{}{"status": "ok", "session_id": sessionID}
 
+	case "FORK_SESSION":
+		project, _ := req.Payload["project"].(string)
+		sessionName, _ := req.Payload["session_name"].(string)
+		newSessionName, _ := req.Payload["new_session_name"].(string)
+		messageID, _ := req.Payload["message_id"].(string)
+
+		if project == "" || sessionName == "" || newSessionName == "" {
+			response = errorResponse(http.StatusBadRequest, "project, session_name and new_session_name are required")
+			break
+		}
+
+		parent, err := s.registry.Get(project, sessionName)
+		if err != nil {
+			response = errorResponse(http.StatusNotFound, "Session not found")
+			break
+		}
+		// OpenCode creates the fork in the parent's project, so it works in
+		// the parent's directory
+		workingDir := parent.WorkingDir
+		if _, err := s.registry.Get(project, newSessionName); err == nil {
+			response = errorResponse(http.StatusConflict, fmt.Sprintf("Session %s/%s already exists", project, newSessionName))
+			break
+		}
+
+		sessionID, err := s.apiClient(parent.WorkingDir).ForkSession(parent.ID, messageID)
+		if err != nil {
+			response = errorResponse(http.StatusBadGateway, "Failed to fork session: "+err.Error())
+			break
+		}
+
+		if err := s.registry.Create(project, newSessionName, sessionID, workingDir); err != nil {
+			log.Printf("Failed to save forked session to registry: %v", err)
+			response = errorResponse(http.StatusInternalServerError, "Failed to save session: "+err.Error())
+			break
+		}
+		// The fork runs under the same rules as its parent
+		if parent.PermissionPolicy != "" {
+			if err := s.registry.UpdatePermissionPolicy(project, newSessionName, parent.PermissionPolicy); err != nil {
+				log.Printf("Failed to copy permission policy to %s/%s: %v", project, newSessionName, err)
+			}
+		}
+		if parent.AutoCompact != 0 {
+			if err := s.registry.UpdateAutoCompact(project, newSessionName, parent.AutoCompact); err != nil {
+				log.Printf("Failed to copy auto-compaction threshold to %s/%s: %v", project, newSessionName, err)
+			}
+		}
+		s.startManager(sessionID, workingDir)
+
+		log.Printf("Forked session %s/%s (%s) into %s/%s with ID %s", project, sessionName, parent.ID, project, newSessionName, sessionID)
+		response = map[string]interface{}{"status": "ok", "session_id": sessionID, "working_dir": workingDir}
+
+	case "LIST_REMOTE_SESSIONS":
+		workingDir, _ := req.Payload["working_dir"].(string)
+		sessions, err := s.remoteSessions(workingDir)
+		if err != nil {
+			response = errorResponse(http.StatusBadGateway, "Failed to list OpenCode sessions: "+err.Error())
+			break
+		}
+		response = map[string]interface{}{"status": "ok", "data": sessions}
+
+	case "ADOPT_SESSION":
+		project, _ := req.Payload["project"].(string)
+		sessionName, _ := req.Payload["session_name"].(string)
+		sessionID, _ := req.Payload["opencode_session_id"].(string)
+		workingDir, _ := req.Payload["working_dir"].(string)
+
+		if project == "" || sessionName == "" || sessionID == "" {
+			response = errorResponse(http.StatusBadRequest, "project, session_name and opencode_session_id are required")
+			break
+		}
+		if _, err := s.registry.Get(project, sessionName); err == nil {
+			response = errorResponse(http.StatusConflict, fmt.Sprintf("Session %s/%s already exists", project, sessionName))
+			break
+		}
+		if existing, err := s.registry.FindByID(sessionID); err == nil {
+			response = errorResponse(http.StatusConflict, fmt.Sprintf("OpenCode session %s is already registered as %s/%s", sessionID, existing.Project, existing.SessionName))
+			break
+		}
+
+		client := s.apiClient(workingDir)
+		remote, err := client.GetSession(sessionID)
+		if err != nil {
+			response = errorResponse(http.StatusBadGateway, fmt.Sprintf("Failed to look up OpenCode session %s: %v", sessionID, err))
+			break
+		}
+		if remote.ParentID != "" {
+			response = errorResponse(http.StatusBadRequest, fmt.Sprintf("OpenCode session %s is a subagent session of %s; adopt that one instead", sessionID, remote.ParentID))
+			break
+		}
+		if workingDir == "" {
+			workingDir = remote.Directory
+		}
+		if workingDir == "" {
+			response = errorResponse(http.StatusBadGateway, fmt.Sprintf("OpenCode did not report the directory of session %s; pass working_dir", sessionID))
+			break
+		}
+		if err := s.registry.Create(project, sessionName, sessionID, workingDir); err != nil {
+			log.Printf("Failed to save adopted session to registry: %v", err)
+			response = errorResponse(http.StatusInternalServerError, "Failed to save session: "+err.Error())
+			break
+		}
+		sm := s.startManager(sessionID, workingDir)
+
+		// The session may be running a task started in OpenCode; follow it
+		// rather than report the session idle
+		if statuses, err := client.GetSessionStatus(); err != nil {
+			log.Printf("Failed to load the status of adopted session %s: %v", sessionID, err)
+		} else {
+			sm.FollowRemoteStatus(statuses)
+		}
+
+		log.Printf("Adopted OpenCode session %s as %s/%s in %s", sessionID, project, sessionName, workingDir)
+		response = map[string]interface{}{"status": "ok", "session_id": sessionID, "working_dir": workingDir}
+
 	case "ABORT_SESSION":
 		project, _ := req.Payload["project"].(string)
 		sessionName, _ := req.Payload["session_name"].(string)
 
 		if project == "" || sessionName == "" {
-			response = map[string]interface{}{"status": "error", "message": "project and session_name are required"}
+			response = errorResponse(http.StatusBadRequest, "project and session_name are required")
 			break
 		}
 
 		session, err := s.registry.Get(project, sessionName)
 		if err != nil {
-			response = map[string]interface{}{"status": "error", "message": "Session not found"}
+			response = errorResponse(http.StatusNotFound, "Session not found")
 			break
 		}
 
 		// Call remote abort
-		abortErr := api.NewClient(session.WorkingDir).AbortSession(session.ID)
+		abortErr := s.apiClient(session.WorkingDir).AbortSession(session.ID)
 		if abortErr != nil {
 			log.Printf("Warning: Failed to abort remote session: %v", abortErr)
 		} else {
@@ -250,7 +640,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 		}
 
 		// Reset local manager state
-		if sm, exists := s.sessions[session.ID]; exists {
+		if sm, exists := s.getSession(session.ID); exists {
 			sm.AbortTask()
 		}
 
@@ -261,10 +651,131 @@ func (s *Server) handleConnection(conn net.Conn) {
 			response = map[string]interface{}{"status": "ok", "message": "Session aborted and ready for new input"}
 		}
 
+	case "DELETE_SESSION":
+		project, _ := req.Payload["project"].(string)
+		sessionName, _ := req.Payload["session_name"].(string)
+		remote, _ := req.Payload["remote"].(bool)
+
+		if project == "" || sessionName == "" {
+			response = errorResponse(http.StatusBadRequest, "project and session_name are required")
+			break
+		}
+
+		session, err := s.registry.Get(project, sessionName)
+		if err != nil {
+			response = errorResponse(http.StatusNotFound, "Session not found")
+			break
+		}
+
+		if err := s.deleteSession(session, remote); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, errRemoteDelete) {
+				code = http.StatusBadGateway
+			}
+			response = errorResponse(code, err.Error())
+			break
+		}
+
+		message := "Session deleted"
+		if remote {
+			message = "Session deleted here and in OpenCode"
+		}
+		response = map[string]interface{}{"status": "ok", "message": message}
+
+	case "ARCHIVE_SESSION":
+		project, _ := req.Payload["project"].(string)
+		sessionName, _ := req.Payload["session_name"].(string)
+		archived, ok := req.Payload["archived"].(bool)
+		if !ok {
+			archived = true
+		}
+
+		if project == "" || sessionName == "" {
+			response = errorResponse(http.StatusBadRequest, "project and session_name are required")
+			break
+		}
+
+		session, err := s.registry.Get(project, sessionName)
+		if err != nil {
+			response = errorResponse(http.StatusNotFound, "Session not found")
+			break
+		}
+
+		if archived {
+			// Nothing would be left to finish the task and record its result
+			if sm, ok := s.getSession(session.ID); ok {
+				if state := sm.GetSnapshot().State; state != manager.StateIdle {
+					response = errorResponse(http.StatusConflict, fmt.Sprintf("Session is %s; wait for the task to finish or abort it first.", state))
+					break
+				}
+			}
+		}
+		if err := s.registry.UpdateArchived(project, sessionName, archived); err != nil {
+			response = errorResponse(http.StatusInternalServerError, "Failed to archive session: "+err.Error())
+			break
+		}
+
+		message := "Session restored"
+		if archived {
+			s.stopManager(session.ID)
+			message = "Session archived"
+		}
+		log.Printf("%s: %s/%s", message, project, sessionName)
+		response = map[string]interface{}{"status": "ok", "message": message}
+
+	case "PRUNE_SESSIONS":
+		olderThan, _ := req.Payload["older_than"].(string)
+		remote, _ := req.Payload["remote"].(bool)
+		dryRun, _ := req.Payload["dry_run"].(bool)
+
+		age, err := parseAge(olderThan)
+		if err != nil {
+			response = errorResponse(http.StatusBadRequest, err.Error())
+			break
+		}
+
+		sessions, err := s.registry.List()
+		if err != nil {
+			response = errorResponse(http.StatusInternalServerError, "Failed to list sessions: "+err.Error())
+			break
+		}
+
+		pruned := []SessionData{}
+		var failed []string
+		cutoff := time.Now().Add(-age)
+		for _, session := range sessions {
+			// Sessions that never recorded activity have no age to go by
+			lastActivity, err := time.Parse(time.RFC3339, session.LastActivity)
+			if err != nil || !lastActivity.Before(cutoff) {
+				continue
+			}
+			if sm, ok := s.getSession(session.ID); ok && sm.GetSnapshot().State != manager.StateIdle {
+				continue
+			}
+			if !dryRun {
+				if err := s.deleteSession(&session, remote); err != nil {
+					failed = append(failed, fmt.Sprintf("%s/%s: %v", session.Project, session.SessionName, err))
+					continue
+				}
+			}
+			pruned = append(pruned, session)
+		}
+
+		verb := "Pruned"
+		if dryRun {
+			verb = "Would prune"
+		}
+		message := fmt.Sprintf("%s %d session(s) inactive for %s", verb, len(pruned), olderThan)
+		if len(failed) > 0 {
+			message += "; failed: " + strings.Join(failed, "; ")
+		}
+		log.Print(message)
+		response = map[string]interface{}{"status": "ok", "message": message, "data": pruned}
+
 	case "LIST_SESSIONS":
 		sessions, err := s.registry.List()
 		if err != nil {
-			response = map[string]interface{}{"status": "error", "message": "Failed to list sessions: " + err.Error()}
+			response = errorResponse(http.StatusInternalServerError, "Failed to list sessions: "+err.Error())
 			break
 		}
 		response = map[string]interface{}{"status": "ok", "sessions": sessions}
@@ -274,19 +785,49 @@ func (s *Server) handleConnection(conn net.Conn) {
 		sessionName, _ := req.Payload["session_name"].(string)
 
 		if project == "" || sessionName == "" {
-			response = map[string]interface{}{"status": "error", "message": "project and session_name are required"}
+			response = errorResponse(http.StatusBadRequest, "project and session_name are required")
 			break
 		}
 
 		session, err := s.registry.Get(project, sessionName)
 		if err != nil {
-			response = map[string]interface{}{"status": "error", "message": "not found"}
+			response = errorResponse(http.StatusNotFound, "not found")
 			break
 		}
 		response = map[string]interface{}{"status": "ok", "session": session}
 
-	case "PROMPT", "COMMAND", "ANSWER", "FIX":
-		if sm, ok := s.sessions[req.SessionID]; ok {
+	case "SET_AUTO_COMPACT":
+		sm, ok := s.getSession(req.SessionID)
+		if !ok {
+			response = errorResponse(http.StatusNotFound, "Session not found")
+			break
+		}
+
+		percent, err := autoCompactFromPayload(req.Payload["percent"])
+		if err != nil {
+			response = errorResponse(http.StatusBadRequest, err.Error())
+			break
+		}
+		if s.registry != nil {
+			session, err := s.registry.FindByID(req.SessionID)
+			if err == nil {
+				err = s.registry.UpdateAutoCompact(session.Project, session.SessionName, percent)
+			}
+			if err != nil {
+				response = errorResponse(http.StatusInternalServerError, "Failed to save auto-compaction threshold: "+err.Error())
+				break
+			}
+		}
+		sm.SetAutoCompact(percent)
+
+		message := "Auto-compaction off"
+		if percent != 0 {
+			message = fmt.Sprintf("Auto-compaction at %d%% of the context window", percent)
+		}
+		response = map[string]interface{}{"status": "ok", "message": message}
+
+	case "PROMPT", "COMMAND", "SHELL", "ANSWER", "REJECT", "PERMIT", "UNDO", "REDO", "COMPACT", "FIX":
+		if sm, ok := s.getSession(req.SessionID); ok {
 			// Extract text content for special handling regarding busy state and agent locking
 			targetText := ""
 			if req.Action == "PROMPT" {
@@ -317,10 +858,17 @@ func (s *Server) handleConnection(conn net.Conn) {
 				}
 			}
 
-			// Verify BUSY state for PROMPT
-			if req.Action == "PROMPT" {
-				snapshot := sm.GetSnapshot()
-				state, _ := snapshot["state"].(manager.State)
+			if req.Action == "SHELL" {
+				if cmd, _ := req.Payload["command"].(string); strings.TrimSpace(cmd) == "" {
+					response = errorResponse(http.StatusBadRequest, "command is required")
+					break
+				}
+			}
+
+			// Verify BUSY state for PROMPT and SHELL. A shell command runs as
+			// a turn of its own and must not interleave with a running one.
+			if req.Action == "PROMPT" || req.Action == "SHELL" {
+				state := sm.GetSnapshot().State
 
 				// Check if special prompt
 				isSpecial := false
@@ -328,13 +876,27 @@ func (s *Server) handleConnection(conn net.Conn) {
 					isSpecial = true
 				}
 
-				if state == manager.StateBusy && !isSpecial {
-					response = map[string]interface{}{"status": "error", "message": "Session is busy. Please patience wait for the previous message result before send new message."}
+				if (state == manager.StateBusy || state == manager.StateWaitingForPermission) && !isSpecial {
+					response = errorResponse(http.StatusConflict, "Session is busy. Please wait for the result of the previous message before sending a new one.")
 					break // break switch, send response
 				}
 			}
 
-			if req.Action == "PROMPT" || req.Action == "COMMAND" {
+			// OpenCode refuses to revert a session while it works, and
+			// compacting mid-task would summarize a half-finished turn
+			if req.Action == "UNDO" || req.Action == "REDO" || req.Action == "COMPACT" {
+				snap := sm.GetSnapshot()
+				if snap.State != manager.StateIdle {
+					response = errorResponse(http.StatusConflict, fmt.Sprintf("Session is %s; wait for the task to finish or abort it first.", snap.State))
+					break
+				}
+				if req.Action == "REDO" && snap.Revert == nil {
+					response = errorResponse(http.StatusConflict, "Nothing to redo")
+					break
+				}
+			}
+
+			if req.Action == "PROMPT" || req.Action == "COMMAND" || req.Action == "SHELL" {
 				if sessionData, err := s.registry.FindByID(req.SessionID); err == nil {
 					if sessionData.IsAgentLocked && sessionData.LastAgent != "" {
 						req.Payload["agent"] = sessionData.LastAgent
@@ -355,30 +917,315 @@ func (s *Server) handleConnection(conn net.Conn) {
 				var p types.CommandRequest
 				json.Unmarshal(payloadBytes, &p)
 				internalPayload = p
+			} else if req.Action == "SHELL" {
+				var p types.ShellRequest
+				json.Unmarshal(payloadBytes, &p)
+				internalPayload = p
 			} else if req.Action == "ANSWER" {
 				var p types.AnswerRequest
 				json.Unmarshal(payloadBytes, &p)
+				var pending *api.Question
+				for _, q := range sm.GetSnapshot().Questions {
+					if q.ID == p.RequestID {
+						pending = &q
+						break
+					}
+				}
+				if pending == nil {
+					response = errorResponse(http.StatusConflict, "No pending question "+p.RequestID)
+					break
+				}
+				if err := pending.CheckAnswers(p.Answers); err != nil {
+					response = errorResponse(http.StatusBadRequest, err.Error())
+					break
+				}
+				internalPayload = p
+			} else if req.Action == "REJECT" {
+				var p types.RejectRequest
+				json.Unmarshal(payloadBytes, &p)
+				pending := false
+				for _, q := range sm.GetSnapshot().Questions {
+					if p.RequestID == "" || q.ID == p.RequestID {
+						pending = true
+						break
+					}
+				}
+				if !pending {
+					response = errorResponse(http.StatusConflict, "No pending question to reject")
+					break
+				}
+				internalPayload = p
+			} else if req.Action == "UNDO" {
+				var p types.RevertRequest
+				json.Unmarshal(payloadBytes, &p)
+				internalPayload = p
+			} else if req.Action == "COMPACT" {
+				var p types.CompactRequest
+				json.Unmarshal(payloadBytes, &p)
+				p.Auto = false
+				internalPayload = p
+			} else if req.Action == "PERMIT" {
+				var p types.PermitRequest
+				json.Unmarshal(payloadBytes, &p)
+				if p.Reply != "once" && p.Reply != "always" && p.Reply != "reject" {
+					response = errorResponse(http.StatusBadRequest, "reply must be once, always or reject")
+					break
+				}
+				if len(sm.GetSnapshot().Permissions) == 0 {
+					response = errorResponse(http.StatusConflict, "No pending permissions")
+					break
+				}
 				internalPayload = p
 			}
 
+			// Permission replies, rejections and reverts are sent before
+			// responding, so one OpenCode refused is reported instead of
+			// "submitted"
+			if action, ok := syncActions[req.Action]; ok {
+				result := make(chan error, 1)
+				sm.SubmitRequest(manager.Request{Type: req.Action, Payload: internalPayload, ResultChan: result})
+				switch err := <-result; {
+				case errors.Is(err, manager.ErrNothingToUndo):
+					response = errorResponse(http.StatusConflict, "Nothing to undo")
+				case err != nil:
+					response = errorResponse(http.StatusBadGateway, fmt.Sprintf("Failed to %s: %v", action.what, err))
+				default:
+					response = map[string]interface{}{"status": "ok", "message": action.done}
+				}
+				break
+			}
+
 			sm.SubmitRequest(manager.Request{Type: req.Action, Payload: internalPayload})
 			response = map[string]interface{}{"status": "ok", "message": "Request submitted"}
 
 		} else {
-			response = map[string]interface{}{"status": "error", "message": "Session not found"}
+			response = errorResponse(http.StatusNotFound, "Session not found")
 		}
 	}
 
-	s.sendResponse(conn, response)
+	return response
 }
 
-func (s *Server) sendResponse(conn net.Conn, resp map[string]interface{}) {
-	bytes, _ := json.Marshal(resp)
-	conn.Write(bytes)
+// startManager starts a SessionManager for the session, or points the
+// existing one at workingDir.
+func (s *Server) startManager(sessionID, workingDir string) *manager.SessionManager {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sm, exists := s.sessions[sessionID]; exists {
+		sm.UpdateWorkingDir(workingDir)
+		log.Printf("Updated working dir for session %s to %s", sessionID, workingDir)
+		return sm
+	}
+
+	sm := manager.NewSessionManager(sessionID, workingDir, nil)
+	if s.registry != nil {
+		if session, err := s.registry.FindByID(sessionID); err == nil {
+			setPolicy(sm, session.PermissionPolicy)
+			sm.SetAutoCompact(session.AutoCompact)
+		}
+	}
+	s.setupStatePersistence(sm)
+	sm.Start()
+	s.sessions[sessionID] = sm
+	log.Printf("Started manager for session %s with dir %s", sessionID, workingDir)
+
+	// Pick up questions, todos and the revert point from before the manager
+	// existed
+	go func() {
+		sm.SyncTodos()
+		sm.SyncRevert()
+		questions, err := s.apiClient(workingDir).GetQuestions()
+		if err != nil {
+			log.Printf("Failed to load questions for session %s: %v", sessionID, err)
+			return
+		}
+		sm.SyncQuestions(questions)
+	}()
+	return sm
 }
 
-func (s *Server) sendError(conn net.Conn, msg string) {
-	s.sendResponse(conn, map[string]interface{}{"status": "error", "message": msg})
+// archivedMessage tells how to use an archived session again.
+func archivedMessage(session *SessionData) string {
+	return fmt.Sprintf("Session %s/%s is archived; run archive-session %s %s --undo to use it again", session.Project, session.SessionName, session.Project, session.SessionName)
+}
+
+// apiClient returns an OpenCode client working in workingDir.
+func (s *Server) apiClient(workingDir string) *api.Client {
+	client := api.NewClient(workingDir)
+	if s.openCodeURL != "" {
+		client.BaseURL = s.openCodeURL
+	}
+	return client
+}
+
+// errRemoteDelete marks a failure to delete a session in OpenCode.
+var errRemoteDelete = errors.New("failed to delete OpenCode session")
+
+// deleteSession stops the session's manager and removes it from the
+// registry. With remote, OpenCode deletes the session first; otherwise a task
+// still running there is aborted rather than left unattended.
+func (s *Server) deleteSession(session *SessionData, remote bool) error {
+	client := s.apiClient(session.WorkingDir)
+	if remote {
+		if err := client.DeleteSession(session.ID); err != nil {
+			return fmt.Errorf("%w: %v", errRemoteDelete, err)
+		}
+	} else if sm, ok := s.getSession(session.ID); ok && sm.GetSnapshot().State != manager.StateIdle {
+		if err := client.AbortSession(session.ID); err != nil {
+			log.Printf("Failed to abort session %s before deleting it: %v", session.ID, err)
+		}
+	}
+
+	s.stopManager(session.ID)
+	if err := s.registry.Delete(session.Project, session.SessionName); err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+	log.Printf("Deleted session %s/%s (ID: %s)", session.Project, session.SessionName, session.ID)
+	return nil
+}
+
+// stopManager stops the session's manager, if one runs.
+func (s *Server) stopManager(sessionID string) {
+	s.mu.Lock()
+	sm, ok := s.sessions[sessionID]
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+
+	if ok {
+		sm.Stop()
+		log.Printf("Stopped manager for session %s", sessionID)
+	}
+}
+
+// parseAge parses a prune age: a Go duration such as 36h, or a whole number
+// of days or weeks such as 14d or 2w.
+func parseAge(s string) (time.Duration, error) {
+	var age time.Duration
+	var err error
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		var days int
+		days, err = strconv.Atoi(n)
+		age = time.Duration(days) * 24 * time.Hour
+	} else if n, ok := strings.CutSuffix(s, "w"); ok {
+		var weeks int
+		weeks, err = strconv.Atoi(n)
+		age = time.Duration(weeks) * 7 * 24 * time.Hour
+	} else {
+		age, err = time.ParseDuration(s)
+	}
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("older_than must be a positive age such as 14d, 2w or 36h, got %q", s)
+	}
+	return age, nil
+}
+
+// remoteSessions lists the top-level OpenCode sessions of the project that
+// workingDir belongs to, most recently updated first. Subagent sessions are
+// left out; they are driven by their parent.
+func (s *Server) remoteSessions(workingDir string) ([]api.SessionResponse, error) {
+	all, err := s.apiClient(workingDir).ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	sessions := []api.SessionResponse{}
+	for _, session := range all {
+		if session.ParentID == "" {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].Time.Updated > sessions[j].Time.Updated })
+	return sessions, nil
+}
+
+// limitFromPayload validates a GET_HISTORY message limit, 0 for all.
+func limitFromPayload(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if v == float64(int(v)) && v >= 0 {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("limit must be a non-negative integer")
+}
+
+// autoCompactFromPayload validates an auto-compaction threshold: a share of
+// the context window in percent, or 0 for off.
+func autoCompactFromPayload(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if v == float64(int(v)) && v >= 0 && v <= 100 {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("auto_compact must be a percentage from 1 to 100, or 0 for off")
+}
+
+// policyFromPayload validates an INIT_SESSION permission_policy, given as
+// a rule list or as its JSON encoding, and returns it as stored in the
+// registry.
+func policyFromPayload(v interface{}) (string, error) {
+	var data string
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		data = v
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		data = string(raw)
+	}
+
+	p, err := policy.Parse(data)
+	if err != nil || len(p) == 0 {
+		return "", err
+	}
+	raw, err := json.Marshal(p)
+	return string(raw), err
+}
+
+// setPolicy gives sm the permission policy stored in the registry. A policy
+// that no longer parses is logged and ignored, leaving requests to a human.
+func setPolicy(sm *manager.SessionManager, stored string) {
+	p, err := policy.Parse(stored)
+	if err != nil {
+		log.Printf("Session %s: ignoring permission policy: %v", sm.SessionID, err)
+		return
+	}
+	if len(p) > 0 {
+		log.Printf("Session %s: permission policy with %d rule(s)", sm.SessionID, len(p))
+	}
+	sm.SetPolicy(p)
+}
+
+// syncActions are the session actions the daemon waits on before
+// responding, so an error from OpenCode reaches the caller: what each one
+// does, for the error, and the message it succeeds with.
+var syncActions = map[string]struct{ what, done string }{
+	"PERMIT": {"reply to permission", "Permission replied"},
+	"REJECT": {"reject question", "Question rejected"},
+	"UNDO":   {"undo", "Undone"},
+	"REDO":   {"redo", "Redone"},
+}
+
+// errorResponse builds an error response. The code is an HTTP status code,
+// used as-is by the HTTP API and informational on the socket protocol.
+func errorResponse(code int, message string) map[string]interface{} {
+	return map[string]interface{}{"status": "error", "message": message, "code": code}
+}
+
+func (s *Server) getSession(sessionID string) (*manager.SessionManager, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sm, ok := s.sessions[sessionID]
+	return sm, ok
 }
 
 func (s *Server) writePID() error {
@@ -386,14 +1233,20 @@ func (s *Server) writePID() error {
 	return os.WriteFile(config.PidFile, []byte(fmt.Sprintf("%d", pid)), 0644)
 }
 
-func isDaemonRunning() bool {
-	addr := net.JoinHostPort(config.DaemonHost, strconv.Itoa(config.DaemonPort))
-	conn, err := net.Dial("tcp", addr)
-	if err == nil {
+func (s *Server) isDaemonRunning() bool {
+	if conn, err := net.Dial("unix", s.socketPath); err == nil {
 		conn.Close()
 		return true
 	}
 
+	if s.port != 0 {
+		addr := net.JoinHostPort(config.DaemonHost, strconv.Itoa(s.port))
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return true
+		}
+	}
+
 	pidBytes, err := os.ReadFile(config.PidFile)
 	if err != nil {
 		return false
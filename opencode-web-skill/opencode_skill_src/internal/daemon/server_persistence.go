@@ -5,8 +5,12 @@ import (
 	"opencode_skill/internal/manager"
 )
 
+// setupStatePersistence publishes every state change to subscribers and
+// persists it to the registry.
 func (s *Server) setupStatePersistence(sm *manager.SessionManager) {
 	sm.OnStateChange = func(state manager.PersistedState) {
+		s.publishState(sm.SessionID, state)
+
 		sessionData, err := s.registry.FindByID(sm.SessionID)
 		if err != nil {
 			log.Printf("Failed to find session %s for persistence: %v", sm.SessionID, err)
@@ -18,6 +22,10 @@ func (s *Server) setupStatePersistence(sm *manager.SessionManager) {
 		sessionData.State = state.State
 		sessionData.LatestResponse = state.LatestResponse
 		sessionData.Questions = state.Questions
+		sessionData.Permissions = state.Permissions
+		sessionData.Todos = state.Todos
+		sessionData.Context = state.Context
+		sessionData.Revert = state.Revert
 		sessionData.LastActivity = state.LastActivity
 
 		if err := s.registry.UpdateSessionData(sessionData.Project, sessionData.SessionName, *sessionData); err != nil {
@@ -25,3 +33,20 @@ func (s *Server) setupStatePersistence(sm *manager.SessionManager) {
 		}
 	}
 }
+
+// persistedState is the manager state setupStatePersistence saved for the
+// session.
+func persistedState(session *SessionData) *manager.PersistedState {
+	return &manager.PersistedState{
+		LastAgent:      session.LastAgent,
+		IsAgentLocked:  session.IsAgentLocked,
+		State:          session.State,
+		LatestResponse: session.LatestResponse,
+		Questions:      session.Questions,
+		Permissions:    session.Permissions,
+		Todos:          session.Todos,
+		Context:        session.Context,
+		Revert:         session.Revert,
+		LastActivity:   session.LastActivity,
+	}
+}
@@ -1,14 +1,21 @@
 package daemon
 
 import (
+	"encoding/json"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"opencode_skill/internal/api"
 	"opencode_skill/internal/config"
+	"opencode_skill/internal/manager"
 )
 
 func freePort() (int, error) {
@@ -24,6 +31,15 @@ func freePort() (int, error) {
 	return l.Addr().(*net.TCPAddr).Port, nil
 }
 
+// newTestServer creates a server on a socket under t.TempDir, so tests never
+// touch the user's daemon socket.
+func newTestServer(t *testing.T, registry *Registry) *Server {
+	t.Helper()
+	s := NewServer(registry)
+	s.SetSocketPath(filepath.Join(t.TempDir(), "daemon.sock"))
+	return s
+}
+
 func cleanupPID() {
 	os.Remove(config.PidFile)
 }
@@ -37,7 +53,9 @@ func TestServer_SingletonEnforcement(t *testing.T) {
 		t.Fatalf("Failed to create registry: %v", err)
 	}
 
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
 	s1 := NewServer(registry)
+	s1.SetSocketPath(socketPath)
 
 	errChan := make(chan error, 1)
 	go func() {
@@ -55,6 +73,7 @@ func TestServer_SingletonEnforcement(t *testing.T) {
 	}
 
 	s2 := NewServer(registry)
+	s2.SetSocketPath(socketPath)
 	err = s2.Start()
 
 	if err == nil {
@@ -65,3 +84,761 @@ func TestServer_SingletonEnforcement(t *testing.T) {
 		t.Errorf("Expected 'already running' error, got: %v", err)
 	}
 }
+
+func TestServer_HandleConnection_MultipleFrames(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t, nil)
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	go s.handleConnection(serverConn)
+
+	// A payload well beyond the old 4096-byte read buffer
+	largeText := strings.Repeat("x", 64*1024)
+
+	go func() {
+		enc := json.NewEncoder(clientConn)
+		enc.Encode(map[string]interface{}{"id": 1, "action": "PING", "payload": map[string]interface{}{"text": largeText}})
+		enc.Encode(map[string]interface{}{"id": 2, "action": "NOPE"})
+	}()
+
+	dec := json.NewDecoder(clientConn)
+	got := map[float64]map[string]interface{}{}
+	for i := 0; i < 2; i++ {
+		var resp map[string]interface{}
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response %d: %v", i, err)
+		}
+		id, _ := resp["id"].(float64)
+		got[id] = resp
+	}
+
+	if got[1]["message"] != "PONG" {
+		t.Errorf("Expected PONG for request 1, got %v", got[1])
+	}
+	if got[2]["message"] != "Unknown action" {
+		t.Errorf("Expected Unknown action for request 2, got %v", got[2])
+	}
+}
+
+func TestServer_HandleConnection_InvalidJSON(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t, nil)
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	go s.handleConnection(serverConn)
+
+	go clientConn.Write([]byte("{not json}\n"))
+
+	var resp map[string]interface{}
+	if err := json.NewDecoder(clientConn).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp["message"] != "Invalid JSON" {
+		t.Errorf("Expected Invalid JSON error, got %v", resp)
+	}
+}
+
+func TestListenUnix_Permissions(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "daemon.sock")
+
+	// A stale socket from a crashed daemon must not block startup
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("listenUnix failed: %v", err)
+	}
+	defer ln.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat socket: %v", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		t.Errorf("Expected %s to be a socket, got mode %v", path, info.Mode())
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected socket mode 0600, got %o", perm)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to dial socket: %v", err)
+	}
+	conn.Close()
+}
+
+func TestListenUnix_KeepsLiveSocketAndFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.sock")
+	ln, err := listenUnix(live)
+	if err != nil {
+		t.Fatalf("listenUnix failed: %v", err)
+	}
+	defer ln.Close()
+
+	if _, err := listenUnix(live); err == nil {
+		t.Error("Expected listenUnix to refuse a socket another daemon listens on")
+	}
+	if conn, err := net.Dial("unix", live); err != nil {
+		t.Errorf("Live socket was replaced: %v", err)
+	} else {
+		conn.Close()
+	}
+
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("keep me"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if _, err := listenUnix(file); err == nil {
+		t.Error("Expected listenUnix to refuse a path that is not a socket")
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "keep me" {
+		t.Errorf("File was replaced: %q, %v", data, err)
+	}
+}
+
+func TestServer_Subscribe(t *testing.T) {
+	t.Parallel()
+
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	defer registry.Close()
+	if err := registry.Create("proj", "task", "ses_1", "/tmp"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	s := newTestServer(t, registry)
+	sm := manager.NewSessionManager("ses_1", "/tmp", nil)
+	s.setupStatePersistence(sm)
+	s.sessions["ses_1"] = sm
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	go s.handleConnection(serverConn)
+
+	enc := json.NewEncoder(clientConn)
+	dec := json.NewDecoder(clientConn)
+	go enc.Encode(map[string]interface{}{"id": 7, "action": "SUBSCRIBE", "session_id": "ses_1"})
+
+	var first map[string]interface{}
+	if err := dec.Decode(&first); err != nil {
+		t.Fatalf("Failed to decode initial event: %v", err)
+	}
+	data, _ := first["data"].(map[string]interface{})
+	if first["id"] != float64(7) || first["event"] != "state" || data["state"] != "IDLE" {
+		t.Fatalf("Expected initial IDLE state event for request 7, got %v", first)
+	}
+
+	go sm.AbortTask()
+
+	var next map[string]interface{}
+	if err := dec.Decode(&next); err != nil {
+		t.Fatalf("Failed to decode state event: %v", err)
+	}
+	data, _ = next["data"].(map[string]interface{})
+	latest, _ := data["latest_response"].(map[string]interface{})
+	if next["event"] != "state" || latest["status"] != "aborted" {
+		t.Fatalf("Expected aborted state event, got %v", next)
+	}
+
+	go enc.Encode(map[string]interface{}{"id": 8, "action": "UNSUBSCRIBE", "payload": map[string]interface{}{"subscription": 7}})
+
+	var sawEnd, sawAck bool
+	for i := 0; i < 2; i++ {
+		var resp map[string]interface{}
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		switch resp["id"] {
+		case float64(7):
+			sawEnd = resp["event"] == "end"
+		case float64(8):
+			sawAck = resp["status"] == "ok"
+		}
+	}
+	if !sawEnd || !sawAck {
+		t.Errorf("Expected end event and UNSUBSCRIBE ack, got end=%v ack=%v", sawEnd, sawAck)
+	}
+}
+
+func TestServer_SubscribeUnknownSession(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t, nil)
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	go s.handleConnection(serverConn)
+
+	go json.NewEncoder(clientConn).Encode(map[string]interface{}{"id": 1, "action": "SUBSCRIBE", "session_id": "missing"})
+
+	var resp map[string]interface{}
+	if err := json.NewDecoder(clientConn).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp["status"] != "error" || resp["message"] != "Session not found" {
+		t.Errorf("Expected Session not found error, got %v", resp)
+	}
+}
+
+func TestServer_PublishProgress(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t, nil)
+	plain := s.subscribe("ses_1", false)
+	follower := s.subscribe("ses_1", true)
+	defer s.unsubscribe(plain)
+	defer s.unsubscribe(follower)
+
+	ev := api.Event{Type: "message.part.updated", Properties: json.RawMessage(`{"part":{"sessionID":"ses_1","type":"text","text":"hi"}}`)}
+	s.publishProgress("ses_1", ev)
+
+	select {
+	case got := <-follower.progressEvents:
+		if got["event"] != "progress" || got["data"].(api.Event).Type != ev.Type {
+			t.Errorf("Expected progress event, got %v", got)
+		}
+	default:
+		t.Fatal("Expected the progress subscriber to receive the event")
+	}
+	select {
+	case got := <-plain.progressEvents:
+		t.Errorf("Expected no event for a state-only subscriber, got %v", got)
+	default:
+	}
+
+	// A chatty task leaves only its latest progress event queued and all of
+	// the state buffer to state events
+	for i := 0; i < subscriberBuffer; i++ {
+		s.publishProgress("ses_1", api.Event{Type: "message.part.updated", Properties: json.RawMessage(strconv.Itoa(i))})
+	}
+	for i := 0; i < subscriberBuffer; i++ {
+		s.publish("ses_1", "state", map[string]interface{}{"state": "BUSY"})
+	}
+	select {
+	case <-follower.done:
+		t.Fatal("Expected the progress subscriber to survive a chatty task")
+	default:
+	}
+	if n := len(follower.events); n != subscriberBuffer {
+		t.Errorf("Expected %d queued state events, got %d", subscriberBuffer, n)
+	}
+	got := <-follower.progressEvents
+	if last := string(got["data"].(api.Event).Properties); last != strconv.Itoa(subscriberBuffer-1) {
+		t.Errorf("Expected only the latest progress event, got %s", last)
+	}
+}
+
+func TestServer_HandleRequest_Permit(t *testing.T) {
+	t.Parallel()
+
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	defer registry.Close()
+
+	s := newTestServer(t, registry)
+	s.sessions["ses_1"] = manager.NewSessionManager("ses_1", "/tmp", nil)
+
+	tests := []struct {
+		name    string
+		payload map[string]interface{}
+		code    int
+	}{
+		{"invalid reply", map[string]interface{}{"reply": "maybe"}, 400},
+		{"nothing pending", map[string]interface{}{"reply": "once"}, 409},
+	}
+
+	for _, tt := range tests {
+		resp := s.handleRequest(request{Action: "PERMIT", SessionID: "ses_1", Payload: tt.payload})
+		if resp["status"] != "error" || resp["code"] != tt.code {
+			t.Errorf("%s: expected error %d, got %v", tt.name, tt.code, resp)
+		}
+	}
+}
+
+func TestServer_HandleRequest_InitSessionInvalidPolicy(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t, nil)
+	resp := s.handleRequest(request{Action: "INIT_SESSION", Payload: map[string]interface{}{
+		"project":           "proj",
+		"session_name":      "task",
+		"permission_policy": []interface{}{map[string]interface{}{"permission": "bash", "pattern": "*", "action": "deny"}},
+	}})
+
+	if resp["status"] != "error" || resp["code"] != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid policy, got %v", resp)
+	}
+}
+
+func TestServer_StartManager_LoadsPolicy(t *testing.T) {
+	t.Parallel()
+
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	defer registry.Close()
+	if err := registry.Create("proj", "task", "ses_1", "/tmp"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	stored, err := policyFromPayload([]interface{}{map[string]interface{}{"permission": "bash", "pattern": "go test*", "action": "allow"}})
+	if err != nil {
+		t.Fatalf("policyFromPayload failed: %v", err)
+	}
+	if stored != `[{"permission":"bash","pattern":"go test*","action":"allow"}]` {
+		t.Errorf("Unexpected stored policy %s", stored)
+	}
+	if err := registry.UpdatePermissionPolicy("proj", "task", stored); err != nil {
+		t.Fatalf("UpdatePermissionPolicy failed: %v", err)
+	}
+
+	s := newTestServer(t, registry)
+	sm := s.startManager("ses_1", "/tmp")
+	defer sm.Stop()
+
+	if got := sm.Policy(); len(got) != 1 || got[0].Pattern != "go test*" {
+		t.Errorf("Expected the stored policy on the manager, got %v", got)
+	}
+}
+
+func TestServer_HandleRequest_Answer(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t, nil)
+	sm := manager.NewSessionManager("ses_1", "/tmp", nil)
+	sm.SyncQuestions([]api.Question{{ID: "que_1", SessionID: "ses_1", Questions: []api.QuestionInfo{
+		{Question: "Which?", Options: []api.Option{{Label: "A"}, {Label: "B"}}, Custom: new(bool)},
+	}}})
+	s.sessions["ses_1"] = sm
+
+	tests := []struct {
+		name    string
+		payload map[string]interface{}
+		code    int
+	}{
+		{"unknown request", map[string]interface{}{"requestID": "que_9", "answers": []interface{}{[]interface{}{"A"}}}, 409},
+		{"not an option", map[string]interface{}{"requestID": "que_1", "answers": []interface{}{[]interface{}{"C"}}}, 400},
+		{"too many labels", map[string]interface{}{"requestID": "que_1", "answers": []interface{}{[]interface{}{"A", "B"}}}, 400},
+		{"missing answers", map[string]interface{}{"requestID": "que_1", "answers": []interface{}{}}, 400},
+	}
+
+	for _, tt := range tests {
+		resp := s.handleRequest(request{Action: "ANSWER", SessionID: "ses_1", Payload: tt.payload})
+		if resp["status"] != "error" || resp["code"] != tt.code {
+			t.Errorf("%s: expected error %d, got %v", tt.name, tt.code, resp)
+		}
+	}
+
+	resp := s.handleRequest(request{Action: "REJECT", SessionID: "ses_1", Payload: map[string]interface{}{"requestID": "que_9"}})
+	if resp["status"] != "error" || resp["code"] != 409 {
+		t.Errorf("Expected 409 rejecting an unknown request, got %v", resp)
+	}
+}
+
+func TestServer_HandleRequest_UndoRedo(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t, nil)
+	s.sessions["ses_1"] = manager.NewSessionManager("ses_1", "/tmp", nil)
+	waiting := manager.NewSessionManager("ses_2", "/tmp", nil)
+	waiting.SyncQuestions([]api.Question{{ID: "que_1", SessionID: "ses_2"}})
+	s.sessions["ses_2"] = waiting
+
+	tests := []struct {
+		name      string
+		action    string
+		sessionID string
+	}{
+		{"redo without a revert", "REDO", "ses_1"},
+		{"undo while waiting", "UNDO", "ses_2"},
+		{"redo while waiting", "REDO", "ses_2"},
+	}
+
+	for _, tt := range tests {
+		resp := s.handleRequest(request{Action: tt.action, SessionID: tt.sessionID, Payload: map[string]interface{}{}})
+		if resp["status"] != "error" || resp["code"] != http.StatusConflict {
+			t.Errorf("%s: expected error 409, got %v", tt.name, resp)
+		}
+	}
+}
+
+func TestServer_HandleRequest_Shell(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t, nil)
+	sm := manager.NewSessionManager("ses_1", "/tmp", nil)
+	s.sessions["ses_1"] = sm
+
+	resp := s.handleRequest(request{Action: "SHELL", SessionID: "ses_1", Payload: map[string]interface{}{"command": " "}})
+	if resp["status"] != "error" || resp["code"] != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty command, got %v", resp)
+	}
+
+	sm.SyncPermissions([]api.PermissionRequest{{ID: "per_1", SessionID: "ses_1"}})
+	resp = s.handleRequest(request{Action: "SHELL", SessionID: "ses_1", Payload: map[string]interface{}{"command": "ls"}})
+	if resp["status"] != "error" || resp["code"] != http.StatusConflict {
+		t.Errorf("Expected 409 while waiting for permission, got %v", resp)
+	}
+}
+
+func TestServer_HandleRequest_Compact(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t, nil)
+	sm := manager.NewSessionManager("ses_1", "/tmp", nil)
+	s.sessions["ses_1"] = sm
+
+	tests := []struct {
+		payload map[string]interface{}
+		code    int
+		want    int
+	}{
+		{map[string]interface{}{"percent": 80.0}, 0, 80},
+		{map[string]interface{}{"percent": 0.0}, 0, 0},
+		{map[string]interface{}{"percent": 101.0}, http.StatusBadRequest, 0},
+		{map[string]interface{}{"percent": 12.5}, http.StatusBadRequest, 0},
+		{map[string]interface{}{"percent": "80"}, http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		resp := s.handleRequest(request{Action: "SET_AUTO_COMPACT", SessionID: "ses_1", Payload: tt.payload})
+		if tt.code != 0 {
+			if resp["status"] != "error" || resp["code"] != tt.code {
+				t.Errorf("%v: expected error %d, got %v", tt.payload, tt.code, resp)
+			}
+			continue
+		}
+		if resp["status"] != "ok" || sm.AutoCompact() != tt.want {
+			t.Errorf("%v: expected threshold %d, got %v and %d", tt.payload, tt.want, resp, sm.AutoCompact())
+		}
+	}
+
+	sm.SyncQuestions([]api.Question{{ID: "que_1", SessionID: "ses_1"}})
+	resp := s.handleRequest(request{Action: "COMPACT", SessionID: "ses_1", Payload: map[string]interface{}{}})
+	if resp["status"] != "error" || resp["code"] != http.StatusConflict {
+		t.Errorf("Expected 409 compacting a waiting session, got %v", resp)
+	}
+}
+
+func TestServer_HandleRequest_ArchiveAndDelete(t *testing.T) {
+	t.Parallel()
+
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	t.Cleanup(func() { registry.Close() })
+	if err := registry.Create("proj", "task", "ses_1", "/tmp"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	s := newTestServer(t, registry)
+	sm := manager.NewSessionManager("ses_1", "/tmp", nil)
+	sm.Start()
+	s.sessions["ses_1"] = sm
+	session := map[string]interface{}{"project": "proj", "session_name": "task"}
+
+	sm.SyncQuestions([]api.Question{{ID: "que_1", SessionID: "ses_1"}})
+	resp := s.handleRequest(request{Action: "ARCHIVE_SESSION", Payload: session})
+	if resp["status"] != "error" || resp["code"] != http.StatusConflict {
+		t.Errorf("Expected 409 archiving a waiting session, got %v", resp)
+	}
+
+	sm.SyncQuestions(nil)
+	resp = s.handleRequest(request{Action: "ARCHIVE_SESSION", Payload: session})
+	if resp["status"] != "ok" {
+		t.Fatalf("ARCHIVE_SESSION failed: %v", resp)
+	}
+	if _, ok := s.getSession("ses_1"); ok {
+		t.Error("Expected the manager of an archived session to be stopped")
+	}
+	if data, _ := registry.Get("proj", "task"); data == nil || !data.Archived {
+		t.Errorf("Expected the session to stay registered as archived, got %+v", data)
+	}
+
+	resp = s.handleRequest(request{Action: "START_SESSION", SessionID: "ses_1", Payload: map[string]interface{}{"working_dir": "/tmp"}})
+	if resp["status"] != "error" || resp["code"] != http.StatusConflict {
+		t.Errorf("Expected 409 starting an archived session, got %v", resp)
+	}
+	if _, ok := s.getSession("ses_1"); ok {
+		t.Error("Expected an archived session to stay stopped")
+	}
+
+	resp = s.handleRequest(request{Action: "DELETE_SESSION", Payload: session})
+	if resp["status"] != "ok" {
+		t.Fatalf("DELETE_SESSION failed: %v", resp)
+	}
+	if _, err := registry.Get("proj", "task"); err != ErrNotFound {
+		t.Errorf("Expected the session to be deleted, got %v", err)
+	}
+
+	resp = s.handleRequest(request{Action: "DELETE_SESSION", Payload: session})
+	if resp["status"] != "error" || resp["code"] != http.StatusNotFound {
+		t.Errorf("Expected 404 deleting a missing session, got %v", resp)
+	}
+}
+
+func TestServer_HandleRequest_Prune(t *testing.T) {
+	t.Parallel()
+
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	t.Cleanup(func() { registry.Close() })
+
+	old := time.Now().Add(-30 * 24 * time.Hour).Format(time.RFC3339)
+	for _, name := range []string{"old", "recent", "unknown"} {
+		if err := registry.Create("proj", name, "ses_"+name, "/tmp"); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	registry.UpdateLastActivity("proj", "old", old)
+	registry.UpdateLastActivity("proj", "unknown", "")
+
+	s := newTestServer(t, registry)
+
+	resp := s.handleRequest(request{Action: "PRUNE_SESSIONS", Payload: map[string]interface{}{"older_than": "soon"}})
+	if resp["status"] != "error" || resp["code"] != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid age, got %v", resp)
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		resp = s.handleRequest(request{Action: "PRUNE_SESSIONS", Payload: map[string]interface{}{"older_than": "14d", "dry_run": dryRun}})
+		pruned, _ := resp["data"].([]SessionData)
+		if resp["status"] != "ok" || len(pruned) != 1 || pruned[0].SessionName != "old" {
+			t.Errorf("dry_run=%v: expected only the old session, got %v", dryRun, resp)
+		}
+	}
+
+	sessions, _ := registry.List()
+	if len(sessions) != 2 {
+		t.Errorf("Expected the recent and unknown sessions to be kept, got %+v", sessions)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"14d", 14 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"36h", 36 * time.Hour},
+		{"", 0},
+		{"0d", 0},
+		{"-1d", 0},
+		{"xd", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.in)
+		if got != tt.want || (tt.want == 0) != (err != nil) {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestServer_StatePersistenceRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	defer registry.Close()
+	if err := registry.Create("proj", "task", "ses_1", "/tmp"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	s := newTestServer(t, registry)
+	sm := manager.NewSessionManager("ses_1", "/tmp", nil)
+	s.setupStatePersistence(sm)
+	sm.OnStateChange(manager.PersistedState{
+		State:        "WAITING_FOR_PERMISSION",
+		Permissions:  `[{"id":"per_1","sessionID":"ses_1","permission":"bash","patterns":["rm -rf build"]}]`,
+		Todos:        `[{"id":"1","content":"Plan","status":"completed","priority":"high"}]`,
+		Context:      `{"tokens":1200,"limit":200000}`,
+		Revert:       `{"messageID":"msg_2"}`,
+		LastActivity: "2026-02-16T14:00:00Z",
+	})
+
+	session, err := registry.Get("proj", "task")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	snap := manager.NewSessionManager("ses_1", "/tmp", persistedState(session)).GetSnapshot()
+
+	if snap.Revert == nil || snap.Revert.MessageID != "msg_2" {
+		t.Errorf("Expected revert point msg_2 after a restart, got %+v", snap.Revert)
+	}
+	if len(snap.Permissions) != 1 || snap.Permissions[0].ID != "per_1" {
+		t.Errorf("Expected pending permission per_1 after a restart, got %+v", snap.Permissions)
+	}
+	if len(snap.Todos) != 1 || snap.Todos[0].Content != "Plan" {
+		t.Errorf("Expected todo list after a restart, got %+v", snap.Todos)
+	}
+	if snap.Context == nil || snap.Context.Tokens != 1200 {
+		t.Errorf("Expected context usage after a restart, got %+v", snap.Context)
+	}
+}
+
+func TestServer_HandleRequest_Fork(t *testing.T) {
+	t.Parallel()
+
+	forked := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /session/ses_1/fork", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		forked <- r.Header.Get("x-opencode-directory") + " " + body["messageID"]
+		w.Write([]byte(`{"id":"ses_2","directory":"/work"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	t.Cleanup(func() { registry.Close() })
+	if err := registry.Create("proj", "task", "ses_1", "/work"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	policy := `[{"permission":"edit","pattern":"{workdir}/*","action":"allow"}]`
+	if err := registry.UpdatePermissionPolicy("proj", "task", policy); err != nil {
+		t.Fatalf("UpdatePermissionPolicy failed: %v", err)
+	}
+
+	s := newTestServer(t, registry)
+	s.openCodeURL = srv.URL
+	t.Cleanup(func() {
+		for _, sm := range s.sessions {
+			sm.Stop()
+		}
+	})
+
+	payload := map[string]interface{}{"project": "proj", "session_name": "task", "new_session_name": "task-b", "message_id": "msg_3"}
+	resp := s.handleRequest(request{Action: "FORK_SESSION", Payload: payload})
+	if resp["status"] != "ok" || resp["session_id"] != "ses_2" || resp["working_dir"] != "/work" {
+		t.Fatalf("FORK_SESSION failed: %v", resp)
+	}
+	if got := <-forked; got != "/work msg_3" {
+		t.Errorf("Expected the fork at msg_3 in /work, got %q", got)
+	}
+
+	fork, err := registry.Get("proj", "task-b")
+	if err != nil {
+		t.Fatalf("Expected the fork to be registered: %v", err)
+	}
+	if fork.ID != "ses_2" || fork.WorkingDir != "/work" || fork.PermissionPolicy != policy {
+		t.Errorf("Expected ses_2 in /work with the parent's policy, got %+v", fork)
+	}
+	if _, ok := s.getSession("ses_2"); !ok {
+		t.Error("Expected a manager for the fork")
+	}
+}
+
+func TestServer_HandleRequest_Adopt(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /session/ses_9", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"ses_9","title":"From the TUI","directory":"/work/app"}`))
+	})
+	mux.HandleFunc("GET /session/ses_child", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"ses_child","directory":"/work/app","parentID":"ses_9"}`))
+	})
+	mux.HandleFunc("GET /session/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ses_9":{"type":"busy"}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	t.Cleanup(func() { registry.Close() })
+
+	s := newTestServer(t, registry)
+	s.openCodeURL = srv.URL
+	t.Cleanup(func() {
+		for _, sm := range s.sessions {
+			sm.Stop()
+		}
+	})
+
+	resp := s.handleRequest(request{Action: "ADOPT_SESSION", Payload: map[string]interface{}{
+		"project": "proj", "session_name": "sub", "opencode_session_id": "ses_child",
+	}})
+	if resp["status"] != "error" || resp["code"] != http.StatusBadRequest {
+		t.Errorf("Expected 400 adopting a subagent session, got %v", resp)
+	}
+
+	resp = s.handleRequest(request{Action: "ADOPT_SESSION", Payload: map[string]interface{}{
+		"project": "proj", "session_name": "tui", "opencode_session_id": "ses_9",
+	}})
+	if resp["status"] != "ok" || resp["working_dir"] != "/work/app" {
+		t.Fatalf("ADOPT_SESSION failed: %v", resp)
+	}
+	if session, err := registry.Get("proj", "tui"); err != nil || session.WorkingDir != "/work/app" {
+		t.Errorf("Expected the session registered in its own directory, got %+v, %v", session, err)
+	}
+	sm, ok := s.getSession("ses_9")
+	if !ok {
+		t.Fatal("Expected a manager for the adopted session")
+	}
+	if state := sm.GetSnapshot().State; state != manager.StateBusy {
+		t.Errorf("Expected the adopted session to follow OpenCode's running task, got %s", state)
+	}
+}
+
+func TestServer_SyncStatus(t *testing.T) {
+	t.Parallel()
+
+	var polls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /session/status", func(w http.ResponseWriter, r *http.Request) {
+		polls.Add(1)
+		w.Write([]byte(`{"ses_busy":{"type":"busy"}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	s := newTestServer(t, nil)
+	s.openCodeURL = srv.URL
+	idle := manager.NewSessionManager("ses_idle", "/work/idle", nil)
+	busy := manager.NewSessionManager("ses_busy", "/work/busy", &manager.PersistedState{State: "BUSY"})
+	for _, sm := range []*manager.SessionManager{idle, busy} {
+		sm.Start()
+		defer sm.Stop()
+		s.sessions[sm.SessionID] = sm
+	}
+
+	s.syncStatus()
+	if n := polls.Load(); n != 1 {
+		t.Errorf("Expected one status poll for the busy session's directory, got %d", n)
+	}
+	if state := busy.GetSnapshot().State; state != manager.StateBusy {
+		t.Errorf("Expected BUSY while OpenCode reports busy, got %s", state)
+	}
+}
@@ -0,0 +1,224 @@
+package daemon
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/manager"
+)
+
+// subscriberBuffer is how many state events a subscriber may fall behind
+// before it is dropped. Clients re-subscribe when their stream ends.
+const subscriberBuffer = 64
+
+// subscriber receives the events published for one session over one
+// SUBSCRIBE request. Progress events are only sent to subscribers that asked
+// for them, through their own one-slot channel, so however chatty a task is
+// they never take the room state events need.
+type subscriber struct {
+	sessionID      string
+	progress       bool
+	events         chan map[string]interface{}
+	progressEvents chan map[string]interface{}
+	once           sync.Once
+	done           chan struct{}
+}
+
+func (sub *subscriber) close() {
+	sub.once.Do(func() { close(sub.done) })
+}
+
+func (s *Server) subscribe(sessionID string, progress bool) *subscriber {
+	sub := &subscriber{
+		sessionID:      sessionID,
+		progress:       progress,
+		events:         make(chan map[string]interface{}, subscriberBuffer),
+		progressEvents: make(chan map[string]interface{}, 1),
+		done:           make(chan struct{}),
+	}
+
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	if s.subs == nil {
+		s.subs = make(map[string]map[*subscriber]struct{})
+	}
+	if s.subs[sessionID] == nil {
+		s.subs[sessionID] = make(map[*subscriber]struct{})
+	}
+	s.subs[sessionID][sub] = struct{}{}
+	return sub
+}
+
+func (s *Server) unsubscribe(sub *subscriber) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	delete(s.subs[sub.sessionID], sub)
+	if len(s.subs[sub.sessionID]) == 0 {
+		delete(s.subs, sub.sessionID)
+	}
+	sub.close()
+}
+
+// publish sends an event to every subscriber of the session without
+// blocking. It is called from OnStateChange with the manager's lock held.
+func (s *Server) publish(sessionID, event string, data interface{}) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	for sub := range s.subs[sessionID] {
+		select {
+		case sub.events <- map[string]interface{}{"event": event, "data": data}:
+		default:
+			log.Printf("Subscriber for session %s is too slow, dropping it", sessionID)
+			delete(s.subs[sessionID], sub)
+			sub.close()
+		}
+	}
+}
+
+// publishProgress relays an OpenCode event describing work in progress to the
+// session's progress subscribers. A subscriber that falls behind only gets
+// the latest progress event: part updates carry the full part, so later ones
+// make up for missed ones.
+func (s *Server) publishProgress(sessionID string, ev api.Event) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	event := map[string]interface{}{"event": "progress", "data": ev}
+	for sub := range s.subs[sessionID] {
+		if !sub.progress {
+			continue
+		}
+		for sent := false; !sent; {
+			select {
+			case sub.progressEvents <- event:
+				sent = true
+			default:
+				// Replace the stale event the subscriber has not read yet
+				select {
+				case <-sub.progressEvents:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// publishState publishes a state transition in the same shape as the
+// GET_STATUS data.
+func (s *Server) publishState(sessionID string, state manager.PersistedState) {
+	s.publish(sessionID, "state", map[string]interface{}{
+		"state":           state.State,
+		"session_id":      sessionID,
+		"latest_response": rawJSON(state.LatestResponse),
+		"questions":       rawJSON(state.Questions),
+		"permissions":     rawJSON(state.Permissions),
+		"todos":           rawJSON(state.Todos),
+		"context":         rawJSON(state.Context),
+		"revert":          rawJSON(state.Revert),
+	})
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
+
+// handleSubscribe streams events for a session over the connection until the
+// client sends UNSUBSCRIBE, the connection closes or the subscriber falls too
+// far behind. Every frame carries the SUBSCRIBE request ID; the first one is
+// the current state and the last one is an "end" event.
+func (s *Server) handleSubscribe(req request, w *connWriter, conn *connState) {
+	sm, ok := s.getSession(req.SessionID)
+	if !ok {
+		resp := errorResponse(http.StatusNotFound, "Session not found")
+		resp["id"] = req.ID
+		w.send(resp)
+		return
+	}
+
+	progress, _ := req.Payload["progress"].(bool)
+	sub := s.subscribe(req.SessionID, progress)
+	conn.addSubscription(req.ID, sub)
+	defer func() {
+		s.unsubscribe(sub)
+		conn.removeSubscription(req.ID)
+		w.send(map[string]interface{}{"id": req.ID, "status": "ok", "event": "end"})
+	}()
+
+	if err := w.send(map[string]interface{}{"id": req.ID, "status": "ok", "event": "state", "data": sm.GetSnapshot()}); err != nil {
+		return
+	}
+
+	for {
+		// State events go first, so a progress event never follows the
+		// state it led up to
+		var ev map[string]interface{}
+		select {
+		case ev = <-sub.events:
+		default:
+			select {
+			case ev = <-sub.events:
+			case ev = <-sub.progressEvents:
+			case <-sub.done:
+				return
+			case <-conn.done:
+				return
+			}
+		}
+		ev["id"] = req.ID
+		ev["status"] = "ok"
+		if err := w.send(ev); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handleUnsubscribe(req request, conn *connState) map[string]interface{} {
+	id, _ := req.Payload["subscription"].(float64)
+	sub, ok := conn.subscription(uint64(id))
+	if !ok {
+		return errorResponse(http.StatusNotFound, "Subscription not found")
+	}
+	s.unsubscribe(sub)
+	return map[string]interface{}{"status": "ok", "message": "Unsubscribed"}
+}
+
+// connState tracks the subscriptions opened on one connection so UNSUBSCRIBE
+// can find them and they end when the connection closes.
+type connState struct {
+	mu   sync.Mutex
+	subs map[uint64]*subscriber
+	done chan struct{}
+}
+
+func newConnState() *connState {
+	return &connState{
+		subs: make(map[uint64]*subscriber),
+		done: make(chan struct{}),
+	}
+}
+
+func (c *connState) addSubscription(id uint64, sub *subscriber) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subs[id] = sub
+}
+
+func (c *connState) removeSubscription(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.subs, id)
+}
+
+func (c *connState) subscription(id uint64) (*subscriber, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sub, ok := c.subs[id]
+	return sub, ok
+}
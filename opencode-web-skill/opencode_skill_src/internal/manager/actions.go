@@ -10,10 +10,10 @@ func (sm *SessionManager) AbortTask() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	sm.aborted = true
-	sm.State = StateIdle
-	sm.LatestResponse = map[string]interface{}{"status": "aborted", "message": "Task aborted by user"}
-	sm.isWorkerBusy = false
+	// Results still on their way belong to the aborted task
+	sm.taskSeq++
 	sm.taskStartTime = time.Time{}
 	sm.Questions = []api.Question{}
+	sm.Permissions = []api.PermissionRequest{}
+	sm.finishTaskLocked(&Response{Status: "aborted", Message: "Task aborted by user"})
 }
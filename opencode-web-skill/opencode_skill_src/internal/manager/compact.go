@@ -0,0 +1,137 @@
+package manager
+
+import (
+	"log"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/config"
+	"opencode_skill/internal/types"
+)
+
+// ContextUsage is how much of the model's context window the session's last
+// reply used.
+type ContextUsage struct {
+	Tokens int `json:"tokens"`
+	Limit  int `json:"limit"`
+}
+
+// SetAutoCompact sets the share of the context window, in percent, at which
+// the session is compacted between turns. 0 turns auto-compaction off.
+func (sm *SessionManager) SetAutoCompact(percent int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.autoCompact = percent
+}
+
+// AutoCompact returns the auto-compaction threshold in percent, 0 if off.
+func (sm *SessionManager) AutoCompact() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.autoCompact
+}
+
+// compact summarizes the session as a task of its own. An automatic
+// compaction keeps the latest response and gives way to a task that started
+// in the meantime.
+func (sm *SessionManager) compact(req types.CompactRequest) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if req.Auto && (sm.State != StateIdle || sm.isWorkerBusy) {
+		log.Printf("Session %s: skipping auto-compaction, session is %s", sm.SessionID, sm.State)
+		return
+	}
+
+	model := sm.lastModel
+	if req.Model != nil && req.Model.ModelID != "" {
+		model = *req.Model
+	}
+	if model.ModelID == "" {
+		model = types.ParseModel(config.DefaultModel)
+	}
+
+	seq := sm.startTaskLocked()
+	sm.State = StateBusy
+	sm.compacting = true
+	sm.compactAuto = req.Auto
+	if !req.Auto {
+		sm.LatestResponse = nil
+	}
+	sm.notifyStateChange()
+
+	client := sm.client
+	go func() {
+		err := client.SummarizeSession(sm.SessionID, model, req.Auto)
+		sm.workerDoneChan <- workerResult{Seq: seq, Compacted: true, Error: err}
+	}()
+}
+
+func (sm *SessionManager) finishCompactionLocked(err error) {
+	auto := sm.compactAuto
+	sm.compacting = false
+	sm.compactAuto = false
+
+	resp := sm.LatestResponse
+	switch {
+	case err != nil && auto:
+		log.Printf("Session %s: auto-compaction failed: %v", sm.SessionID, err)
+	case err != nil:
+		resp = &Response{Error: "Compaction failed: " + err.Error()}
+	default:
+		log.Printf("Session %s: compacted", sm.SessionID)
+		sm.Context = nil
+		if !auto {
+			resp = &Response{Status: "compacted", Message: "Session compacted"}
+		}
+	}
+	sm.finishTaskLocked(resp)
+}
+
+// trackContext records the context usage of a finished reply and, past the
+// auto-compaction threshold, queues a compaction for before the next turn.
+func (sm *SessionManager) trackContext(info api.AssistantMessage) {
+	model := types.ModelDetails{ProviderID: info.ProviderID, ModelID: info.ModelID}
+	if model.ModelID == "" {
+		return
+	}
+	limit, err := sm.contextLimit(model)
+	if err != nil {
+		log.Printf("Session %s: %v", sm.SessionID, err)
+	}
+
+	t := info.Tokens
+	usage := &ContextUsage{Tokens: t.Input + t.Output + t.Cache.Read + t.Cache.Write, Limit: limit}
+
+	sm.mu.Lock()
+	sm.lastModel = model
+	sm.Context = usage
+	threshold := sm.autoCompact
+	sm.notifyStateChange()
+	sm.mu.Unlock()
+
+	if threshold > 0 && usage.Limit > 0 && usage.Tokens*100 >= usage.Limit*threshold {
+		log.Printf("Session %s: %d of %d context tokens used, compacting", sm.SessionID, usage.Tokens, usage.Limit)
+		sm.SubmitRequest(Request{Type: "COMPACT", Payload: types.CompactRequest{Model: &model, Auto: true}})
+	}
+}
+
+// contextLimit returns the model's context window, looked up once per model.
+func (sm *SessionManager) contextLimit(model types.ModelDetails) (int, error) {
+	key := model.ProviderID + "/" + model.ModelID
+	sm.mu.RLock()
+	limit, ok := sm.contextLimits[key]
+	client := sm.client
+	sm.mu.RUnlock()
+	if ok {
+		return limit, nil
+	}
+
+	limit, err := client.ContextLimit(model)
+	if err != nil {
+		return 0, err
+	}
+	sm.mu.Lock()
+	sm.contextLimits[key] = limit
+	sm.mu.Unlock()
+	return limit, nil
+}
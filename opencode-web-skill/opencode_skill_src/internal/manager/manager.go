@@ -2,12 +2,15 @@ package manager
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"opencode_skill/internal/api"
 	"opencode_skill/internal/config"
+	"opencode_skill/internal/policy"
 	"opencode_skill/internal/types"
 )
 
@@ -17,6 +20,9 @@ const (
 	StateIdle            State = "IDLE"
 	StateBusy            State = "BUSY"
 	StateWaitingForInput State = "WAITING_FOR_INPUT"
+	// StateWaitingForPermission means OpenCode is blocked on a permission
+	// request, e.g. to run a shell command or edit outside the project.
+	StateWaitingForPermission State = "WAITING_FOR_PERMISSION"
 )
 
 type PersistedState struct {
@@ -25,17 +31,52 @@ type PersistedState struct {
 	State          string
 	LatestResponse string
 	Questions      string
+	Permissions    string
+	Todos          string
+	Context        string
+	Revert         string
 	LastActivity   string
 }
 
+// Response is the outcome of the session's last task: the assistant's reply,
+// an error, or a status such as "aborted".
+type Response struct {
+	Result *api.AssistantResponse `json:"result,omitempty"`
+	// Diff lists the files the task changed, without their contents.
+	Diff    []api.FileDiff `json:"diff,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Status  string         `json:"status,omitempty"`
+	Message string         `json:"message,omitempty"`
+}
+
+// Snapshot is the session state reported by GET_STATUS and subscriptions.
+type Snapshot struct {
+	State          State                   `json:"state"`
+	SessionID      string                  `json:"session_id"`
+	LatestResponse *Response               `json:"latest_response"`
+	Questions      []api.Question          `json:"questions"`
+	Permissions    []api.PermissionRequest `json:"permissions"`
+	Todos          []api.Todo              `json:"todos"`
+	Context        *ContextUsage           `json:"context,omitempty"`
+	Revert         *api.SessionRevert      `json:"revert,omitempty"`
+}
+
 type SessionManager struct {
 	SessionID      string
 	State          State
-	LatestResponse interface{}
+	LatestResponse *Response
 	Questions      []api.Question
-
-	mu            sync.RWMutex // Protects State, LatestResponse, Questions, isWorkerBusy
+	Permissions    []api.PermissionRequest
+	// Todos is the agent's todo list, as last reported by OpenCode.
+	Todos []api.Todo
+	// Context is the context usage of the last reply, if known.
+	Context *ContextUsage
+	// Revert is the session's revert point while /undo is in effect.
+	Revert *api.SessionRevert
+
+	mu            sync.RWMutex // Protects State, LatestResponse, Questions, Permissions, Todos, Context, Revert, isWorkerBusy
 	inputChan     chan Request
+	eventChan     chan api.Event
 	stopChan      chan struct{}
 	client        *api.Client
 	isAgentLocked bool
@@ -46,8 +87,32 @@ type SessionManager struct {
 	taskStartTime  time.Time
 	lastActivity   time.Time
 	params         SessionParams
-	aborted        bool
+	policy         policy.Policy
 	OnStateChange  func(PersistedState)
+
+	// taskSeq identifies the current task; results of earlier (aborted or
+	// superseded) tasks are ignored.
+	taskSeq uint64
+	// A task finishes when OpenCode has accepted it (accepted), reported the
+	// session busy (remoteBusy) and then idle again (remoteIdle). fetching is
+	// set while the final message is being retrieved.
+	accepted   bool
+	remoteBusy bool
+	remoteIdle bool
+	fetching   bool
+
+	// compacting is set while a compaction runs as the current task;
+	// compactAuto when the daemon started it past autoCompact percent of the
+	// context window used.
+	compacting    bool
+	compactAuto   bool
+	autoCompact   int
+	lastModel     types.ModelDetails
+	contextLimits map[string]int
+
+	// eventsDropped is set when HandleEvent found eventChan full; the loop
+	// resyncs the session from OpenCode once the queue has drained.
+	eventsDropped atomic.Bool
 }
 
 type SessionParams struct {
@@ -61,8 +126,15 @@ type Request struct {
 }
 
 type workerResult struct {
-	Result interface{}
+	Seq    uint64
+	Result *api.AssistantResponse
+	Diff   []api.FileDiff
 	Error  error
+	// Accepted reports that prompt_async succeeded; the result comes later
+	// from the session's events.
+	Accepted bool
+	// Compacted reports the end of a compaction.
+	Compacted bool
 }
 
 func NewSessionManager(sessionID string, workingDir string, persistedState *PersistedState) *SessionManager {
@@ -70,11 +142,13 @@ func NewSessionManager(sessionID string, workingDir string, persistedState *Pers
 		SessionID:      sessionID,
 		State:          StateIdle,
 		inputChan:      make(chan Request, 10),
+		eventChan:      make(chan api.Event, 256),
 		stopChan:       make(chan struct{}),
 		workerDoneChan: make(chan workerResult, 1),
 		client:         api.NewClient(workingDir),
 		lastActivity:   time.Now(),
 		params:         SessionParams{LastAgent: "sisyphus"},
+		contextLimits:  map[string]int{},
 	}
 
 	if persistedState != nil {
@@ -91,6 +165,12 @@ func (sm *SessionManager) restoreFromPersistedState(data *PersistedState) {
 	if data.State != "" {
 		sm.State = State(data.State)
 	}
+	if sm.State != StateIdle {
+		// The task kept running in OpenCode while the daemon was down; the
+		// status resync on connect picks up where it is now.
+		sm.isWorkerBusy = true
+		sm.accepted = true
+	}
 	sm.isAgentLocked = data.IsAgentLocked
 	if data.Questions != "" && data.Questions != "[]" {
 		var questions []api.Question
@@ -98,10 +178,34 @@ func (sm *SessionManager) restoreFromPersistedState(data *PersistedState) {
 			sm.Questions = questions
 		}
 	}
-	if data.LatestResponse != "" {
-		var response interface{}
+	if data.Permissions != "" && data.Permissions != "[]" {
+		var permissions []api.PermissionRequest
+		if err := json.Unmarshal([]byte(data.Permissions), &permissions); err == nil {
+			sm.Permissions = permissions
+		}
+	}
+	if data.Todos != "" && data.Todos != "null" {
+		var todos []api.Todo
+		if err := json.Unmarshal([]byte(data.Todos), &todos); err == nil {
+			sm.Todos = todos
+		}
+	}
+	if data.Context != "" && data.Context != "null" {
+		var usage ContextUsage
+		if err := json.Unmarshal([]byte(data.Context), &usage); err == nil {
+			sm.Context = &usage
+		}
+	}
+	if data.Revert != "" && data.Revert != "null" {
+		var revert api.SessionRevert
+		if err := json.Unmarshal([]byte(data.Revert), &revert); err == nil {
+			sm.Revert = &revert
+		}
+	}
+	if data.LatestResponse != "" && data.LatestResponse != "null" {
+		var response Response
 		if err := json.Unmarshal([]byte(data.LatestResponse), &response); err == nil {
-			sm.LatestResponse = response
+			sm.LatestResponse = &response
 		}
 	}
 	if data.LastActivity != "" {
@@ -114,9 +218,24 @@ func (sm *SessionManager) restoreFromPersistedState(data *PersistedState) {
 func (sm *SessionManager) SaveState() PersistedState {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
+	return sm.saveStateLocked()
+}
 
+// notifyStateChange reports the current state to OnStateChange. Callers must
+// hold sm.mu, so the hook must not call back into the manager.
+func (sm *SessionManager) notifyStateChange() {
+	if sm.OnStateChange != nil {
+		sm.OnStateChange(sm.saveStateLocked())
+	}
+}
+
+func (sm *SessionManager) saveStateLocked() PersistedState {
 	questionsJSON, _ := json.Marshal(sm.Questions)
+	permissionsJSON, _ := json.Marshal(sm.Permissions)
+	todosJSON, _ := json.Marshal(sm.Todos)
+	contextJSON, _ := json.Marshal(sm.Context)
 	responseJSON, _ := json.Marshal(sm.LatestResponse)
+	revertJSON, _ := json.Marshal(sm.Revert)
 
 	return PersistedState{
 		LastAgent:      sm.params.LastAgent,
@@ -124,6 +243,10 @@ func (sm *SessionManager) SaveState() PersistedState {
 		State:          string(sm.State),
 		LatestResponse: string(responseJSON),
 		Questions:      string(questionsJSON),
+		Permissions:    string(permissionsJSON),
+		Todos:          string(todosJSON),
+		Context:        string(contextJSON),
+		Revert:         string(revertJSON),
 		LastActivity:   sm.lastActivity.Format(time.RFC3339),
 	}
 }
@@ -132,14 +255,28 @@ func (sm *SessionManager) SetLastAgent(agent string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.params.LastAgent = agent
-	sm.OnStateChange(sm.SaveState())
+	sm.notifyStateChange()
 }
 
 func (sm *SessionManager) SetAgentLocked(locked bool) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.isAgentLocked = locked
-	sm.OnStateChange(sm.SaveState())
+	sm.notifyStateChange()
+}
+
+// SetPolicy sets the rules that decide permission requests before they are
+// left to a human.
+func (sm *SessionManager) SetPolicy(p policy.Policy) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.policy = p
+}
+
+func (sm *SessionManager) Policy() policy.Policy {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.policy
 }
 
 func (sm *SessionManager) Start() {
@@ -152,33 +289,60 @@ func (sm *SessionManager) UpdateWorkingDir(workingDir string) {
 	sm.client = api.NewClient(workingDir)
 }
 
+// WorkingDir returns the directory the session's API client works in.
+func (sm *SessionManager) WorkingDir() string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.client.WorkingDir
+}
+
 func (sm *SessionManager) Stop() {
 	close(sm.stopChan)
 }
 
 func (sm *SessionManager) SubmitRequest(req Request) {
 	// Pre-set state to avoid race condition where GetSnapshot sees IDLE before loop picks up request
+	// Automatic compactions leave the latest response in place.
+	compact, _ := req.Payload.(types.CompactRequest)
 	sm.mu.Lock()
-	if req.Type == "PROMPT" || req.Type == "COMMAND" {
+	if req.Type == "PROMPT" || req.Type == "COMMAND" || req.Type == "SHELL" || (req.Type == "COMPACT" && !compact.Auto) {
 		sm.State = StateBusy
 		sm.LatestResponse = nil
 		sm.isWorkerBusy = true // Optimistic lock
-		sm.OnStateChange(sm.SaveState())
+		sm.notifyStateChange()
 	}
 	sm.mu.Unlock()
 
 	sm.inputChan <- req
 }
 
-func (sm *SessionManager) GetSnapshot() map[string]interface{} {
+// HandleEvent queues an OpenCode event for this session. Events are applied
+// in order by the manager's loop. It never blocks, since one dispatcher
+// delivers the events of every session: when the queue is full the event is
+// dropped and the session resynced instead.
+func (sm *SessionManager) HandleEvent(ev api.Event) {
+	select {
+	case sm.eventChan <- ev:
+	default:
+		if !sm.eventsDropped.Swap(true) {
+			log.Printf("Session %s: event queue full, dropping events until it drains", sm.SessionID)
+		}
+	}
+}
+
+func (sm *SessionManager) GetSnapshot() Snapshot {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	return map[string]interface{}{
-		"state":           sm.State,
-		"session_id":      sm.SessionID,
-		"latest_response": sm.LatestResponse,
-		"questions":       sm.Questions,
+	return Snapshot{
+		State:          sm.State,
+		SessionID:      sm.SessionID,
+		LatestResponse: sm.LatestResponse,
+		Questions:      sm.Questions,
+		Permissions:    sm.Permissions,
+		Todos:          sm.Todos,
+		Context:        sm.Context,
+		Revert:         sm.Revert,
 	}
 }
 
@@ -197,8 +361,13 @@ func (sm *SessionManager) loop() {
 		case res := <-sm.workerDoneChan:
 			sm.handleWorkerDone(res)
 
+		case ev := <-sm.eventChan:
+			sm.handleEvent(ev)
+			if len(sm.eventChan) == 0 && sm.eventsDropped.Swap(false) {
+				go sm.Resync()
+			}
+
 		case <-ticker.C:
-			sm.pollQuestions()
 			sm.checkAutoFix()
 		}
 	}
@@ -210,8 +379,9 @@ func (sm *SessionManager) handleRequest(req Request) {
 		defer close(req.ResultChan)
 	}
 
+	var err error
 	switch req.Type {
-	case "PROMPT", "COMMAND":
+	case "PROMPT", "COMMAND", "SHELL":
 		sm.mu.Lock()
 
 		if req.Type == "PROMPT" {
@@ -222,16 +392,22 @@ func (sm *SessionManager) handleRequest(req Request) {
 			if p, ok := req.Payload.(types.CommandRequest); ok {
 				sm.params.LastAgent = p.Agent
 			}
+		} else if req.Type == "SHELL" {
+			if p, ok := req.Payload.(types.ShellRequest); ok {
+				sm.params.LastAgent = p.Agent
+			}
 		}
 
 		sm.State = StateBusy
 		sm.LatestResponse = nil
-		sm.taskStartTime = time.Now()
-		sm.isWorkerBusy = true
+		seq := sm.startTaskLocked()
+		// POST /command and /shell only return when done, so they are
+		// treated as accepted right away and may finish either way.
+		sm.accepted = req.Type == "COMMAND" || req.Type == "SHELL"
 		sm.mu.Unlock()
 
-		log.Printf("Starting worker for PROMPT/COMMAND...")
-		go sm.runWorker(req)
+		log.Printf("Starting worker for %s...", req.Type)
+		go sm.runWorker(req, seq)
 
 	case "ANSWER":
 		payload, ok := req.Payload.(types.AnswerRequest)
@@ -241,39 +417,58 @@ func (sm *SessionManager) handleRequest(req Request) {
 			} else {
 				sm.mu.Lock()
 				// Optimistically remove question
-				newQuestions := []api.Question{}
-				for _, q := range sm.Questions {
-					if q.ID != payload.RequestID {
-						newQuestions = append(newQuestions, q)
-					}
-				}
-				sm.Questions = newQuestions
-
-				if len(sm.Questions) == 0 {
-					if sm.isWorkerBusy {
-						sm.State = StateBusy
-						sm.taskStartTime = time.Now() // Reset timeout
-					} else {
-						sm.State = StateIdle
-					}
-				}
+				sm.lastActivity = time.Now() // Reset timeout
+				sm.removeQuestionLocked(payload.RequestID)
 				sm.mu.Unlock()
 			}
 		}
 
+	case "REJECT":
+		if payload, ok := req.Payload.(types.RejectRequest); ok {
+			err = sm.rejectQuestion(payload)
+		}
+
+	case "PERMIT":
+		if payload, ok := req.Payload.(types.PermitRequest); ok {
+			err = sm.replyPermission(payload)
+		}
+
+	case "UNDO":
+		if payload, ok := req.Payload.(types.RevertRequest); ok {
+			err = sm.undo(payload)
+		}
+
+	case "REDO":
+		err = sm.redo()
+
+	case "COMPACT":
+		if payload, ok := req.Payload.(types.CompactRequest); ok {
+			sm.compact(payload)
+		}
+
 	case "FIX":
 		sm.performFix()
 	}
 
 	if req.ResultChan != nil {
-		req.ResultChan <- nil
+		req.ResultChan <- err
 	}
 }
 
-func (sm *SessionManager) runWorker(req Request) {
-	var res interface{}
-	var err error
+// startTaskLocked begins tracking a new task and returns its sequence number.
+func (sm *SessionManager) startTaskLocked() uint64 {
+	sm.taskSeq++
+	sm.isWorkerBusy = true
+	sm.taskStartTime = time.Now()
+	sm.lastActivity = sm.taskStartTime
+	sm.accepted = false
+	sm.remoteBusy = false
+	sm.remoteIdle = false
+	sm.fetching = false
+	return sm.taskSeq
+}
 
+func (sm *SessionManager) runWorker(req Request, seq uint64) {
 	// Read client with lock if needed, but client itself is thread-safe (just struct with static fields)
 	// sm.client pointer exchange needs lock.
 	sm.mu.RLock()
@@ -282,52 +477,360 @@ func (sm *SessionManager) runWorker(req Request) {
 
 	if req.Type == "COMMAND" {
 		cmdReq, _ := req.Payload.(types.CommandRequest)
-		res, err = client.SendCommand(sm.SessionID, cmdReq)
-	} else {
-		promptReq, _ := req.Payload.(types.PromptRequest)
-		res, err = client.SendPrompt(sm.SessionID, promptReq)
+		res, err := client.SendCommand(sm.SessionID, cmdReq)
+		sm.workerDoneChan <- workerResult{Seq: seq, Result: res, Diff: sm.turnDiff(client, res), Error: err}
+		return
+	}
+
+	if req.Type == "SHELL" {
+		shellReq, _ := req.Payload.(types.ShellRequest)
+		res, err := client.RunShell(sm.SessionID, shellReq)
+		sm.workerDoneChan <- workerResult{Seq: seq, Result: res, Diff: sm.turnDiff(client, res), Error: err}
+		return
 	}
 
-	sm.workerDoneChan <- workerResult{Result: res, Error: err}
+	promptReq, _ := req.Payload.(types.PromptRequest)
+	err := client.PromptAsync(sm.SessionID, promptReq)
+	sm.workerDoneChan <- workerResult{Seq: seq, Error: err, Accepted: err == nil}
 }
 
 func (sm *SessionManager) handleWorkerDone(res workerResult) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	sm.isWorkerBusy = false
+	if res.Seq != sm.taskSeq || !sm.isWorkerBusy {
+		return
+	}
+
+	if res.Compacted {
+		sm.finishCompactionLocked(res.Error)
+		return
+	}
 
-	if sm.aborted {
-		sm.aborted = false
+	if res.Accepted {
+		sm.accepted = true
+		sm.maybeFetchResultLocked()
+		return
+	}
+
+	if res.Error != nil && sm.remoteBusy && !sm.remoteIdle {
+		// The HTTP call gave up but OpenCode is still working on it;
+		// session.idle will tell when it is done.
+		log.Printf("Session %s: %v; waiting for the session to go idle", sm.SessionID, res.Error)
+		sm.fetching = false
 		return
 	}
 
 	if res.Error != nil {
-		sm.LatestResponse = map[string]interface{}{"error": res.Error.Error()}
+		sm.finishTaskLocked(&Response{Error: res.Error.Error()})
 	} else {
-		sm.LatestResponse = map[string]interface{}{"result": res.Result}
+		sm.finishTaskLocked(&Response{Result: res.Result, Diff: res.Diff})
+		if res.Result != nil {
+			go sm.trackContext(res.Result.Info)
+		}
 	}
+}
 
-	if len(sm.Questions) > 0 {
-		sm.State = StateWaitingForInput
-	} else {
-		sm.State = StateIdle
+func (sm *SessionManager) finishTaskLocked(resp *Response) {
+	sm.isWorkerBusy = false
+	sm.accepted = false
+	sm.remoteBusy = false
+	sm.remoteIdle = false
+	sm.fetching = false
+	sm.LatestResponse = resp
+	sm.State = StateIdle
+	sm.updateWaitingStateLocked()
+	sm.notifyStateChange()
+}
+
+// setRemoteStatusLocked records OpenCode's status for the session ("idle",
+// "busy" or "retry") while a task is running.
+func (sm *SessionManager) setRemoteStatusLocked(status string) {
+	if !sm.isWorkerBusy {
+		return
+	}
+
+	switch status {
+	case "busy", "retry":
+		sm.remoteBusy = true
+	case "idle":
+		if sm.remoteBusy {
+			sm.remoteIdle = true
+			sm.maybeFetchResultLocked()
+		}
+	}
+}
+
+// maybeFetchResultLocked retrieves the task's final message once OpenCode has
+// accepted the task and gone idle again.
+func (sm *SessionManager) maybeFetchResultLocked() {
+	if !sm.accepted || !sm.remoteIdle || sm.fetching {
+		return
+	}
+	sm.fetching = true
+
+	client := sm.client
+	seq := sm.taskSeq
+	go func() {
+		res, err := client.LastAssistantMessage(sm.SessionID)
+		sm.workerDoneChan <- workerResult{Seq: seq, Result: res, Diff: sm.turnDiff(client, res), Error: err}
+	}()
+}
+
+// turnDiff returns the files changed by the turn that produced res, stripped
+// of their contents. A failure only costs the summary, so it is logged.
+func (sm *SessionManager) turnDiff(client *api.Client, res *api.AssistantResponse) []api.FileDiff {
+	if res == nil || res.Info.ParentID == "" {
+		return nil
+	}
+	diffs, err := client.GetSessionDiff(sm.SessionID, res.Info.ParentID)
+	if err != nil {
+		log.Printf("Session %s: failed to get the task's diff: %v", sm.SessionID, err)
+		return nil
+	}
+	for i := range diffs {
+		diffs[i].Before, diffs[i].After = "", ""
 	}
-	sm.OnStateChange(sm.SaveState())
+	return diffs
 }
 
-func (sm *SessionManager) pollQuestions() {
+// Diff returns the files changed in the session, with their contents, or
+// only those changed by the turn of the given user message.
+func (sm *SessionManager) Diff(messageID string) ([]api.FileDiff, error) {
 	sm.mu.RLock()
 	client := sm.client
 	sm.mu.RUnlock()
+	return client.GetSessionDiff(sm.SessionID, messageID)
+}
 
-	questions, err := client.GetQuestions()
-	if err != nil {
-		log.Printf("Poll error: %v", err)
+// History returns the session's last limit messages with their parts,
+// oldest first, or all of them if limit is 0.
+func (sm *SessionManager) History(limit int) ([]api.MessageWithParts, error) {
+	sm.mu.RLock()
+	client := sm.client
+	sm.mu.RUnlock()
+	return client.GetMessages(sm.SessionID, limit)
+}
+
+// Message returns one message of the session with its parts.
+func (sm *SessionManager) Message(messageID string) (*api.MessageWithParts, error) {
+	sm.mu.RLock()
+	client := sm.client
+	sm.mu.RUnlock()
+	return client.GetMessage(sm.SessionID, messageID)
+}
+
+// Agents returns the agents configured for the session's project.
+func (sm *SessionManager) Agents() ([]api.Agent, error) {
+	sm.mu.RLock()
+	client := sm.client
+	sm.mu.RUnlock()
+	return client.ListAgents()
+}
+
+// Resync reloads the session's status, pending questions and permissions,
+// todo list and revert point, for when its events were missed.
+func (sm *SessionManager) Resync() {
+	sm.mu.RLock()
+	client := sm.client
+	sm.mu.RUnlock()
+
+	sm.SyncTodos()
+	sm.SyncRevert()
+	if questions, err := client.GetQuestions(); err != nil {
+		log.Printf("Failed to resync questions for session %s: %v", sm.SessionID, err)
+	} else {
+		sm.SyncQuestions(questions)
+	}
+	if permissions, err := client.GetPermissions(); err != nil {
+		log.Printf("Failed to resync permissions for session %s: %v", sm.SessionID, err)
+	} else {
+		sm.SyncPermissions(permissions)
+	}
+	if statuses, err := client.GetSessionStatus(); err != nil {
+		log.Printf("Failed to resync status for session %s: %v", sm.SessionID, err)
+	} else {
+		sm.SyncStatus(statuses)
+	}
+}
+
+// SyncStatus applies the status of every busy session, as returned by GET
+// /session/status, after the event stream reconnects. A running task whose
+// session is no longer busy finished while events were missed.
+func (sm *SessionManager) SyncStatus(statuses map[string]api.SessionStatus) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if !sm.isWorkerBusy {
 		return
 	}
 
-	// Filter for this session
+	status, ok := statuses[sm.SessionID]
+	if ok && status.Type != "idle" {
+		sm.remoteBusy = true
+		return
+	}
+	if sm.accepted {
+		sm.remoteBusy = true
+		sm.setRemoteStatusLocked("idle")
+	}
+}
+
+// FollowRemoteStatus takes over a task OpenCode is already running for the
+// session, such as one started in the TUI before the session was adopted,
+// given the statuses from GET /session/status. An idle manager whose session
+// is busy reports BUSY and picks up the result when OpenCode goes idle.
+func (sm *SessionManager) FollowRemoteStatus(statuses map[string]api.SessionStatus) {
+	status, ok := statuses[sm.SessionID]
+	if !ok || status.Type == "idle" {
+		return
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.isWorkerBusy {
+		return
+	}
+	sm.startTaskLocked()
+	sm.accepted = true
+	sm.remoteBusy = true
+	sm.State = StateBusy
+	sm.updateWaitingStateLocked()
+	sm.notifyStateChange()
+}
+
+func (sm *SessionManager) handleEvent(ev api.Event) {
+	sm.mu.Lock()
+	sm.lastActivity = time.Now()
+	sm.mu.Unlock()
+
+	switch ev.Type {
+	case "session.status":
+		var changed api.SessionStatusChanged
+		if err := json.Unmarshal(ev.Properties, &changed); err != nil {
+			log.Printf("Failed to parse session status for session %s: %v", sm.SessionID, err)
+			return
+		}
+
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		sm.setRemoteStatusLocked(changed.Status.Type)
+
+	case "session.idle":
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		sm.setRemoteStatusLocked("idle")
+
+	case "question.asked":
+		var q api.Question
+		if err := json.Unmarshal(ev.Properties, &q); err != nil {
+			log.Printf("Failed to parse question for session %s: %v", sm.SessionID, err)
+			return
+		}
+
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		questions := []api.Question{}
+		for _, existing := range sm.Questions {
+			if existing.ID != q.ID {
+				questions = append(questions, existing)
+			}
+		}
+		sm.setQuestionsLocked(append(questions, q))
+
+	case "permission.asked":
+		var p api.PermissionRequest
+		if err := json.Unmarshal(ev.Properties, &p); err != nil {
+			log.Printf("Failed to parse permission request for session %s: %v", sm.SessionID, err)
+			return
+		}
+		if !sm.applyPolicy(p) {
+			sm.addPermission(p)
+		}
+
+	case "permission.replied":
+		var reply api.PermissionReplied
+		if err := json.Unmarshal(ev.Properties, &reply); err != nil {
+			log.Printf("Failed to parse permission reply for session %s: %v", sm.SessionID, err)
+			return
+		}
+		sm.removePermission(reply.RequestID)
+
+	case "todo.updated":
+		var updated api.TodoUpdated
+		if err := json.Unmarshal(ev.Properties, &updated); err != nil {
+			log.Printf("Failed to parse todo update for session %s: %v", sm.SessionID, err)
+			return
+		}
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		sm.setTodosLocked(updated.Todos)
+
+	case "session.updated":
+		var updated api.SessionUpdated
+		if err := json.Unmarshal(ev.Properties, &updated); err != nil {
+			log.Printf("Failed to parse session update for session %s: %v", sm.SessionID, err)
+			return
+		}
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		sm.setRevertLocked(updated.Info.Revert)
+
+	case "question.replied", "question.rejected":
+		var reply api.QuestionReply
+		if err := json.Unmarshal(ev.Properties, &reply); err != nil {
+			log.Printf("Failed to parse question reply for session %s: %v", sm.SessionID, err)
+			return
+		}
+
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		sm.removeQuestionLocked(reply.RequestID)
+	}
+}
+
+func (sm *SessionManager) removeQuestionLocked(requestID string) {
+	questions := []api.Question{}
+	for _, q := range sm.Questions {
+		if q.ID != requestID {
+			questions = append(questions, q)
+		}
+	}
+	sm.setQuestionsLocked(questions)
+}
+
+// rejectQuestion dismisses a pending question request, the oldest one if the
+// request does not name it. The agent carries on without an answer. It
+// returns OpenCode's error if the rejection failed, leaving the question
+// pending.
+func (sm *SessionManager) rejectQuestion(req types.RejectRequest) error {
+	sm.mu.RLock()
+	client := sm.client
+	if req.RequestID == "" && len(sm.Questions) > 0 {
+		req.RequestID = sm.Questions[0].ID
+	}
+	sm.mu.RUnlock()
+
+	if req.RequestID == "" {
+		return errors.New("no pending question to reject")
+	}
+
+	if err := client.RejectQuestion(req.RequestID); err != nil {
+		log.Printf("Reject failed: %v", err)
+		return err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.lastActivity = time.Now()
+	sm.removeQuestionLocked(req.RequestID)
+	return nil
+}
+
+// SyncQuestions replaces the pending questions with this session's entries in
+// questions, the full list from GET /question. It is used to resync after the
+// event stream reconnects.
+func (sm *SessionManager) SyncQuestions(questions []api.Question) {
 	sessionQuestions := []api.Question{}
 	for _, q := range questions {
 		if q.SessionID == sm.SessionID {
@@ -337,12 +840,30 @@ func (sm *SessionManager) pollQuestions() {
 
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	sm.setQuestionsLocked(sessionQuestions)
+}
+
+func (sm *SessionManager) setQuestionsLocked(questions []api.Question) {
+	changed := !sameQuestions(sm.Questions, questions)
+	prevState := sm.State
+	sm.Questions = questions
+	sm.updateWaitingStateLocked()
 
-	sm.Questions = sessionQuestions
+	if changed || sm.State != prevState {
+		sm.notifyStateChange()
+	}
+}
 
-	if len(sm.Questions) > 0 {
+// updateWaitingStateLocked derives the state from what OpenCode is waiting
+// on: questions first, then permissions. Once neither is pending the session
+// goes back to BUSY or IDLE depending on whether a task is running.
+func (sm *SessionManager) updateWaitingStateLocked() {
+	switch {
+	case len(sm.Questions) > 0:
 		sm.State = StateWaitingForInput
-	} else if sm.State == StateWaitingForInput {
+	case len(sm.Permissions) > 0:
+		sm.State = StateWaitingForPermission
+	case sm.State == StateWaitingForInput || sm.State == StateWaitingForPermission:
 		if sm.isWorkerBusy {
 			sm.State = StateBusy
 		} else {
@@ -351,17 +872,29 @@ func (sm *SessionManager) pollQuestions() {
 	}
 }
 
+func sameQuestions(a, b []api.Question) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			return false
+		}
+	}
+	return true
+}
+
 func (sm *SessionManager) checkAutoFix() {
 	sm.mu.RLock()
-	if len(sm.Questions) > 0 {
+	if len(sm.Questions) > 0 || len(sm.Permissions) > 0 {
 		sm.mu.RUnlock()
 		return
 	}
 
-	if sm.State == StateBusy && sm.isWorkerBusy {
-		if time.Since(sm.taskStartTime) > config.AutoFixTimeout {
+	if sm.State == StateBusy && sm.isWorkerBusy && !sm.compacting {
+		if time.Since(sm.lastActivity) > config.AutoFixTimeout {
 			sm.mu.RUnlock()
-			log.Printf("Session %s exceeded timeout. Triggering Auto-Fix.", sm.SessionID)
+			log.Printf("Session %s inactive for %v. Triggering Auto-Fix.", sm.SessionID, config.AutoFixTimeout)
 			go func() {
 				sm.inputChan <- Request{Type: "FIX"}
 			}()
@@ -386,10 +919,10 @@ func (sm *SessionManager) performFix() {
 
 	sm.mu.Lock()
 	// 3. Send Continue
-	sm.isWorkerBusy = true
 	sm.State = StateBusy
-	sm.taskStartTime = time.Now()
 	sm.LatestResponse = nil
+	seq := sm.startTaskLocked()
+	sm.notifyStateChange()
 	sm.mu.Unlock()
 
 	req := types.PromptRequest{
@@ -398,8 +931,5 @@ func (sm *SessionManager) performFix() {
 		Parts: []types.Part{{Type: "text", Text: "continue"}},
 	}
 
-	go func() {
-		res, err := client.SendPrompt(sm.SessionID, req)
-		sm.workerDoneChan <- workerResult{Result: res, Error: err}
-	}()
+	go sm.runWorker(Request{Type: "PROMPT", Payload: req}, seq)
 }
@@ -1,10 +1,17 @@
 package manager
 
 import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"opencode_skill/internal/api"
+	"opencode_skill/internal/config"
+	"opencode_skill/internal/policy"
+	"opencode_skill/internal/types"
 )
 
 func TestSessionManager_NewSessionManager_Defaults(t *testing.T) {
@@ -36,8 +43,9 @@ func TestSessionManager_RestoreFromPersistedState(t *testing.T) {
 		LastAgent:      "atlas",
 		IsAgentLocked:  true,
 		State:          "BUSY",
-		LatestResponse: `{"result": "test"}`,
+		LatestResponse: `{"result": {"info": {"id": "msg_1", "role": "assistant"}, "parts": [{"id": "prt_1", "type": "text", "text": "test"}]}}`,
 		Questions:      `[{"id": "q1", "sessionID": "s1", "questions": []}]`,
+		Revert:         `{"messageID": "msg_2"}`,
 		LastActivity:   "2026-02-16T14:00:00Z",
 	}
 
@@ -52,8 +60,11 @@ func TestSessionManager_RestoreFromPersistedState(t *testing.T) {
 	if sm.State != StateBusy {
 		t.Errorf("Expected State BUSY, got %s", sm.State)
 	}
-	if sm.LatestResponse == nil {
-		t.Errorf("Expected LatestResponse to be set, got nil")
+	if sm.LatestResponse == nil || sm.LatestResponse.Result == nil {
+		t.Fatalf("Expected LatestResponse result to be set, got %+v", sm.LatestResponse)
+	}
+	if got := sm.LatestResponse.Result.Text(); got != "test" {
+		t.Errorf("Expected response text test, got %q", got)
 	}
 	if len(sm.Questions) != 1 {
 		t.Errorf("Expected 1 Question, got %d", len(sm.Questions))
@@ -61,6 +72,9 @@ func TestSessionManager_RestoreFromPersistedState(t *testing.T) {
 	if sm.Questions[0].ID != "q1" {
 		t.Errorf("Expected Question ID q1, got %s", sm.Questions[0].ID)
 	}
+	if sm.Revert == nil || sm.Revert.MessageID != "msg_2" {
+		t.Errorf("Expected revert point msg_2, got %+v", sm.Revert)
+	}
 }
 
 func TestSessionManager_RestoreFromPersistedState_EmptyQuestions(t *testing.T) {
@@ -107,7 +121,7 @@ func TestSessionManager_SaveState(t *testing.T) {
 	sm.isAgentLocked = true
 	sm.State = StateBusy
 	sm.Questions = []api.Question{{ID: "q1", SessionID: "test-session"}}
-	sm.LatestResponse = map[string]interface{}{"result": "success"}
+	sm.LatestResponse = &Response{Error: "failed"}
 	sm.lastActivity = time.Date(2026, 2, 16, 14, 0, 0, 0, time.UTC)
 
 	state := sm.SaveState()
@@ -140,7 +154,7 @@ func TestSessionManager_SaveState_RoundTrip(t *testing.T) {
 		IsAgentLocked:  true,
 		State:          "WAITING_FOR_INPUT",
 		Questions:      `[{"id":"q1","sessionID":"s1","questions":[]}]`,
-		LatestResponse: `{"result":"ok"}`,
+		LatestResponse: `{"status":"aborted","message":"Task aborted by user"}`,
 		LastActivity:   "2026-02-16T10:30:00Z",
 	}
 
@@ -186,3 +200,713 @@ func TestSessionManager_SetAgentLocked(t *testing.T) {
 		t.Errorf("Expected isAgentLocked false, got true")
 	}
 }
+
+func TestSessionManager_HandleEvent_Questions(t *testing.T) {
+	t.Parallel()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	var notified []string
+	sm.OnStateChange = func(state PersistedState) {
+		notified = append(notified, state.State)
+	}
+
+	sm.handleEvent(api.Event{Type: "question.asked", Properties: []byte(`{"id":"que_1","sessionID":"ses_1","questions":[{"question":"Which linter?"}]}`)})
+
+	if sm.State != StateWaitingForInput {
+		t.Errorf("Expected State WAITING_FOR_INPUT, got %s", sm.State)
+	}
+	if len(sm.Questions) != 1 || sm.Questions[0].ID != "que_1" {
+		t.Fatalf("Expected question que_1, got %+v", sm.Questions)
+	}
+
+	sm.handleEvent(api.Event{Type: "question.replied", Properties: []byte(`{"sessionID":"ses_1","requestID":"que_1","answers":[]}`)})
+
+	if sm.State != StateIdle {
+		t.Errorf("Expected State IDLE after reply, got %s", sm.State)
+	}
+	if len(sm.Questions) != 0 {
+		t.Errorf("Expected no questions after reply, got %d", len(sm.Questions))
+	}
+	if len(notified) != 2 {
+		t.Errorf("Expected 2 state notifications, got %v", notified)
+	}
+}
+
+func TestSessionManager_SyncQuestions(t *testing.T) {
+	t.Parallel()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.SyncQuestions([]api.Question{
+		{ID: "que_1", SessionID: "ses_1"},
+		{ID: "que_2", SessionID: "ses_other"},
+	})
+
+	if len(sm.Questions) != 1 || sm.Questions[0].ID != "que_1" {
+		t.Errorf("Expected only que_1 for this session, got %+v", sm.Questions)
+	}
+	if sm.State != StateWaitingForInput {
+		t.Errorf("Expected State WAITING_FOR_INPUT, got %s", sm.State)
+	}
+}
+
+// fakeOpenCode serves prompt_async and the session's messages, reporting each
+// accepted prompt on the returned channel.
+func fakeOpenCode(t *testing.T, messages string) (*httptest.Server, <-chan struct{}) {
+	t.Helper()
+
+	prompted := make(chan struct{}, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /session/ses_1/prompt_async", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+		prompted <- struct{}{}
+	})
+	mux.HandleFunc("GET /session/ses_1/message", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(messages))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, prompted
+}
+
+func waitForSnapshot(t *testing.T, sm *SessionManager, cond func(Snapshot) bool) Snapshot {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if snap := sm.GetSnapshot(); cond(snap) {
+			return snap
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for snapshot, last: %+v", sm.GetSnapshot())
+	return Snapshot{}
+}
+
+func TestSessionManager_PromptCompletesOnIdle(t *testing.T) {
+	t.Parallel()
+
+	srv, prompted := fakeOpenCode(t, `[
+		{"info": {"id": "msg_1", "sessionID": "ses_1", "role": "user"}, "parts": [{"type": "text", "text": "hi"}]},
+		{"info": {"id": "msg_2", "sessionID": "ses_1", "role": "assistant"}, "parts": [{"type": "text", "text": "done"}]}
+	]`)
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+	sm.Start()
+	defer sm.Stop()
+
+	sm.SubmitRequest(Request{Type: "PROMPT", Payload: types.PromptRequest{Agent: "sisyphus"}})
+	<-prompted
+
+	// An idle report before OpenCode picked the prompt up does not end the task
+	sm.HandleEvent(api.Event{Type: "session.idle", Properties: []byte(`{"sessionID":"ses_1"}`)})
+	sm.HandleEvent(api.Event{Type: "session.status", Properties: []byte(`{"sessionID":"ses_1","status":{"type":"busy"}}`)})
+	time.Sleep(20 * time.Millisecond)
+	if state := sm.GetSnapshot().State; state != StateBusy {
+		t.Fatalf("Expected BUSY while OpenCode works, got %s", state)
+	}
+
+	sm.HandleEvent(api.Event{Type: "session.idle", Properties: []byte(`{"sessionID":"ses_1"}`)})
+	snap := waitForSnapshot(t, sm, func(s Snapshot) bool { return s.State == StateIdle })
+
+	if snap.LatestResponse == nil || snap.LatestResponse.Result == nil || snap.LatestResponse.Result.Text() != "done" {
+		t.Errorf("Expected the last assistant message as result, got %+v", snap.LatestResponse)
+	}
+}
+
+func TestSessionManager_Shell(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /session/ses_1/shell", func(w http.ResponseWriter, r *http.Request) {
+		var req types.ShellRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Command != "ls" || req.Agent != "sisyphus" {
+			t.Errorf("Unexpected shell request: %+v", req)
+		}
+		w.Write([]byte(`{"id": "msg_2", "sessionID": "ses_1", "role": "assistant", "parentID": "msg_1"}`))
+	})
+	mux.HandleFunc("GET /session/ses_1/message/msg_2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"info": {"id": "msg_2", "sessionID": "ses_1", "role": "assistant", "parentID": "msg_1"},
+			"parts": [{"type": "tool", "tool": "bash", "state": {"status": "completed", "output": "main.go\n"}}]}`))
+	})
+	mux.HandleFunc("GET /session/ses_1/diff", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+	sm.Start()
+	defer sm.Stop()
+
+	sm.SubmitRequest(Request{Type: "SHELL", Payload: types.ShellRequest{Agent: "sisyphus", Command: "ls"}})
+	snap := waitForSnapshot(t, sm, func(s Snapshot) bool { return s.State == StateIdle })
+
+	if snap.LatestResponse == nil || snap.LatestResponse.Result == nil {
+		t.Fatalf("Expected the shell message as result, got %+v", snap.LatestResponse)
+	}
+	if id := snap.LatestResponse.Result.Info.ID; id != "msg_2" {
+		t.Errorf("Expected result msg_2, got %s", id)
+	}
+	if len(snap.LatestResponse.Result.Parts) != 1 {
+		t.Errorf("Expected the bash tool part, got %+v", snap.LatestResponse.Result.Parts)
+	}
+}
+
+func TestSessionManager_TurnDiff(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /session/ses_1/diff", func(w http.ResponseWriter, r *http.Request) {
+		if id := r.URL.Query().Get("messageID"); id != "msg_1" {
+			t.Errorf("Expected the diff of the prompt msg_1, got %q", id)
+		}
+		w.Write([]byte(`[{"file":"a.go","before":"x\n","after":"y\n","additions":1,"deletions":1}]`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+
+	res := &api.AssistantResponse{Info: api.AssistantMessage{ID: "msg_2", ParentID: "msg_1"}}
+	diffs := sm.turnDiff(sm.client, res)
+	if len(diffs) != 1 || diffs[0].File != "a.go" || diffs[0].Additions != 1 {
+		t.Fatalf("Unexpected diff: %+v", diffs)
+	}
+	if diffs[0].Before != "" || diffs[0].After != "" {
+		t.Errorf("Expected file contents to be dropped, got %+v", diffs[0])
+	}
+
+	if diffs := sm.turnDiff(sm.client, &api.AssistantResponse{}); diffs != nil {
+		t.Errorf("Expected no diff without a parent message, got %+v", diffs)
+	}
+}
+
+func TestSessionManager_SyncStatus_FinishesMissedTask(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := fakeOpenCode(t, `[{"info": {"id": "msg_2", "sessionID": "ses_1", "role": "assistant"}, "parts": [{"type": "text", "text": "done"}]}]`)
+
+	// A daemon restarted mid-task restores it as accepted
+	sm := NewSessionManager("ses_1", "/tmp", &PersistedState{State: "BUSY"})
+	sm.client.BaseURL = srv.URL
+	sm.Start()
+	defer sm.Stop()
+
+	sm.SyncStatus(map[string]api.SessionStatus{"ses_1": {Type: "busy"}})
+	if state := sm.GetSnapshot().State; state != StateBusy {
+		t.Fatalf("Expected BUSY while OpenCode reports busy, got %s", state)
+	}
+
+	sm.SyncStatus(map[string]api.SessionStatus{})
+	snap := waitForSnapshot(t, sm, func(s Snapshot) bool { return s.State == StateIdle })
+	if snap.LatestResponse == nil || snap.LatestResponse.Result.Text() != "done" {
+		t.Errorf("Expected the last assistant message as result, got %+v", snap.LatestResponse)
+	}
+}
+
+func TestSessionManager_HandleWorkerDone(t *testing.T) {
+	t.Parallel()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	seq := sm.startTaskLocked()
+	sm.State = StateBusy
+	sm.remoteBusy = true
+
+	// A transport error while OpenCode is still busy keeps waiting
+	sm.handleWorkerDone(workerResult{Seq: seq, Error: errors.New("timeout")})
+	if !sm.isWorkerBusy || sm.State != StateBusy {
+		t.Fatalf("Expected task to keep running, got busy=%v state=%s", sm.isWorkerBusy, sm.State)
+	}
+
+	// Results of an earlier task are ignored
+	sm.handleWorkerDone(workerResult{Seq: seq - 1, Result: &api.AssistantResponse{}})
+	if !sm.isWorkerBusy {
+		t.Fatal("Expected a stale result to be ignored")
+	}
+
+	sm.handleWorkerDone(workerResult{Seq: seq, Result: &api.AssistantResponse{}})
+	if sm.isWorkerBusy || sm.State != StateIdle || sm.LatestResponse == nil {
+		t.Errorf("Expected task to finish, got busy=%v state=%s response=%+v", sm.isWorkerBusy, sm.State, sm.LatestResponse)
+	}
+}
+
+func TestSessionManager_CheckAutoFix_Inactivity(t *testing.T) {
+	t.Parallel()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.startTaskLocked()
+	sm.State = StateBusy
+	sm.taskStartTime = time.Now().Add(-2 * config.AutoFixTimeout)
+
+	// A long task that is still producing events is left alone
+	sm.checkAutoFix()
+	select {
+	case req := <-sm.inputChan:
+		t.Fatalf("Expected no auto-fix for an active task, got %s", req.Type)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	sm.lastActivity = time.Now().Add(-2 * config.AutoFixTimeout)
+	sm.checkAutoFix()
+	select {
+	case req := <-sm.inputChan:
+		if req.Type != "FIX" {
+			t.Errorf("Expected FIX request, got %s", req.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected auto-fix for an inactive task")
+	}
+}
+
+func TestSessionManager_HandleEvent_Permissions(t *testing.T) {
+	t.Parallel()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.startTaskLocked()
+	sm.State = StateBusy
+
+	sm.handleEvent(api.Event{Type: "permission.asked", Properties: []byte(`{"id":"per_1","sessionID":"ses_1","permission":"bash","patterns":["rm -rf build"],"metadata":{},"always":["rm *"]}`)})
+
+	if sm.State != StateWaitingForPermission {
+		t.Errorf("Expected State WAITING_FOR_PERMISSION, got %s", sm.State)
+	}
+	if len(sm.Permissions) != 1 || sm.Permissions[0].Patterns[0] != "rm -rf build" {
+		t.Fatalf("Expected permission per_1, got %+v", sm.Permissions)
+	}
+
+	// A question takes precedence over a pending permission
+	sm.handleEvent(api.Event{Type: "question.asked", Properties: []byte(`{"id":"que_1","sessionID":"ses_1","questions":[]}`)})
+	if sm.State != StateWaitingForInput {
+		t.Errorf("Expected State WAITING_FOR_INPUT, got %s", sm.State)
+	}
+	sm.handleEvent(api.Event{Type: "question.replied", Properties: []byte(`{"sessionID":"ses_1","requestID":"que_1"}`)})
+	if sm.State != StateWaitingForPermission {
+		t.Errorf("Expected State WAITING_FOR_PERMISSION after the question, got %s", sm.State)
+	}
+
+	sm.handleEvent(api.Event{Type: "permission.replied", Properties: []byte(`{"sessionID":"ses_1","requestID":"per_1","reply":"once"}`)})
+
+	if sm.State != StateBusy {
+		t.Errorf("Expected State BUSY after reply, got %s", sm.State)
+	}
+	if len(sm.Permissions) != 0 {
+		t.Errorf("Expected no permissions after reply, got %d", len(sm.Permissions))
+	}
+}
+
+func TestSessionManager_HandleEvent_PermissionPolicy(t *testing.T) {
+	t.Parallel()
+
+	replies := make(chan string, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /permission/{id}/reply", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Reply string }
+		json.NewDecoder(r.Body).Decode(&body)
+		replies <- r.PathValue("id") + " " + body.Reply
+		w.Write([]byte("true"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/work", nil)
+	sm.client.BaseURL = srv.URL
+	sm.SetPolicy(policy.Policy{
+		{Permission: "edit", Pattern: "{workdir}/*", Action: policy.Allow},
+		{Permission: "bash", Pattern: "*git push*", Action: policy.Reject},
+	})
+	sm.startTaskLocked()
+	sm.State = StateBusy
+
+	sm.handleEvent(api.Event{Type: "permission.asked", Properties: []byte(`{"id":"per_1","sessionID":"ses_1","permission":"edit","patterns":["main.go"]}`)})
+	sm.handleEvent(api.Event{Type: "permission.asked", Properties: []byte(`{"id":"per_2","sessionID":"ses_1","permission":"bash","patterns":["git push origin main"]}`)})
+	sm.handleEvent(api.Event{Type: "permission.asked", Properties: []byte(`{"id":"per_3","sessionID":"ses_1","permission":"bash","patterns":["make"]}`)})
+
+	// Replies are sent concurrently, so they may arrive in any order
+	got := map[string]bool{<-replies: true, <-replies: true}
+	for _, want := range []string{"per_1 once", "per_2 reject"} {
+		if !got[want] {
+			t.Errorf("Expected reply %q, got %v", want, got)
+		}
+	}
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if len(sm.Permissions) != 1 || sm.Permissions[0].ID != "per_3" {
+		t.Fatalf("Expected only the unmatched request pending, got %+v", sm.Permissions)
+	}
+	if sm.State != StateWaitingForPermission {
+		t.Errorf("Expected State WAITING_FOR_PERMISSION, got %s", sm.State)
+	}
+}
+
+func TestSessionManager_ReplyPermissionError(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /permission/{id}/reply", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown request", http.StatusNotFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+	sm.SyncPermissions([]api.PermissionRequest{{ID: "per_1", SessionID: "ses_1"}})
+
+	result := make(chan error, 1)
+	sm.handleRequest(Request{Type: "PERMIT", Payload: types.PermitRequest{Reply: "once"}, ResultChan: result})
+	if err := <-result; err == nil {
+		t.Error("Expected the failed reply to be returned")
+	}
+	if len(sm.Permissions) != 1 {
+		t.Errorf("Expected the request to stay pending, got %+v", sm.Permissions)
+	}
+}
+
+func TestSessionManager_RejectQuestion(t *testing.T) {
+	t.Parallel()
+
+	rejected := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /question/{id}/reject", func(w http.ResponseWriter, r *http.Request) {
+		rejected <- r.PathValue("id")
+		w.Write([]byte("true"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+	sm.startTaskLocked()
+	sm.State = StateBusy
+	sm.SyncQuestions([]api.Question{{ID: "que_1", SessionID: "ses_1"}, {ID: "que_2", SessionID: "ses_1"}})
+
+	sm.handleRequest(Request{Type: "REJECT", Payload: types.RejectRequest{}})
+	if id := <-rejected; id != "que_1" {
+		t.Errorf("Expected the oldest question to be rejected, got %s", id)
+	}
+	if sm.State != StateWaitingForInput {
+		t.Errorf("Expected State WAITING_FOR_INPUT with a question left, got %s", sm.State)
+	}
+
+	sm.handleRequest(Request{Type: "REJECT", Payload: types.RejectRequest{RequestID: "que_2"}})
+	if id := <-rejected; id != "que_2" {
+		t.Errorf("Expected que_2 to be rejected, got %s", id)
+	}
+	if sm.State != StateBusy || len(sm.Questions) != 0 {
+		t.Errorf("Expected State BUSY with no questions, got %s with %d", sm.State, len(sm.Questions))
+	}
+}
+
+func TestSessionManager_RejectQuestionError(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /question/{id}/reject", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown request", http.StatusNotFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+	sm.SyncQuestions([]api.Question{{ID: "que_1", SessionID: "ses_1"}})
+
+	result := make(chan error, 1)
+	sm.handleRequest(Request{Type: "REJECT", Payload: types.RejectRequest{}, ResultChan: result})
+	if err := <-result; err == nil {
+		t.Error("Expected the failed rejection to be returned")
+	}
+	if len(sm.Questions) != 1 {
+		t.Errorf("Expected the question to stay pending, got %+v", sm.Questions)
+	}
+}
+
+func TestSessionManager_UndoRedo(t *testing.T) {
+	t.Parallel()
+
+	reverted := make(chan string, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /session/ses_1/message", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"info": {"id": "msg_1", "sessionID": "ses_1", "role": "user"}},
+			{"info": {"id": "msg_2", "sessionID": "ses_1", "role": "assistant"}},
+			{"info": {"id": "msg_3", "sessionID": "ses_1", "role": "user"}},
+			{"info": {"id": "msg_4", "sessionID": "ses_1", "role": "assistant"}}
+		]`))
+	})
+	mux.HandleFunc("POST /session/ses_1/revert", func(w http.ResponseWriter, r *http.Request) {
+		var body types.RevertRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		reverted <- body.MessageID
+		w.Write([]byte(`{"id":"ses_1","revert":{"messageID":"` + body.MessageID + `"}}`))
+	})
+	mux.HandleFunc("POST /session/ses_1/unrevert", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"ses_1"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+
+	// Each undo steps back one user message
+	sm.handleRequest(Request{Type: "UNDO", Payload: types.RevertRequest{}})
+	if id := <-reverted; id != "msg_3" {
+		t.Errorf("Expected the first undo to revert msg_3, got %s", id)
+	}
+	sm.handleRequest(Request{Type: "UNDO", Payload: types.RevertRequest{}})
+	if id := <-reverted; id != "msg_1" {
+		t.Errorf("Expected the second undo to revert msg_1, got %s", id)
+	}
+	if snap := sm.GetSnapshot(); snap.Revert == nil || snap.Revert.MessageID != "msg_1" {
+		t.Errorf("Expected revert point msg_1, got %+v", snap.Revert)
+	}
+
+	sm.handleRequest(Request{Type: "REDO"})
+	if snap := sm.GetSnapshot(); snap.Revert != nil {
+		t.Errorf("Expected no revert point after redo, got %+v", snap.Revert)
+	}
+}
+
+func TestSessionManager_UndoRedoErrors(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /session/ses_1/message", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"info": {"id": "msg_1", "sessionID": "ses_1", "role": "assistant"}}]`))
+	})
+	mux.HandleFunc("POST /session/ses_1/unrevert", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "session is busy", http.StatusBadRequest)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+
+	result := make(chan error, 1)
+	sm.handleRequest(Request{Type: "UNDO", Payload: types.RevertRequest{}, ResultChan: result})
+	if err := <-result; !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Expected ErrNothingToUndo without user messages, got %v", err)
+	}
+
+	result = make(chan error, 1)
+	sm.handleRequest(Request{Type: "REDO", ResultChan: result})
+	if err := <-result; err == nil {
+		t.Error("Expected the failed unrevert to be returned")
+	}
+}
+
+func TestSessionManager_HandleEvent_SessionUpdated(t *testing.T) {
+	t.Parallel()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	var saved []string
+	sm.OnStateChange = func(state PersistedState) {
+		saved = append(saved, state.Revert)
+	}
+
+	sm.handleEvent(api.Event{Type: "session.updated", Properties: []byte(`{"info":{"id":"ses_1","revert":{"messageID":"msg_3"}}}`)})
+	if sm.Revert == nil || sm.Revert.MessageID != "msg_3" {
+		t.Fatalf("Expected revert point msg_3, got %+v", sm.Revert)
+	}
+
+	// Title changes leave the revert point alone
+	sm.handleEvent(api.Event{Type: "session.updated", Properties: []byte(`{"info":{"id":"ses_1","title":"New","revert":{"messageID":"msg_3"}}}`)})
+
+	// A new prompt clears it
+	sm.handleEvent(api.Event{Type: "session.updated", Properties: []byte(`{"info":{"id":"ses_1"}}`)})
+	if sm.Revert != nil {
+		t.Errorf("Expected no revert point, got %+v", sm.Revert)
+	}
+	if len(saved) != 2 || saved[1] != "null" {
+		t.Errorf("Expected 2 state notifications ending with no revert, got %v", saved)
+	}
+}
+
+func TestSessionManager_Todos(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /session/ses_1/todo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id":"1","content":"Plan","status":"completed","priority":"high"}]`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+	notified := 0
+	sm.OnStateChange = func(state PersistedState) {
+		notified++
+	}
+
+	sm.SyncTodos()
+	if snap := sm.GetSnapshot(); len(snap.Todos) != 1 || snap.Todos[0].Content != "Plan" {
+		t.Fatalf("Expected the synced todo list, got %+v", snap.Todos)
+	}
+
+	sm.handleEvent(api.Event{Type: "todo.updated", Properties: []byte(`{"sessionID":"ses_1","todos":[
+		{"id":"1","content":"Plan","status":"completed","priority":"high"},
+		{"id":"2","content":"Build","status":"in_progress","priority":"medium"}
+	]}`)})
+	snap := sm.GetSnapshot()
+	if len(snap.Todos) != 2 || snap.Todos[1].Status != "in_progress" {
+		t.Errorf("Expected 2 todos after todo.updated, got %+v", snap.Todos)
+	}
+
+	// Reloading the same list is not a state change
+	sm.handleEvent(api.Event{Type: "todo.updated", Properties: []byte(`{"sessionID":"ses_1","todos":[
+		{"id":"1","content":"Plan","status":"completed","priority":"high"},
+		{"id":"2","content":"Build","status":"in_progress","priority":"medium"}
+	]}`)})
+	if notified != 2 {
+		t.Errorf("Expected 2 state notifications, got %d", notified)
+	}
+
+	restored := NewSessionManager("ses_1", "/tmp", &PersistedState{State: "IDLE", Todos: sm.SaveState().Todos})
+	if len(restored.Todos) != 2 {
+		t.Errorf("Expected todos to survive a restore, got %+v", restored.Todos)
+	}
+}
+
+func TestSessionManager_Compact(t *testing.T) {
+	t.Parallel()
+
+	summarized := make(chan map[string]interface{}, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /session/ses_1/summarize", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		summarized <- body
+		w.Write([]byte("true"))
+	})
+	mux.HandleFunc("GET /config/providers", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"providers":[{"id":"acme","models":{"big":{"id":"big","limit":{"context":1000,"output":100}}}}]}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+
+	// A manual compaction is a task of its own, with the default model
+	sm.handleRequest(Request{Type: "COMPACT", Payload: types.CompactRequest{}})
+	if state := sm.GetSnapshot().State; state != StateBusy {
+		t.Errorf("Expected BUSY while compacting, got %s", state)
+	}
+	if body := <-summarized; body["modelID"] != "glm-5" || body["auto"] != false {
+		t.Errorf("Expected a manual compaction with the default model, got %v", body)
+	}
+	sm.handleWorkerDone(<-sm.workerDoneChan)
+	snap := sm.GetSnapshot()
+	if snap.State != StateIdle || snap.LatestResponse == nil || snap.LatestResponse.Status != "compacted" {
+		t.Fatalf("Expected IDLE with a compacted response, got %s %+v", snap.State, snap.LatestResponse)
+	}
+
+	// Past the threshold, a finished reply queues an automatic compaction
+	// with the reply's model that keeps the reply as latest response
+	sm.SetAutoCompact(80)
+	reply := &Response{Result: &api.AssistantResponse{}}
+	sm.LatestResponse = reply
+	info := api.AssistantMessage{ProviderID: "acme", ModelID: "big"}
+	info.Tokens.Input = 700
+	info.Tokens.Output = 50
+	info.Tokens.Cache.Read = 100
+	sm.trackContext(info)
+
+	if snap := sm.GetSnapshot(); snap.Context == nil || snap.Context.Tokens != 850 || snap.Context.Limit != 1000 {
+		t.Errorf("Expected 850 of 1000 tokens used, got %+v", snap.Context)
+	}
+	req := <-sm.inputChan
+	if payload, _ := req.Payload.(types.CompactRequest); req.Type != "COMPACT" || !payload.Auto {
+		t.Fatalf("Expected an automatic compaction, got %+v", req)
+	}
+	sm.handleRequest(req)
+	if body := <-summarized; body["modelID"] != "big" || body["auto"] != true {
+		t.Errorf("Expected an automatic compaction with the reply's model, got %v", body)
+	}
+	sm.handleWorkerDone(<-sm.workerDoneChan)
+	snap = sm.GetSnapshot()
+	if snap.State != StateIdle || snap.LatestResponse != reply || snap.Context != nil {
+		t.Errorf("Expected IDLE with the reply kept and context reset, got %s %+v %+v", snap.State, snap.LatestResponse, snap.Context)
+	}
+
+	// Below the threshold nothing happens
+	info.Tokens.Input = 100
+	sm.trackContext(info)
+	select {
+	case req := <-sm.inputChan:
+		t.Errorf("Expected no compaction below the threshold, got %+v", req)
+	default:
+	}
+}
+
+func TestSessionManager_SyncPermissions(t *testing.T) {
+	t.Parallel()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.SyncPermissions([]api.PermissionRequest{
+		{ID: "per_1", SessionID: "ses_1", Permission: "edit"},
+		{ID: "per_2", SessionID: "ses_other", Permission: "bash"},
+	})
+
+	if len(sm.Permissions) != 1 || sm.Permissions[0].ID != "per_1" {
+		t.Fatalf("Expected only this session's permission, got %+v", sm.Permissions)
+	}
+	if state := sm.SaveState(); state.Permissions == "" || state.Permissions == "[]" {
+		t.Errorf("Expected permissions in persisted state, got %q", state.Permissions)
+	}
+
+	sm.SyncPermissions(nil)
+	if sm.State != StateIdle {
+		t.Errorf("Expected State IDLE once permissions are gone, got %s", sm.State)
+	}
+}
+
+func TestSessionManager_HandleEventOverflow(t *testing.T) {
+	t.Parallel()
+
+	resynced := make(chan struct{}, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /session/status", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case resynced <- struct{}{}:
+		default:
+		}
+		w.Write([]byte(`{}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sm := NewSessionManager("ses_1", "/tmp", nil)
+	sm.client.BaseURL = srv.URL
+
+	// With the loop not running, a full queue must not block the dispatcher
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < cap(sm.eventChan)+10; i++ {
+			sm.HandleEvent(api.Event{Type: "session.updated"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("HandleEvent blocked on a full queue")
+	}
+	if !sm.eventsDropped.Load() {
+		t.Fatal("Expected dropped events to be recorded")
+	}
+
+	sm.Start()
+	defer sm.Stop()
+	select {
+	case <-resynced:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a resync once the queue drained")
+	}
+}
@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/policy"
+	"opencode_skill/internal/types"
+)
+
+// addPermission records a pending permission request, replacing an earlier
+// copy of the same request.
+func (sm *SessionManager) addPermission(p api.PermissionRequest) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	permissions := []api.PermissionRequest{}
+	for _, existing := range sm.Permissions {
+		if existing.ID != p.ID {
+			permissions = append(permissions, existing)
+		}
+	}
+	sm.setPermissionsLocked(append(permissions, p))
+}
+
+func (sm *SessionManager) removePermission(requestID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	permissions := []api.PermissionRequest{}
+	for _, p := range sm.Permissions {
+		if p.ID != requestID {
+			permissions = append(permissions, p)
+		}
+	}
+	sm.setPermissionsLocked(permissions)
+}
+
+// SyncPermissions replaces the pending permissions with this session's
+// entries in permissions, the full list from GET /permission.
+func (sm *SessionManager) SyncPermissions(permissions []api.PermissionRequest) {
+	sessionPermissions := []api.PermissionRequest{}
+	for _, p := range permissions {
+		if p.SessionID == sm.SessionID {
+			sessionPermissions = append(sessionPermissions, p)
+		}
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.setPermissionsLocked(sessionPermissions)
+}
+
+func (sm *SessionManager) setPermissionsLocked(permissions []api.PermissionRequest) {
+	changed := len(permissions) != len(sm.Permissions)
+	for i := 0; !changed && i < len(permissions); i++ {
+		changed = permissions[i].ID != sm.Permissions[i].ID
+	}
+	prevState := sm.State
+	sm.Permissions = permissions
+	sm.updateWaitingStateLocked()
+
+	if changed || sm.State != prevState {
+		sm.notifyStateChange()
+	}
+}
+
+// applyPolicy decides p by the session's permission policy and reports
+// whether the policy answers it. Every decision is logged, including those
+// left to a human. The reply is sent off the event loop; if it fails, the
+// request is left pending for a human after all.
+func (sm *SessionManager) applyPolicy(p api.PermissionRequest) bool {
+	sm.mu.RLock()
+	rules := sm.policy
+	client := sm.client
+	sm.mu.RUnlock()
+
+	if len(rules) == 0 {
+		return false
+	}
+
+	decision := rules.Evaluate(p.Permission, p.Patterns, client.WorkingDir)
+	log.Printf("Session %s: permission %s %q: %s", sm.SessionID, p.Permission, p.Patterns, decision)
+
+	var reply, message string
+	switch decision.Action {
+	case policy.Allow:
+		reply = "once"
+	case policy.Reject:
+		reply = "reject"
+		message = fmt.Sprintf("Rejected by the session's permission policy (%s)", decision.Rule)
+	default:
+		return false
+	}
+
+	go func() {
+		if err := client.ReplyPermission(p.ID, reply, message); err != nil {
+			log.Printf("Permission reply failed, leaving request %s pending: %v", p.ID, err)
+			sm.addPermission(p)
+			return
+		}
+
+		sm.mu.Lock()
+		sm.lastActivity = time.Now()
+		sm.mu.Unlock()
+	}()
+	return true
+}
+
+// replyPermission answers a pending permission request, the oldest one if
+// the request does not name it. It returns OpenCode's error if the reply
+// failed, leaving the request pending.
+func (sm *SessionManager) replyPermission(req types.PermitRequest) error {
+	sm.mu.RLock()
+	client := sm.client
+	if req.RequestID == "" && len(sm.Permissions) > 0 {
+		req.RequestID = sm.Permissions[0].ID
+	}
+	sm.mu.RUnlock()
+
+	if req.RequestID == "" {
+		return errors.New("no pending permission to reply to")
+	}
+
+	if err := client.ReplyPermission(req.RequestID, req.Reply, req.Message); err != nil {
+		log.Printf("Permission reply failed: %v", err)
+		return err
+	}
+
+	sm.mu.Lock()
+	sm.lastActivity = time.Now()
+	sm.mu.Unlock()
+	sm.removePermission(req.RequestID)
+	return nil
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"opencode_skill/internal/api"
+	"opencode_skill/internal/types"
+)
+
+// ErrNothingToUndo is returned by an undo when no user message precedes the
+// current revert point.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// undo reverts the session to before req.MessageID, or before the last user
+// message preceding the current revert point, so repeated undos step back
+// one turn at a time. It returns OpenCode's error if the revert failed.
+func (sm *SessionManager) undo(req types.RevertRequest) error {
+	sm.mu.RLock()
+	client := sm.client
+	before := ""
+	if sm.Revert != nil {
+		before = sm.Revert.MessageID
+	}
+	sm.mu.RUnlock()
+
+	if req.MessageID == "" {
+		messages, err := client.GetMessages(sm.SessionID, 0)
+		if err != nil {
+			log.Printf("Undo failed: %v", err)
+			return err
+		}
+		req.MessageID = previousUserMessage(messages, before)
+		if req.MessageID == "" {
+			return ErrNothingToUndo
+		}
+	}
+
+	session, err := client.RevertSession(sm.SessionID, req.MessageID, req.PartID)
+	if err != nil {
+		log.Printf("Undo failed: %v", err)
+		return err
+	}
+	log.Printf("Session %s: reverted to before message %s", sm.SessionID, req.MessageID)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.lastActivity = time.Now()
+	sm.setRevertLocked(session.Revert)
+	return nil
+}
+
+// redo restores everything undone since the last prompt. It returns
+// OpenCode's error if the unrevert failed.
+func (sm *SessionManager) redo() error {
+	sm.mu.RLock()
+	client := sm.client
+	sm.mu.RUnlock()
+
+	session, err := client.UnrevertSession(sm.SessionID)
+	if err != nil {
+		log.Printf("Redo failed: %v", err)
+		return err
+	}
+	log.Printf("Session %s: unreverted", sm.SessionID)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.lastActivity = time.Now()
+	sm.setRevertLocked(session.Revert)
+	return nil
+}
+
+// SyncRevert loads the session's revert point from OpenCode, which may have
+// changed while the daemon was not watching.
+func (sm *SessionManager) SyncRevert() {
+	sm.mu.RLock()
+	client := sm.client
+	sm.mu.RUnlock()
+
+	session, err := client.GetSession(sm.SessionID)
+	if err != nil {
+		log.Printf("Failed to load revert point for session %s: %v", sm.SessionID, err)
+		return
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.setRevertLocked(session.Revert)
+}
+
+func (sm *SessionManager) setRevertLocked(revert *api.SessionRevert) {
+	if sameRevert(sm.Revert, revert) {
+		return
+	}
+	sm.Revert = revert
+	sm.notifyStateChange()
+}
+
+func sameRevert(a, b *api.SessionRevert) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.MessageID == b.MessageID && a.PartID == b.PartID
+}
+
+// previousUserMessage returns the ID of the last user message that comes
+// before the message before, or of the last user message if before is empty.
+// Message IDs sort in creation order.
+func previousUserMessage(messages []api.MessageWithParts, before string) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		info := messages[i].Info
+		if info.Role() != "user" {
+			continue
+		}
+		if before == "" || info.ID() < before {
+			return info.ID()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package manager
+
+import (
+	"log"
+	"reflect"
+
+	"opencode_skill/internal/api"
+)
+
+// SyncTodos reloads the todo list from OpenCode, for todo.updated events
+// missed while the manager or the event stream was down.
+func (sm *SessionManager) SyncTodos() {
+	sm.mu.RLock()
+	client := sm.client
+	sm.mu.RUnlock()
+
+	todos, err := client.GetTodos(sm.SessionID)
+	if err != nil {
+		log.Printf("Failed to load todos for session %s: %v", sm.SessionID, err)
+		return
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.setTodosLocked(todos)
+}
+
+func (sm *SessionManager) setTodosLocked(todos []api.Todo) {
+	if len(todos) == 0 {
+		todos = nil
+	}
+	if reflect.DeepEqual(todos, sm.Todos) {
+		return
+	}
+	sm.Todos = todos
+	sm.notifyStateChange()
+}
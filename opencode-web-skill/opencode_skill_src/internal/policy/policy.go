@@ -0,0 +1,190 @@
+// Package policy decides OpenCode permission requests from per-session rules,
+// so unattended runs neither block on a human nor do something destructive.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type Action string
+
+const (
+	Allow  Action = "allow"
+	Reject Action = "reject"
+	// Ask leaves the request pending for a human.
+	Ask Action = "ask"
+)
+
+// WorkDir in a rule pattern stands for the session's working directory.
+// Such patterns are matched against request patterns resolved to absolute,
+// cleaned paths with symlinks resolved, so "{workdir}/*" matches neither
+// "../elsewhere" nor a link in the working directory that points elsewhere.
+const WorkDir = "{workdir}"
+
+// Rule matches permission requests by permission ("bash", "edit", ... or
+// "*") and by a wildcard pattern, where "*" matches any run of characters
+// and "?" any single one.
+type Rule struct {
+	Permission string `json:"permission"`
+	Pattern    string `json:"pattern"`
+	Action     Action `json:"action"`
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s %s %q", r.Action, r.Permission, r.Pattern)
+}
+
+// Policy is a session's rule set. A request is rejected if any of its
+// patterns matches a reject rule, left to a human if any matches an ask
+// rule, allowed if every pattern matches an allow rule, and otherwise left
+// to a human too. Rule order does not matter.
+type Policy []Rule
+
+// Parse decodes a JSON rule list. An empty string is an empty policy.
+func Parse(data string) (Policy, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var p Policy
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return nil, fmt.Errorf("invalid permission policy: %v", err)
+	}
+	for i, r := range p {
+		if r.Permission == "" || r.Pattern == "" {
+			return nil, fmt.Errorf("invalid permission policy: rule %d needs a permission and a pattern", i+1)
+		}
+		switch r.Action {
+		case Allow, Reject, Ask:
+		default:
+			return nil, fmt.Errorf("invalid permission policy: rule %d has action %q (want allow, reject or ask)", i+1, r.Action)
+		}
+	}
+	return p, nil
+}
+
+// Decision is the outcome of evaluating a request. Rule is the rule that
+// decided it and Pattern the request pattern it matched; both are empty when
+// no rule applied.
+type Decision struct {
+	Action  Action
+	Rule    *Rule
+	Pattern string
+}
+
+func (d Decision) String() string {
+	if d.Rule == nil {
+		if d.Pattern != "" {
+			return fmt.Sprintf("%s: no rule for %q", d.Action, d.Pattern)
+		}
+		return fmt.Sprintf("%s: no rule", d.Action)
+	}
+	return fmt.Sprintf("%s: %q matched rule %s", d.Action, d.Pattern, d.Rule)
+}
+
+// Evaluate decides a request for permission with the given patterns in a
+// session working in workDir.
+func (p Policy) Evaluate(permission string, patterns []string, workDir string) Decision {
+	if len(patterns) == 0 {
+		patterns = []string{""}
+	}
+
+	for _, action := range []Action{Reject, Ask} {
+		for _, pattern := range patterns {
+			if r := p.find(action, permission, pattern, workDir); r != nil {
+				return Decision{Action: action, Rule: r, Pattern: pattern}
+			}
+		}
+	}
+
+	var first *Rule
+	for _, pattern := range patterns {
+		r := p.find(Allow, permission, pattern, workDir)
+		if r == nil {
+			return Decision{Action: Ask, Pattern: pattern}
+		}
+		if first == nil {
+			first = r
+		}
+	}
+	return Decision{Action: Allow, Rule: first, Pattern: patterns[0]}
+}
+
+func (p Policy) find(action Action, permission, pattern, workDir string) *Rule {
+	for i := range p {
+		r := &p[i]
+		if r.Action == action && r.matches(permission, pattern, workDir) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (r Rule) matches(permission, pattern, workDir string) bool {
+	if r.Permission != "*" && r.Permission != permission {
+		return false
+	}
+	if !strings.Contains(r.Pattern, WorkDir) {
+		return Match(r.Pattern, pattern)
+	}
+
+	if workDir == "" {
+		return false
+	}
+	path := pattern
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, path)
+	}
+	return Match(strings.ReplaceAll(r.Pattern, WorkDir, resolve(workDir)), resolve(path))
+}
+
+// resolve cleans path and resolves the symlinks in as much of it as exists,
+// since the file a request names may not have been created yet.
+func resolve(path string) string {
+	path = filepath.Clean(path)
+	rest := ""
+	for {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// Match reports whether s matches the wildcard pattern, where "*" matches
+// any run of characters, including "/" and spaces, and "?" any one character.
+func Match(pattern, s string) bool {
+	px, sx := 0, 0
+	// Position to resume from after the last "*": the pattern index just
+	// past it and the string index it has consumed up to.
+	starPx, starSx := -1, 0
+
+	for sx < len(s) {
+		switch {
+		case px < len(pattern) && (pattern[px] == '?' || pattern[px] == s[sx]):
+			px++
+			sx++
+		case px < len(pattern) && pattern[px] == '*':
+			starPx, starSx = px+1, sx
+			px++
+		case starPx >= 0:
+			starSx++
+			px, sx = starPx, starSx
+		default:
+			return false
+		}
+	}
+
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+	return px == len(pattern)
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "anything at all", true},
+		{"go test*", "go test ./...", true},
+		{"go test*", "go vet ./...", false},
+		{"*rm -rf*", "cd build && rm -rf .", true},
+		{"*rm -rf*", "rm -r build", false},
+		{"/work/*", "/work/a/b.go", true},
+		{"/work/*", "/workshop/a.go", false},
+		{"file?.go", "file1.go", true},
+		{"file?.go", "file.go", false},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXbYd", false},
+		{"", "", true},
+		{"", "x", false},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Evaluate(t *testing.T) {
+	t.Parallel()
+
+	p, err := Parse(`[
+		{"permission": "edit", "pattern": "{workdir}/*", "action": "allow"},
+		{"permission": "bash", "pattern": "go test*", "action": "allow"},
+		{"permission": "bash", "pattern": "git *", "action": "allow"},
+		{"permission": "bash", "pattern": "*rm -rf*", "action": "reject"},
+		{"permission": "bash", "pattern": "*git push*", "action": "reject"},
+		{"permission": "*", "pattern": "*.env", "action": "ask"}
+	]`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		permission string
+		patterns   []string
+		want       Action
+	}{
+		{"relative edit in workdir", "edit", []string{"internal/main.go"}, Allow},
+		{"absolute edit in workdir", "edit", []string{"/work/main.go"}, Allow},
+		{"edit escaping workdir", "edit", []string{"../other/main.go"}, Ask},
+		{"absolute edit elsewhere", "edit", []string{"/etc/passwd"}, Ask},
+		{"go test", "bash", []string{"go test ./..."}, Allow},
+		{"unknown command", "bash", []string{"make"}, Ask},
+		{"rm -rf", "bash", []string{"rm -rf /"}, Reject},
+		{"reject beats allow", "bash", []string{"git push --force"}, Reject},
+		{"allowed git", "bash", []string{"git status"}, Allow},
+		{"one unmatched pattern asks", "bash", []string{"go test ./...", "make"}, Ask},
+		{"one rejected pattern rejects", "bash", []string{"go test ./...", "rm -rf ."}, Reject},
+		{"ask beats allow", "edit", []string{"/work/.env"}, Ask},
+		{"other permission", "webfetch", []string{"https://example.com"}, Ask},
+		{"no patterns", "bash", nil, Ask},
+	}
+
+	for _, tt := range tests {
+		d := p.Evaluate(tt.permission, tt.patterns, "/work")
+		if d.Action != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, d, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Evaluate_Decision(t *testing.T) {
+	t.Parallel()
+
+	p := Policy{{Permission: "bash", Pattern: "*rm -rf*", Action: Reject}}
+
+	d := p.Evaluate("bash", []string{"ls", "rm -rf build"}, "/work")
+	if d.Rule == nil || d.Rule.Pattern != "*rm -rf*" || d.Pattern != "rm -rf build" {
+		t.Fatalf("Expected the reject rule and matching pattern, got %+v", d)
+	}
+	if got, want := d.String(), `reject: "rm -rf build" matched rule reject bash "*rm -rf*"`; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	d = p.Evaluate("bash", []string{"ls"}, "/work")
+	if got, want := d.String(), `ask: no rule for "ls"`; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	if p, err := Parse(""); err != nil || p != nil {
+		t.Errorf("Parse(\"\") = %v, %v; want an empty policy", p, err)
+	}
+
+	invalid := []string{
+		`{"permission": "bash"}`,
+		`[{"permission": "bash", "pattern": "*"}]`,
+		`[{"permission": "bash", "pattern": "*", "action": "deny"}]`,
+		`[{"pattern": "*", "action": "allow"}]`,
+		`[{"permission": "bash", "action": "allow"}]`,
+	}
+	for _, data := range invalid {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestPolicy_Evaluate_Symlinks(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	workDir := filepath.Join(root, "work")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{workDir, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Mkdir failed: %v", err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(workDir, "link")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	p := Policy{{Permission: "edit", Pattern: "{workdir}/*", Action: Allow}}
+	tests := []struct {
+		pattern string
+		want    Action
+	}{
+		{"new/file.go", Allow},
+		{"link/file.go", Ask},
+		{filepath.Join(workDir, "link", "file.go"), Ask},
+	}
+
+	for _, tt := range tests {
+		if got := p.Evaluate("edit", []string{tt.pattern}, workDir); got.Action != tt.want {
+			t.Errorf("Evaluate(%q) = %s, want %s", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -36,5 +36,6 @@ func NewTestRegistry(t *testing.T) *daemon.Registry {
 func NewTestServer(t *testing.T, registry *daemon.Registry) *daemon.Server {
 	t.Helper()
 	s := daemon.NewServer(registry)
+	s.SetSocketPath(filepath.Join(t.TempDir(), "daemon.sock"))
 	return s
 }
@@ -1,5 +1,7 @@
 package types
 
+import "strings"
+
 // Request Types - shared between CLI and daemon
 
 type PromptRequest struct {
@@ -16,17 +18,86 @@ type CommandRequest struct {
 	Parts     []Part       `json:"parts"`
 }
 
+// ShellRequest runs Command in the session's working directory; the command
+// and its output join the conversation as if the agent had run it.
+type ShellRequest struct {
+	Agent   string       `json:"agent"`
+	Model   ModelDetails `json:"model"`
+	Command string       `json:"command"`
+}
+
 type AnswerRequest struct {
 	RequestID string     `json:"requestID"`
 	Answers   [][]string `json:"answers"`
 }
 
+// RejectRequest dismisses a pending question request; an empty RequestID
+// means the oldest one.
+type RejectRequest struct {
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// RevertRequest undoes a message, or one part of it, and everything after
+// it. An empty MessageID means the last user message before the current
+// revert point.
+type RevertRequest struct {
+	MessageID string `json:"messageID,omitempty"`
+	PartID    string `json:"partID,omitempty"`
+}
+
+// CompactRequest summarizes the session to free up context. A nil Model
+// means the model of the session's last reply. Auto marks compactions the
+// daemon starts itself.
+type CompactRequest struct {
+	Model *ModelDetails `json:"model,omitempty"`
+	Auto  bool          `json:"auto,omitempty"`
+}
+
+// PermitRequest replies to a pending permission request. Reply is "once",
+// "always" or "reject"; an empty RequestID means the oldest pending one.
+type PermitRequest struct {
+	RequestID string `json:"requestID,omitempty"`
+	Reply     string `json:"reply"`
+	Message   string `json:"message,omitempty"`
+}
+
 type ModelDetails struct {
 	ProviderID string `json:"providerID"`
 	ModelID    string `json:"modelID"`
 }
 
+// Part is a prompt part. Type selects which fields apply:
+//   - "text": Text
+//   - "file": Mime, URL (typically a data: URL) and Filename
+//   - "agent": Name, and Source locating the @mention in the text
+//   - "subtask": Agent, Description and Prompt, run as a subagent task
 type Part struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type        string      `json:"type"`
+	Text        string      `json:"text,omitempty"`
+	Mime        string      `json:"mime,omitempty"`
+	URL         string      `json:"url,omitempty"`
+	Filename    string      `json:"filename,omitempty"`
+	Name        string      `json:"name,omitempty"`
+	Source      *PartSource `json:"source,omitempty"`
+	Agent       string      `json:"agent,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Prompt      string      `json:"prompt,omitempty"`
+}
+
+// PartSource is the span of prompt text a part was taken from. Start and End
+// are UTF-16 offsets, as OpenCode counts them.
+type PartSource struct {
+	Value string `json:"value"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// ParseModel parses a "provider/model" string. A bare model ID is assumed to
+// belong to the zai-coding-plan provider.
+func ParseModel(m string) ModelDetails {
+	if strings.Contains(m, "/") {
+		parts := strings.SplitN(m, "/", 2)
+		return ModelDetails{ProviderID: parts[0], ModelID: parts[1]}
+	}
+	return ModelDetails{ProviderID: "zai-coding-plan", ModelID: m}
 }
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -14,46 +16,63 @@ import (
 	"opencode_skill/internal/client"
 	"opencode_skill/internal/config"
 	"opencode_skill/internal/daemon"
+	"opencode_skill/internal/policy"
 	"opencode_skill/internal/types"
 )
 
 func stopDaemon() bool {
-	// Find and kill process using the daemon port
-	fmt.Printf("Checking for process on port %d...\n", config.DaemonPort)
-
-	// Use lsof to find process using the port
-	cmd := exec.Command("lsof", "-ti", fmt.Sprintf(":%d", config.DaemonPort))
-	output, err := cmd.Output()
-
-	if err == nil && len(output) > 0 {
-		pidStr := strings.TrimSpace(string(output))
-		var pid int
-		fmt.Sscanf(pidStr, "%d", &pid)
-
-		if pid > 0 {
-			fmt.Printf("Stopping daemon (PID: %d)...\n", pid)
-			process, err := os.FindProcess(pid)
-			if err == nil {
-				process.Signal(syscall.SIGKILL)
-				time.Sleep(500 * time.Millisecond)
-				fmt.Println("Daemon stopped.")
-				return true
-			}
+	pid := findDaemonPID()
+	if pid > 0 {
+		fmt.Printf("Stopping daemon (PID: %d)...\n", pid)
+		process, err := os.FindProcess(pid)
+		if err == nil {
+			process.Signal(syscall.SIGKILL)
+			time.Sleep(500 * time.Millisecond)
+			os.Remove(config.PidFile)
+			os.Remove(config.SocketFile)
+			fmt.Println("Daemon stopped.")
+			return true
 		}
 	}
 
-	// Clean up PID file if exists
+	// Clean up PID file and socket if they exist
 	os.Remove(config.PidFile)
+	os.Remove(config.SocketFile)
 	fmt.Println("No running daemon found.")
 	return false
 }
 
-func startDaemon() {
-	// Check if daemon is already running
+// findDaemonPID returns the PID of the running daemon, or 0 if none is found.
+func findDaemonPID() int {
+	// Prefer the PID file, which works even when TCP is disabled
+	if pidBytes, err := os.ReadFile(config.PidFile); err == nil {
+		var pid int
+		fmt.Sscanf(strings.TrimSpace(string(pidBytes)), "%d", &pid)
+		if pid > 0 {
+			if process, err := os.FindProcess(pid); err == nil && process.Signal(syscall.Signal(0)) == nil {
+				return pid
+			}
+		}
+	}
+
+	// Fall back to the process using the daemon port
+	fmt.Printf("Checking for process on port %d...\n", config.DaemonPort)
 	cmd := exec.Command("lsof", "-ti", fmt.Sprintf(":%d", config.DaemonPort))
 	output, err := cmd.Output()
+	if err != nil || len(output) == 0 {
+		return 0
+	}
+
+	var pid int
+	fmt.Sscanf(strings.TrimSpace(string(output)), "%d", &pid)
+	return pid
+}
 
-	if err == nil && len(output) > 0 {
+func startDaemon(tcp, httpAPI bool) {
+	// Check if daemon is already running
+	c := client.NewClient("")
+	if c.Connect() == nil {
+		c.Close()
 		fmt.Println("Daemon is already running.")
 		return
 	}
@@ -61,7 +80,14 @@ func startDaemon() {
 	// Start daemon in background
 	fmt.Println("Starting daemon in background...")
 	executable, _ := os.Executable()
-	cmd = exec.Command(executable, "--daemon")
+	args := []string{"--daemon"}
+	if tcp {
+		args = append(args, "--tcp")
+	}
+	if httpAPI {
+		args = append(args, "--http")
+	}
+	cmd := exec.Command(executable, args...)
 	cmd.Dir = config.ProjectRoot
 	if err := cmd.Start(); err != nil {
 		fmt.Printf("Failed to start daemon: %v\n", err)
@@ -70,11 +96,11 @@ func startDaemon() {
 	fmt.Printf("Daemon started (PID: %d).\n", cmd.Process.Pid)
 }
 
-func restartDaemon() {
+func restartDaemon(tcp, httpAPI bool) {
 	stopDaemon()
 	// Clean up PID file if exists
 	os.Remove(config.PidFile)
-	startDaemon()
+	startDaemon(tcp, httpAPI)
 }
 
 func main() {
@@ -83,6 +109,16 @@ func main() {
 	model := flag.String("model", "zai-coding-plan/glm-5", "Model ID")
 	sync := flag.Bool("sync", false, "Send prompt and wait for result synchronously")
 	quiet := flag.Bool("quiet", false, "Suppress informational messages (keep errors)")
+	tcp := flag.Bool("tcp", false, "Daemon also listens on TCP")
+	httpAPI := flag.Bool("http", false, "Daemon also serves the HTTP API")
+	output := flag.String("output", string(client.OutputText), "Result format: text, markdown or json")
+	policyFlag := flag.String("policy", "", "With init-session: permission policy file, or inline JSON rules")
+	autoCompact := flag.Int("auto-compact", 0, "With init-session: compact the session once this percentage of the context window is used")
+	var files, globs stringList
+	flag.Var(&files, "file", "Attach a file to the prompt (repeatable)")
+	flag.Var(&globs, "glob", "Attach the files matching a glob pattern to the prompt (repeatable)")
+	var subtasks stringList
+	flag.Var(&subtasks, "subtask", `Delegate a subtask, agent:"description":"prompt" (repeatable)`)
 
 	flag.Parse()
 
@@ -91,13 +127,27 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to create registry: %v", err)
 		}
-		d := daemon.NewServer(registry)
+		tcpPort := 0
+		if *tcp {
+			tcpPort = config.DaemonPort
+		}
+		httpPort := 0
+		if *httpAPI {
+			httpPort = config.DaemonHTTPPort
+		}
+		d := daemon.NewServerWithPorts(registry, tcpPort, httpPort)
 		if err := d.Start(); err != nil {
 			log.Fatalf("Failed to start daemon: %v", err)
 		}
 		return
 	}
 
+	outputMode, err := client.ParseOutputMode(*output)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	args := flag.Args()
 	if len(args) < 1 {
 		printUsage()
@@ -108,19 +158,19 @@ func main() {
 
 	switch command {
 	case "start":
-		startDaemon()
+		startDaemon(*tcp, *httpAPI)
 		return
 	case "stop":
 		stopDaemon()
 		return
 	case "restart":
-		restartDaemon()
+		restartDaemon(*tcp, *httpAPI)
 		return
 	}
 
 	if command == "init-session" {
 		if len(args) < 4 {
-			fmt.Println("Usage: opencode_skill init-session <PROJECT> <SESSION_NAME> <WORKING_DIR>")
+			fmt.Println("Usage: opencode_skill [--policy <file|json>] [--auto-compact PERCENT] init-session <PROJECT> <SESSION_NAME> <WORKING_DIR>")
 			os.Exit(1)
 		}
 		project := args[1]
@@ -132,8 +182,17 @@ func main() {
 			log.Fatalf("Invalid working directory: %v", err)
 		}
 
+		permissionPolicy, err := loadPolicy(*policyFlag)
+		if err != nil {
+			log.Fatalf("Invalid --policy: %v", err)
+		}
+
+		if *autoCompact < 0 || *autoCompact > 100 {
+			log.Fatalf("Invalid --auto-compact: want a percentage from 1 to 100, or 0 for off")
+		}
+
 		c := client.NewClient("") // No session ID needed for init
-		sessionData, err := c.InitSession(project, sessionName, absDir)
+		sessionData, err := c.InitSession(project, sessionName, absDir, permissionPolicy, *autoCompact)
 		if err != nil {
 			log.Fatalf("Failed to initialize session: %v", err)
 		}
@@ -141,6 +200,145 @@ func main() {
 		return
 	}
 
+	if command == "fork" {
+		forkFlags := flag.NewFlagSet("fork", flag.ExitOnError)
+		at := forkFlags.String("at", "", "Fork before this message ID")
+		dir := forkFlags.String("dir", "", "Working directory; must be the parent's")
+		if len(args) < 4 {
+			fmt.Println("Usage: opencode_skill fork <PROJECT> <SESSION_NAME> <NEW_SESSION_NAME> [--at MESSAGE_ID] [--dir PATH]")
+			os.Exit(1)
+		}
+		forkFlags.Parse(args[4:])
+		project, sessionName, newSessionName := args[1], args[2], args[3]
+
+		c := client.NewClient("")
+		// OpenCode creates a fork in its parent's project and directory, so
+		// it cannot be moved elsewhere, e.g. into a git worktree
+		if *dir != "" {
+			absDir, err := filepath.Abs(*dir)
+			if err != nil {
+				log.Fatalf("Invalid directory: %v", err)
+			}
+			parent, err := c.GetSession(project, sessionName)
+			if err != nil {
+				log.Fatalf("Failed to fork session: %v", err)
+			}
+			if filepath.Clean(absDir) != filepath.Clean(parent.WorkingDir) {
+				log.Fatalf("Failed to fork session: --dir %s is not supported; OpenCode creates a fork in its parent's directory %s. Use init-session for a fresh session in another directory.", absDir, parent.WorkingDir)
+			}
+		}
+		sessionData, err := c.ForkSession(project, sessionName, newSessionName, *at)
+		if err != nil {
+			log.Fatalf("Failed to fork session: %v", err)
+		}
+		fmt.Printf("[SUCCESS] Session '%s %s' forked into '%s %s' with ID: %s in %s\n", project, sessionName, project, newSessionName, sessionData.ID, sessionData.WorkingDir)
+		return
+	}
+
+	if command == "adopt" {
+		adoptFlags := flag.NewFlagSet("adopt", flag.ExitOnError)
+		dir := adoptFlags.String("dir", "", "Working directory (default: the OpenCode session's)")
+		if len(args) < 4 {
+			fmt.Println("Usage: opencode_skill adopt <PROJECT> <SESSION_NAME> <OPENCODE_SESSION_ID|--pick> [--dir PATH]")
+			os.Exit(1)
+		}
+		adoptFlags.Parse(args[4:])
+		project, sessionName, sessionID := args[1], args[2], args[3]
+
+		workingDir := ""
+		if *dir != "" {
+			absDir, err := filepath.Abs(*dir)
+			if err != nil {
+				log.Fatalf("Invalid working directory: %v", err)
+			}
+			workingDir = absDir
+		}
+
+		c := client.NewClient("")
+		if sessionID == "--pick" {
+			sessions, err := c.ListRemoteSessions(workingDir)
+			if err != nil {
+				log.Fatalf("Failed to list OpenCode sessions: %v", err)
+			}
+			registered := map[string]string{}
+			if local, err := c.ListSessions(); err == nil {
+				for _, s := range local {
+					registered[s.ID] = s.Project + " " + s.SessionName
+				}
+			}
+			sessionID, err = client.PickRemoteSession(sessions, registered, bufio.NewReader(os.Stdin), os.Stdout)
+			if err != nil {
+				log.Fatalf("Failed to pick a session: %v", err)
+			}
+		}
+
+		sessionData, err := c.AdoptSession(project, sessionName, sessionID, workingDir)
+		if err != nil {
+			log.Fatalf("Failed to adopt session: %v", err)
+		}
+		fmt.Printf("[SUCCESS] OpenCode session %s adopted as '%s %s' in %s\n", sessionData.ID, project, sessionName, sessionData.WorkingDir)
+		return
+	}
+
+	if command == "delete-session" {
+		deleteFlags := flag.NewFlagSet("delete-session", flag.ExitOnError)
+		remote := deleteFlags.Bool("remote", false, "Also delete the session and its messages in OpenCode")
+		if len(args) < 3 {
+			fmt.Println("Usage: opencode_skill delete-session <PROJECT> <SESSION_NAME> [--remote]")
+			os.Exit(1)
+		}
+		deleteFlags.Parse(args[3:])
+
+		c := client.NewClient("")
+		message, err := c.DeleteSession(args[1], args[2], *remote)
+		if err != nil {
+			log.Fatalf("Failed to delete session: %v", err)
+		}
+		fmt.Printf("[SUCCESS] %s: '%s %s'\n", message, args[1], args[2])
+		return
+	}
+
+	if command == "archive-session" {
+		archiveFlags := flag.NewFlagSet("archive-session", flag.ExitOnError)
+		undo := archiveFlags.Bool("undo", false, "Restore an archived session")
+		if len(args) < 3 {
+			fmt.Println("Usage: opencode_skill archive-session <PROJECT> <SESSION_NAME> [--undo]")
+			os.Exit(1)
+		}
+		archiveFlags.Parse(args[3:])
+
+		c := client.NewClient("")
+		message, err := c.ArchiveSession(args[1], args[2], !*undo)
+		if err != nil {
+			log.Fatalf("Failed to archive session: %v", err)
+		}
+		fmt.Printf("[SUCCESS] %s: '%s %s'\n", message, args[1], args[2])
+		return
+	}
+
+	if command == "prune" {
+		pruneFlags := flag.NewFlagSet("prune", flag.ExitOnError)
+		olderThan := pruneFlags.String("older-than", "", "Delete sessions inactive for longer than this, e.g. 14d, 2w or 36h")
+		remote := pruneFlags.Bool("remote", false, "Also delete the sessions and their messages in OpenCode")
+		dryRun := pruneFlags.Bool("dry-run", false, "Only list the sessions that would be deleted")
+		pruneFlags.Parse(args[1:])
+		if *olderThan == "" {
+			fmt.Println("Usage: opencode_skill prune --older-than AGE [--remote] [--dry-run]")
+			os.Exit(1)
+		}
+
+		c := client.NewClient("")
+		sessions, message, err := c.PruneSessions(*olderThan, *remote, *dryRun)
+		if err != nil {
+			log.Fatalf("Failed to prune sessions: %v", err)
+		}
+		for _, s := range sessions {
+			fmt.Printf("  - %s %s (last active %s)\n", s.Project, s.SessionName, s.LastActivity)
+		}
+		fmt.Println(message)
+		return
+	}
+
 	// Normal run: <PROJECT> <SESSION_NAME> [MESSAGE...]
 	// Note: Flags must come BEFORE positional arguments (Go flag package behavior)
 	if len(args) < 2 {
@@ -148,7 +346,7 @@ func main() {
 		fmt.Println("   or: opencode_skill [flags] <PROJECT> <SESSION_NAME> /wait")
 		fmt.Println("   or: opencode_skill [flags] <PROJECT> <SESSION_NAME> /status")
 		fmt.Println("")
-		fmt.Println("Flags: --sync, --quiet, --agent, --model")
+		fmt.Println("Flags: --sync, --quiet, --output, --agent, --model, --file, --glob, --subtask")
 		os.Exit(1)
 	}
 
@@ -157,8 +355,13 @@ func main() {
 	messageParts := args[2:]
 
 	c := client.NewClient("") // Temp client for lookup
+	c.SetOutput(outputMode)
 	sessionData, err := c.GetSession(project, sessionName)
 	if err != nil {
+		if outputMode == client.OutputJSON {
+			c.PrintError(fmt.Sprintf("session '%s %s' not found: %v", project, sessionName, err))
+			os.Exit(1)
+		}
 		fmt.Printf("Session '%s %s' not found: %v\n", project, sessionName, err)
 		sessions, _ := c.ListSessions()
 		if len(sessions) == 0 {
@@ -166,23 +369,37 @@ func main() {
 		} else {
 			fmt.Println("Recent sessions:")
 			for _, s := range sessions {
-				fmt.Printf("  - %s %s (Dir: %s)\n", s.Project, s.SessionName, s.WorkingDir)
+				archived := ""
+				if s.Archived {
+					archived = ", archived"
+				}
+				fmt.Printf("  - %s %s (Dir: %s%s)\n", s.Project, s.SessionName, s.WorkingDir, archived)
 			}
 		}
 		fmt.Println("\nTo create a new session, run:")
 		fmt.Println("  opencode_skill init-session <PROJECT> <SESSION_NAME> <WORKING_DIR>")
+		fmt.Println("or, to take over a session started in OpenCode:")
+		fmt.Println("  opencode_skill adopt <PROJECT> <SESSION_NAME> --pick")
 		os.Exit(1)
 	}
 
+	c.Close()
+
 	// Now create the real client with session ID and metadata
 	c = client.NewClientWithMeta(sessionData.ID, project, sessionName)
 	c.SetQuiet(*quiet)
+	c.SetOutput(outputMode)
+	defer c.Close()
 
 	// Ensure session is started in daemon with correct working dir
-	_, err = c.SendRequest("START_SESSION", map[string]string{"working_dir": sessionData.WorkingDir})
+	res, err := c.SendRequest("START_SESSION", map[string]string{"working_dir": sessionData.WorkingDir})
 	if err != nil {
 		log.Fatalf("Failed to start session: %v", err)
 	}
+	if status, _ := res["status"].(string); status != "ok" {
+		c.PrintError(res["message"])
+		os.Exit(1)
+	}
 
 	if len(messageParts) == 0 {
 		fmt.Println("No message provided.")
@@ -192,53 +409,222 @@ func main() {
 	cmd := messageParts[0]
 
 	if cmd == "/wait" {
+		for _, arg := range messageParts[1:] {
+			if arg == "--follow" || arg == "-f" {
+				c.SetFollow(true)
+			}
+		}
 		c.WaitForResult()
 	} else if cmd == "/status" {
 		c.Status()
+	} else if cmd == "/todo" {
+		c.Todo()
+	} else if cmd == "/diff" {
+		messageID, stat := "", false
+		for _, arg := range messageParts[1:] {
+			switch {
+			case arg == "--stat":
+				stat = true
+			case strings.HasPrefix(arg, "-") || messageID != "":
+				fmt.Println("Usage: /diff [MESSAGE_ID] [--stat]")
+				return
+			default:
+				messageID = arg
+			}
+		}
+		c.Diff(messageID, stat)
+	} else if cmd == "/history" {
+		limit, err := parseHistoryLimit(messageParts[1:])
+		if err != nil {
+			c.PrintError(err)
+			fmt.Println("Usage: /history [--limit N]")
+			return
+		}
+		c.History(limit)
+	} else if cmd == "/show" {
+		if len(messageParts) != 2 {
+			fmt.Println("Usage: /show MESSAGE_ID")
+			return
+		}
+		c.Show(messageParts[1])
 	} else if cmd == "/answer" {
-		answers := messageParts[1:]
-		if len(answers) == 0 {
-			fmt.Println("Usage: /answer <answer_text> ...")
+		if len(messageParts) < 2 {
+			fmt.Println("Usage: /answer [--request <REQUEST_ID>] [N=]<answer> ...")
+			fmt.Println("   or: /answer -i [--request <REQUEST_ID>]")
 			return
 		}
 
-		// Get status to find Question ID
-		resp, _ := c.SendRequest("GET_STATUS", nil)
-		data, _ := resp["data"].(map[string]interface{})
-		qs, _ := data["questions"].([]interface{})
-		if len(qs) == 0 {
-			fmt.Println("No pending questions.")
+		snap, err := c.GetStatus()
+		if err != nil {
+			c.PrintError(err)
+			return
+		}
+		var payload types.AnswerRequest
+		if args := messageParts[1:]; args[0] == "-i" || args[0] == "--interactive" {
+			payload, err = client.AnswerInteractively(snap.Questions, args[1:])
+		} else {
+			payload, err = client.ParseAnswers(snap.Questions, args)
+		}
+		if err != nil {
+			c.PrintError(err)
 			return
 		}
 
-		q, _ := qs[0].(map[string]interface{})
-		reqID, _ := q["id"].(string)
+		res, err := c.SendRequest("ANSWER", payload)
+		if err != nil {
+			c.PrintError(err)
+			return
+		}
 
-		formattedAnswers := [][]string{}
-		for _, a := range answers {
-			formattedAnswers = append(formattedAnswers, []string{a})
+		if status, ok := res["status"].(string); ok && status == "error" {
+			c.PrintError(res["message"])
+			return
+		}
+
+		if *sync {
+			c.WaitForResult()
+		} else {
+			fmt.Printf("Answer status: %v\n", res["message"])
+			fmt.Printf("[SUBMITTED] Run: opencode_skill %s %s /wait\n", project, sessionName)
 		}
 
-		payload := types.AnswerRequest{
-			RequestID: reqID,
-			Answers:   formattedAnswers,
+	} else if cmd == "/reject" {
+		payload := types.RejectRequest{}
+		if len(messageParts) > 1 {
+			payload.RequestID = messageParts[1]
 		}
 
-		res, err := c.SendRequest("ANSWER", payload)
+		res, err := c.SendRequest("REJECT", payload)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+			c.PrintError(err)
 			return
 		}
 
 		if status, ok := res["status"].(string); ok && status == "error" {
-			fmt.Printf("Error: %v\n", res["message"])
+			c.PrintError(res["message"])
 			return
 		}
 
 		if *sync {
 			c.WaitForResult()
 		} else {
-			fmt.Printf("Answer status: %v\n", res["message"])
+			fmt.Printf("Reject status: %v\n", res["message"])
+			fmt.Printf("[SUBMITTED] Run: opencode_skill %s %s /wait\n", project, sessionName)
+		}
+
+	} else if cmd == "/undo" || cmd == "/redo" {
+		action, payload := "REDO", interface{}(nil)
+		if cmd == "/undo" {
+			req := types.RevertRequest{}
+			if len(messageParts) > 1 {
+				req.MessageID = messageParts[1]
+			}
+			action, payload = "UNDO", req
+		}
+
+		res, err := c.SendRequest(action, payload)
+		if err != nil {
+			c.PrintError(err)
+			return
+		}
+
+		if status, ok := res["status"].(string); ok && status == "error" {
+			c.PrintError(res["message"])
+			return
+		}
+
+		fmt.Printf("%s status: %v\n", strings.TrimPrefix(cmd, "/"), res["message"])
+		fmt.Printf("Run: opencode_skill %s %s /status to see the revert point\n", project, sessionName)
+
+	} else if cmd == "/compact" {
+		action, payload := "COMPACT", interface{}(types.CompactRequest{})
+		if len(messageParts) > 1 {
+			percent, err := parseAutoCompact(messageParts[1:])
+			if err != nil {
+				c.PrintError(err)
+				fmt.Println("Usage: /compact [--auto PERCENT|off]")
+				return
+			}
+			action, payload = "SET_AUTO_COMPACT", map[string]interface{}{"percent": percent}
+		}
+
+		res, err := c.SendRequest(action, payload)
+		if err != nil {
+			c.PrintError(err)
+			return
+		}
+
+		if status, ok := res["status"].(string); ok && status == "error" {
+			c.PrintError(res["message"])
+			return
+		}
+
+		if action == "SET_AUTO_COMPACT" {
+			fmt.Printf("%v\n", res["message"])
+		} else if *sync {
+			c.WaitForResult()
+		} else {
+			fmt.Printf("Compact status: %v\n", res["message"])
+			fmt.Printf("[SUBMITTED] Run: opencode_skill %s %s /wait\n", project, sessionName)
+		}
+
+	} else if cmd == "/permit" {
+		if len(messageParts) < 2 {
+			fmt.Println("Usage: /permit once|always|reject [message]")
+			return
+		}
+
+		payload := types.PermitRequest{
+			Reply:   messageParts[1],
+			Message: strings.Join(messageParts[2:], " "),
+		}
+
+		res, err := c.SendRequest("PERMIT", payload)
+		if err != nil {
+			c.PrintError(err)
+			return
+		}
+
+		if status, ok := res["status"].(string); ok && status == "error" {
+			c.PrintError(res["message"])
+			return
+		}
+
+		if *sync {
+			c.WaitForResult()
+		} else {
+			fmt.Printf("Permission reply: %v\n", res["message"])
+			fmt.Printf("[SUBMITTED] Run: opencode_skill %s %s /wait\n", project, sessionName)
+		}
+
+	} else if cmd == "/shell" {
+		command := strings.Join(messageParts[1:], " ")
+		if command == "" {
+			fmt.Println("Usage: /shell <command>")
+			return
+		}
+
+		payload := types.ShellRequest{
+			Agent:   *agent,
+			Model:   types.ParseModel(*model),
+			Command: command,
+		}
+
+		res, err := c.SendRequest("SHELL", payload)
+		if err != nil {
+			c.PrintError(err)
+			return
+		}
+
+		if status, ok := res["status"].(string); ok && status == "error" {
+			c.PrintError(res["message"])
+			return
+		}
+
+		if *sync {
+			c.WaitForResult()
+		} else {
+			fmt.Printf("Shell command sent: %v\n", res["message"])
 			fmt.Printf("[SUBMITTED] Run: opencode_skill %s %s /wait\n", project, sessionName)
 		}
 
@@ -247,21 +633,32 @@ func main() {
 		command := cmd[1:]
 		arguments := strings.Join(messageParts[1:], " ")
 
+		if len(subtasks) > 0 {
+			c.PrintError("--subtask only applies to prompts, not commands")
+			return
+		}
+		attachments, err := client.FileParts(files, globs)
+		if err != nil {
+			c.PrintError(err)
+			return
+		}
+
 		payload := types.CommandRequest{
 			Agent:     *agent,
-			Model:     parseModel(*model),
+			Model:     types.ParseModel(*model),
 			Command:   command,
 			Arguments: arguments,
+			Parts:     attachments,
 		}
 
 		res, err := c.SendRequest("COMMAND", payload)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+			c.PrintError(err)
 			return
 		}
 
 		if status, ok := res["status"].(string); ok && status == "error" {
-			fmt.Printf("Error: %v\n", res["message"])
+			c.PrintError(res["message"])
 			return
 		}
 
@@ -275,20 +672,42 @@ func main() {
 	} else {
 		// Prompt
 		fullMessage := strings.Join(messageParts, " ")
+		var agents []string
+		if client.HasMentions(fullMessage) {
+			// Without the agent list the mentions are sent as plain text
+			if agents, err = c.AgentNames(); err != nil {
+				log.Printf("Warning: could not list agents, sending @mentions as plain text: %v", err)
+			}
+		}
+		parts := append([]types.Part{{Type: "text", Text: fullMessage}}, client.AgentParts(fullMessage, agents)...)
+		for _, value := range subtasks {
+			part, err := client.ParseSubtask(value)
+			if err != nil {
+				c.PrintError(err)
+				return
+			}
+			parts = append(parts, part)
+		}
+		attachments, err := client.FileParts(files, globs)
+		if err != nil {
+			c.PrintError(err)
+			return
+		}
+
 		payload := types.PromptRequest{
 			Agent: *agent,
-			Model: parseModel(*model),
-			Parts: []types.Part{{Type: "text", Text: fullMessage}},
+			Model: types.ParseModel(*model),
+			Parts: append(parts, attachments...),
 		}
 
 		res, err := c.SendRequest("PROMPT", payload)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err) // e.g. "Session is busy"
+			c.PrintError(err) // e.g. "Session is busy"
 			return
 		}
 
 		if status, ok := res["status"].(string); ok && status == "error" {
-			fmt.Printf("Error: %v\n", res["message"])
+			c.PrintError(res["message"])
 			return
 		}
 
@@ -301,12 +720,71 @@ func main() {
 	}
 }
 
-func parseModel(m string) types.ModelDetails {
-	if strings.Contains(m, "/") {
-		parts := strings.SplitN(m, "/", 2)
-		return types.ModelDetails{ProviderID: parts[0], ModelID: parts[1]}
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseAutoCompact parses the arguments of /compact --auto: a percentage of
+// the context window, or off.
+func parseAutoCompact(args []string) (int, error) {
+	if len(args) != 2 || args[0] != "--auto" {
+		return 0, fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+	if args[1] == "off" {
+		return 0, nil
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(args[1], "%"))
+	if err != nil || percent < 1 || percent > 100 {
+		return 0, fmt.Errorf("--auto wants a percentage from 1 to 100, or off")
+	}
+	return percent, nil
+}
+
+// loadPolicy reads a --policy value: inline JSON if it starts with "[",
+// otherwise the path of a JSON rules file.
+func loadPolicy(value string) (string, error) {
+	data := strings.TrimSpace(value)
+	if data != "" && !strings.HasPrefix(data, "[") {
+		raw, err := os.ReadFile(value)
+		if err != nil {
+			return "", err
+		}
+		data = string(raw)
+	}
+	if _, err := policy.Parse(data); err != nil {
+		return "", err
+	}
+	return data, nil
+}
+
+// parseHistoryLimit parses the arguments of /history: --limit N, where 0
+// lists every message.
+func parseHistoryLimit(args []string) (int, error) {
+	limit := config.DefaultHistoryLimit
+	for i := 0; i < len(args); i++ {
+		value, ok := strings.CutPrefix(args[i], "--limit=")
+		if !ok {
+			if args[i] != "--limit" || i+1 == len(args) {
+				return 0, fmt.Errorf("unexpected argument %q", args[i])
+			}
+			i++
+			value = args[i]
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("--limit must be a non-negative integer, got %q", value)
+		}
+		limit = n
 	}
-	return types.ModelDetails{ProviderID: "zai-coding-plan", ModelID: m}
+	return limit, nil
 }
 
 func formatSubmittedMessage(project, session string) string {
@@ -318,14 +796,39 @@ func printUsage() {
 	fmt.Println("  opencode_skill start")
 	fmt.Println("  opencode_skill stop")
 	fmt.Println("  opencode_skill restart")
-	fmt.Println("  opencode_skill init-session <PROJECT> <SESSION_NAME> <WORKING_DIR>")
+	fmt.Println("  opencode_skill [--policy <file|json>] [--auto-compact PERCENT] init-session <PROJECT> <SESSION_NAME> <WORKING_DIR>")
+	fmt.Println("  opencode_skill fork <PROJECT> <SESSION_NAME> <NEW_SESSION_NAME> [--at MESSAGE_ID] [--dir PATH]")
+	fmt.Println("  opencode_skill adopt <PROJECT> <SESSION_NAME> <OPENCODE_SESSION_ID|--pick> [--dir PATH]")
+	fmt.Println("  opencode_skill delete-session <PROJECT> <SESSION_NAME> [--remote]")
+	fmt.Println("  opencode_skill archive-session <PROJECT> <SESSION_NAME> [--undo]")
+	fmt.Println("  opencode_skill prune --older-than AGE [--remote] [--dry-run]")
 	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> <MESSAGE>")
-	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /wait")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /wait [--follow]")
 	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /status")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /todo")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /diff [MESSAGE_ID] [--stat]")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /history [--limit N]")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /show MESSAGE_ID")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /answer [--request <ID>] [N=]<answer> ...")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /answer -i [--request <ID>]")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /reject [REQUEST_ID]")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /permit once|always|reject [message]")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /undo [MESSAGE_ID]")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /redo")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /compact [--auto PERCENT|off]")
+	fmt.Println("  opencode_skill [flags] <PROJECT> <SESSION_NAME> /shell <COMMAND>")
 	fmt.Println("")
 	fmt.Println("Flags (must come before positional arguments):")
 	fmt.Println("  --sync    Send prompt and wait for result synchronously")
 	fmt.Println("  --quiet   Suppress informational messages (keep errors)")
+	fmt.Println("  --output  Result format: text (default), markdown or json")
 	fmt.Println("  --agent   Agent name (default: sisyphus)")
 	fmt.Println("  --model   Model ID (default: zai-coding-plan/glm-5)")
+	fmt.Println("  --tcp     With start/restart: also listen on TCP 127.0.0.1:44111")
+	fmt.Println("  --http    With start/restart: also serve the HTTP API on 127.0.0.1:44112")
+	fmt.Println("  --policy  With init-session: permission policy rules file or inline JSON")
+	fmt.Println("  --auto-compact With init-session: compact once this % of the context window is used (0: off)")
+	fmt.Println("  --file    Attach a file to the prompt or command (repeatable)")
+	fmt.Println("  --glob    Attach the files matching a pattern, e.g. 'logs/*.log' (repeatable)")
+	fmt.Println("  --subtask Delegate a subtask to an agent: agent:\"description\":\"prompt\" (repeatable)")
 }